@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/brookwarren/chirpy/internal/auth"
+	"github.com/brookwarren/chirpy/internal/database"
+)
+
+const (
+	accessTokenLifetime  = time.Hour
+	refreshTokenLifetime = time.Hour * 24 * 30 * 6
+)
+
+// session is who authorised a request: the user an access token was issued
+// to and the role it carries.
+type session struct {
+	UserID int
+	Role   database.Role
+}
+
+type sessionContextKey struct{}
+
+// requireUser returns the ID of the user whose access token authorised r. If
+// there isn't one it responds with an error and reports false.
+func (cfg *apiConfig) requireUser(w http.ResponseWriter, r *http.Request) (int, bool) {
+	s, ok := cfg.requireSession(w, r)
+	return s.UserID, ok
+}
+
+// requireSession is requireUser for handlers that need the caller's role
+// too. It reuses the session middlewareRequireRole checked, if any.
+func (cfg *apiConfig) requireSession(w http.ResponseWriter, r *http.Request) (session, bool) {
+	if s, ok := r.Context().Value(sessionContextKey{}).(session); ok {
+		return s, true
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT")
+		return session{}, false
+	}
+	claims, err := auth.ParseJWT(token, cfg.jwtSecret, auth.TokenTypeAccess)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT")
+		return session{}, false
+	}
+	if _, ok := cfg.checkSession(w, claims.UserID, claims.IssuedAt); !ok {
+		return session{}, false
+	}
+	return session{UserID: claims.UserID, Role: database.Role(claims.Role)}, true
+}
+
+// optionalUser is requireUser for endpoints that anonymous callers may use
+// too. Without an Authorization header it reports user 0.
+func (cfg *apiConfig) optionalUser(w http.ResponseWriter, r *http.Request) (int, bool) {
+	if r.Header.Get("Authorization") == "" {
+		return 0, true
+	}
+	return cfg.requireUser(w, r)
+}
+
+// checkSession makes sure a token issued to userID at issuedAt hasn't been
+// revoked along with the rest of the user's sessions, and that the user
+// isn't suspended, returning the user. If either is the case, it responds
+// with an error and reports false. Changing a user's role revokes their
+// sessions too, so a token never carries a role the user no longer has.
+func (cfg *apiConfig) checkSession(w http.ResponseWriter, userID int, issuedAt time.Time) (database.User, bool) {
+	user, err := cfg.DB.GetUser(userID)
+	if errors.Is(err, database.ErrNotExist) {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT")
+		return database.User{}, false
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't check session")
+		return database.User{}, false
+	}
+	if issuedAt.Before(user.SessionsValidAfter) {
+		respondWithError(w, http.StatusUnauthorized, "Session is revoked")
+		return database.User{}, false
+	}
+	if user.Suspended {
+		respondWithError(w, http.StatusForbidden, "Account is suspended")
+		return database.User{}, false
+	}
+	return user, true
+}
+
+// requireRole is requireSession for endpoints only users with at least role
+// may use.
+func (cfg *apiConfig) requireRole(w http.ResponseWriter, r *http.Request, role database.Role) (session, bool) {
+	s, ok := cfg.requireSession(w, r)
+	if !ok {
+		return session{}, false
+	}
+	if !s.Role.Includes(role) {
+		respondWithError(w, http.StatusForbidden, fmt.Sprintf("Only %ss can do this", role))
+		return session{}, false
+	}
+	return s, true
+}
+
+// requireModerator is requireUser for the moderation endpoints.
+func (cfg *apiConfig) requireModerator(w http.ResponseWriter, r *http.Request) (int, bool) {
+	s, ok := cfg.requireRole(w, r, database.RoleModerator)
+	return s.UserID, ok
+}
+
+// middlewareRequireRole lets through only the requests authorised by a user
+// with at least role. The handlers it wraps can get the caller's session
+// from requireSession without checking the token again.
+func (cfg *apiConfig) middlewareRequireRole(role database.Role, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s, ok := cfg.requireRole(w, r, role)
+		if !ok {
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), sessionContextKey{}, s)))
+	})
+}
+
+// makeTokens starts a session for user, returning its access and refresh
+// tokens.
+func (cfg *apiConfig) makeTokens(user database.User) (string, string, error) {
+	accessToken, err := auth.MakeJWT(user.ID, string(user.Role), cfg.jwtSecret, accessTokenLifetime, auth.TokenTypeAccess)
+	if err != nil {
+		return "", "", err
+	}
+	refreshToken, err := auth.MakeJWT(user.ID, string(user.Role), cfg.jwtSecret, refreshTokenLifetime, auth.TokenTypeRefresh)
+	if err != nil {
+		return "", "", err
+	}
+	return accessToken, refreshToken, nil
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/brookwarren/chirpy/internal/database"
+)
+
+const bootstrapAdminUsage = "usage: chirpy bootstrap-admin EMAIL"
+
+// runBootstrapAdmin implements the `chirpy bootstrap-admin` subcommand, which
+// makes an existing user the first admin. Every later role change is made
+// by an admin through the API.
+func runBootstrapAdmin(args []string) error {
+	if len(args) != 1 {
+		return errors.New(bootstrapAdminUsage)
+	}
+
+	db, err := openStore(database.Options{
+		Journal: os.Getenv("DB_JOURNAL") == "true",
+	})
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	user, err := db.BootstrapAdmin(args[0])
+	if errors.Is(err, database.ErrNotExist) {
+		return fmt.Errorf("no user has the email %q", args[0])
+	}
+	if errors.Is(err, database.ErrAdminExists) {
+		return errors.New("an admin already exists; ask them to assign roles through the API")
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("User %d (%s) is now an admin\n", user.ID, user.Email)
+	return nil
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"regexp"
+
+	"github.com/brookwarren/chirpy/internal/database"
+	"github.com/brookwarren/chirpy/internal/moderation"
+	"github.com/rivo/uniseg"
+)
+
+const (
+	maxChirpLength          = 140
+	maxChirpyRedChirpLength = 280
+	urlWeight               = 23
+)
+
+var urlPattern = regexp.MustCompile(`(?i)\bhttps?://[^\s]+`)
+
+type chirpTooLongError struct {
+	Length int
+	Limit  int
+}
+
+func (e chirpTooLongError) Error() string {
+	return "Chirp is too long"
+}
+
+type chirpRejectedError struct {
+	Reasons []string
+}
+
+func (e chirpRejectedError) Error() string {
+	return "Chirp was rejected"
+}
+
+// chirpLength counts a chirp the way users see it: in grapheme clusters, so
+// an emoji or an accented letter is one character however many bytes it
+// takes. Every URL counts as urlWeight characters regardless of its length.
+func chirpLength(body string) int {
+	length := 0
+	last := 0
+	for _, match := range urlPattern.FindAllStringIndex(body, -1) {
+		length += uniseg.GraphemeClusterCount(body[last:match[0]]) + urlWeight
+		last = match[1]
+	}
+	return length + uniseg.GraphemeClusterCount(body[last:])
+}
+
+func chirpLengthLimit(author database.User) int {
+	if author.IsChirpyRed {
+		return maxChirpyRedChirpLength
+	}
+	return maxChirpLength
+}
+
+// validateChirp checks the length of a chirp against its author's limit and
+// runs it through the moderation rules, returning the body with any masked
+// words replaced.
+func (cfg *apiConfig) validateChirp(body string, author database.User) (string, error) {
+	length, limit := chirpLength(body), chirpLengthLimit(author)
+	if length > limit {
+		return "", chirpTooLongError{Length: length, Limit: limit}
+	}
+
+	result := cfg.moderator.Moderate(body)
+	if result.Rejected {
+		reasons := []string{}
+		for _, flag := range result.Flags {
+			if flag.Action == moderation.ActionReject {
+				reasons = append(reasons, flag.Reason)
+			}
+		}
+		return "", chirpRejectedError{Reasons: reasons}
+	}
+	return result.Text, nil
+}
+
+// respondWithChirpError reports a validateChirp failure with the details a
+// client needs to fix the chirp.
+func respondWithChirpError(w http.ResponseWriter, err error) {
+	var tooLong chirpTooLongError
+	if errors.As(err, &tooLong) {
+		respondWithJSON(w, http.StatusBadRequest, struct {
+			Error  string `json:"error"`
+			Length int    `json:"length"`
+			Limit  int    `json:"limit"`
+		}{
+			Error:  tooLong.Error(),
+			Length: tooLong.Length,
+			Limit:  tooLong.Limit,
+		})
+		return
+	}
+
+	var rejected chirpRejectedError
+	if errors.As(err, &rejected) {
+		respondWithJSON(w, http.StatusBadRequest, struct {
+			Error   string   `json:"error"`
+			Reasons []string `json:"reasons"`
+		}{
+			Error:   rejected.Error(),
+			Reasons: rejected.Reasons,
+		})
+		return
+	}
+
+	respondWithError(w, http.StatusBadRequest, err.Error())
+}
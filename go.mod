@@ -3,8 +3,13 @@ module github.com/brookwarren/chirpy
 go 1.22.0
 
 require (
-	github.com/go-chi/chi/v5 v5.0.12 // indirect
-	github.com/golang-jwt/jwt/v5 v5.2.1 // indirect
-	github.com/joho/godotenv v1.5.1 // indirect
-	golang.org/x/crypto v0.21.0 // indirect
+	github.com/golang-jwt/jwt/v5 v5.2.1
+	github.com/joho/godotenv v1.5.1
+	github.com/mattn/go-sqlite3 v1.14.22
+	github.com/rivo/uniseg v0.4.7
+	golang.org/x/crypto v0.21.0
+	golang.org/x/image v0.15.0
+	golang.org/x/text v0.14.0
 )
+
+require github.com/go-chi/chi/v5 v5.0.12 // indirect
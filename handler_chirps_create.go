@@ -4,89 +4,236 @@ import (
 	"encoding/json"
 	"errors"
 	"net/http"
-	"strconv"
-	"strings"
+	"time"
 
-	"github.com/brookwarren/chirpy/internal/auth"
+	"github.com/brookwarren/chirpy/internal/database"
 )
 
 type Chirp struct {
-	ID       int    `json:"id"`
-	AuthorID int    `json:"author_id"`
-	Body     string `json:"body"`
+	ID        int       `json:"id"`
+	AuthorID  int       `json:"author_id"`
+	Body      string    `json:"body"`
+	InReplyTo int       `json:"in_reply_to,omitempty"`
+	Entities  Entities  `json:"entities"`
+	MediaIDs  []int     `json:"media_ids"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	// Visibility is "public", "followers", "unlisted" or "private".
+	Visibility database.Visibility `json:"visibility"`
+	// Hidden is set on chirps a moderator has hidden, which only their
+	// author still sees.
+	Hidden bool `json:"hidden,omitempty"`
+
+	LikeCount     int  `json:"like_count"`
+	RechirpCount  int  `json:"rechirp_count"`
+	LikedByMe     bool `json:"liked_by_me"`
+	RechirpedByMe bool `json:"rechirped_by_me"`
+	// Rechirp is set when the chirp is in a feed because someone rechirped it.
+	Rechirp *Rechirp `json:"rechirp,omitempty"`
 }
 
-func (cfg *apiConfig) handlerChirpsCreate(w http.ResponseWriter, r *http.Request) {
-	type parameters struct {
-		Body string `json:"body"`
+type Rechirp struct {
+	UserID    int       `json:"user_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Entities are the hashtags and mentions in a chirp's body. Start and End
+// count Unicode code points, End exclusive, and include the leading # or @.
+type Entities struct {
+	Hashtags []Hashtag `json:"hashtags"`
+	Mentions []Mention `json:"mentions"`
+}
+
+type Hashtag struct {
+	Tag   string `json:"tag"`
+	Start int    `json:"start"`
+	End   int    `json:"end"`
+}
+
+type Mention struct {
+	Username string `json:"username"`
+	UserID   int    `json:"user_id,omitempty"`
+	Start    int    `json:"start"`
+	End      int    `json:"end"`
+}
+
+func chirpFromDB(dbChirp database.Chirp) Chirp {
+	entities := Entities{
+		Hashtags: []Hashtag{},
+		Mentions: []Mention{},
+	}
+	for _, hashtag := range dbChirp.Hashtags {
+		entities.Hashtags = append(entities.Hashtags, Hashtag{
+			Tag:   hashtag.Tag,
+			Start: hashtag.Start,
+			End:   hashtag.End,
+		})
+	}
+	for _, mention := range dbChirp.Mentions {
+		entities.Mentions = append(entities.Mentions, Mention{
+			Username: mention.Username,
+			UserID:   mention.UserID,
+			Start:    mention.Start,
+			End:      mention.End,
+		})
 	}
 
-	token, err := auth.GetBearerToken(r.Header)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT")
-		return
+	mediaIDs := []int{}
+	mediaIDs = append(mediaIDs, dbChirp.MediaIDs...)
+
+	return Chirp{
+		ID:         dbChirp.ID,
+		AuthorID:   dbChirp.AuthorID,
+		Body:       dbChirp.Body,
+		InReplyTo:  dbChirp.InReplyTo,
+		Entities:   entities,
+		MediaIDs:   mediaIDs,
+		CreatedAt:  dbChirp.CreatedAt,
+		UpdatedAt:  dbChirp.UpdatedAt,
+		Visibility: dbChirp.Visibility,
+		Hidden:     dbChirp.Hidden,
+	}
+}
+
+// chirpsForViewer converts chirps for a response to viewerID, who is 0 when
+// anonymous, filling in their reaction counts. rechirps may be nil.
+func (cfg *apiConfig) chirpsForViewer(dbChirps []database.Chirp, rechirps map[int]database.Reaction, viewerID int) ([]Chirp, error) {
+	ids := make([]int, 0, len(dbChirps))
+	for _, dbChirp := range dbChirps {
+		ids = append(ids, dbChirp.ID)
 	}
-	subject, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	stats, err := cfg.DB.GetChirpStats(ids, viewerID)
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT")
-		return
+		return nil, err
+	}
+
+	chirps := make([]Chirp, 0, len(dbChirps))
+	for _, dbChirp := range dbChirps {
+		chirp := chirpFromDB(dbChirp)
+		chirpStats := stats[dbChirp.ID]
+		chirp.LikeCount = chirpStats.Likes
+		chirp.RechirpCount = chirpStats.Rechirps
+		chirp.LikedByMe = chirpStats.Liked
+		chirp.RechirpedByMe = chirpStats.Rechirped
+		if rechirp, ok := rechirps[dbChirp.ID]; ok {
+			chirp.Rechirp = &Rechirp{
+				UserID:    rechirp.UserID,
+				CreatedAt: rechirp.CreatedAt,
+			}
+		}
+		chirps = append(chirps, chirp)
 	}
-	userID, err := strconv.Atoi(subject)
+	return chirps, nil
+}
+
+func (cfg *apiConfig) chirpForViewer(dbChirp database.Chirp, viewerID int) (Chirp, error) {
+	chirps, err := cfg.chirpsForViewer([]database.Chirp{dbChirp}, nil, viewerID)
 	if err != nil {
-		respondWithError(w, http.StatusBadRequest, "Couldn't parse user ID")
+		return Chirp{}, err
+	}
+	return chirps[0], nil
+}
+
+func (cfg *apiConfig) handlerChirpsCreate(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Body      string `json:"body"`
+		InReplyTo int    `json:"in_reply_to"`
+		MediaIDs  []int  `json:"media_ids"`
+		// Visibility defaults to public.
+		Visibility database.Visibility `json:"visibility"`
+		// Draft saves the chirp without publishing it, and PublishAt
+		// schedules it to be published later.
+		Draft     bool       `json:"draft"`
+		PublishAt *time.Time `json:"publish_at"`
+	}
+
+	userID, ok := cfg.requireUser(w, r)
+	if !ok {
 		return
 	}
 
 	decoder := json.NewDecoder(r.Body)
 	params := parameters{}
-	err = decoder.Decode(&params)
+	err := decoder.Decode(&params)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't decode parameters")
 		return
 	}
 
-	cleaned, err := validateChirp(params.Body)
+	err = checkMediaIDs(params.MediaIDs)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if params.Draft && params.PublishAt != nil {
+		respondWithError(w, http.StatusBadRequest, "A chirp can't be both a draft and scheduled")
+		return
+	}
+	err = checkPublishAt(params.PublishAt)
 	if err != nil {
 		respondWithError(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	chirp, err := cfg.DB.CreateChirp(cleaned, userID)
+	author, err := cfg.DB.GetUser(userID)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Couldn't create chirp")
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get user")
 		return
 	}
 
-	respondWithJSON(w, http.StatusCreated, Chirp{
-		ID:       chirp.ID,
-		AuthorID: chirp.AuthorID,
-		Body:     chirp.Body,
-	})
-}
+	cleaned, err := cfg.validateChirp(params.Body, author)
+	if err != nil {
+		respondWithChirpError(w, err)
+		return
+	}
 
-func validateChirp(body string) (string, error) {
-	const maxChirpLength = 140
-	if len(body) > maxChirpLength {
-		return "", errors.New("Chirp is too long")
+	if params.Draft || params.PublishAt != nil {
+		// Save the body as written: it is validated again when it is
+		// published, against the moderation rules of the day.
+		draft, err := cfg.DB.CreateChirpDraft(database.ChirpDraft{
+			AuthorID:   userID,
+			Body:       params.Body,
+			InReplyTo:  params.InReplyTo,
+			MediaIDs:   params.MediaIDs,
+			PublishAt:  derefTime(params.PublishAt),
+			Visibility: params.Visibility,
+		})
+		if err != nil {
+			respondWithChirpStoreError(w, err, "Couldn't create draft")
+			return
+		}
+		respondWithJSON(w, http.StatusCreated, draftFromDB(draft))
+		return
 	}
 
-	badWords := map[string]struct{}{
-		"kerfuffle": {},
-		"sharbert":  {},
-		"fornax":    {},
+	chirp, err := cfg.DB.CreateChirp(database.Chirp{
+		AuthorID:   userID,
+		Body:       cleaned,
+		InReplyTo:  params.InReplyTo,
+		MediaIDs:   params.MediaIDs,
+		Visibility: params.Visibility,
+	})
+	if err != nil {
+		respondWithChirpStoreError(w, err, "Couldn't create chirp")
+		return
 	}
-	cleaned := getCleanedBody(body, badWords)
-	return cleaned, nil
+
+	respondWithJSON(w, http.StatusCreated, chirpFromDB(chirp))
 }
 
-func getCleanedBody(body string, badWords map[string]struct{}) string {
-	words := strings.Split(body, " ")
-	for i, word := range words {
-		loweredWord := strings.ToLower(word)
-		if _, ok := badWords[loweredWord]; ok {
-			words[i] = "****"
-		}
+// respondWithChirpStoreError reports a failure to store a chirp or draft,
+// telling the client which of the things it refers to are missing.
+func respondWithChirpStoreError(w http.ResponseWriter, err error, msg string) {
+	switch {
+	case errors.Is(err, database.ErrParentNotExist):
+		respondWithError(w, http.StatusBadRequest, "Couldn't find the chirp being replied to")
+	case errors.Is(err, database.ErrMediaNotExist):
+		respondWithError(w, http.StatusBadRequest, "Couldn't find media")
+	case errors.Is(err, database.ErrBlocked):
+		respondWithError(w, http.StatusForbidden, "You can't reply to this chirp")
+	case errors.Is(err, database.ErrInvalidVisibility):
+		respondWithError(w, http.StatusBadRequest, "Visibility must be public, followers, unlisted or private")
+	default:
+		respondWithError(w, http.StatusInternalServerError, msg)
 	}
-	cleaned := strings.Join(words, " ")
-	return cleaned
 }
@@ -1,10 +1,11 @@
 package main
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 
-	"github.com/brookwarren/chirpy/internal/auth"
+	"github.com/brookwarren/chirpy/internal/database"
 )
 
 func (cfg *apiConfig) handlerChirpsDelete(w http.ResponseWriter, r *http.Request) {
@@ -15,19 +16,8 @@ func (cfg *apiConfig) handlerChirpsDelete(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	token, err := auth.GetBearerToken(r.Header)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT")
-		return
-	}
-	subject, err := auth.ValidateJWT(token, cfg.jwtSecret)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT")
-		return
-	}
-	userID, err := strconv.Atoi(subject)
-	if err != nil {
-		respondWithError(w, http.StatusBadRequest, "Couldn't parse user ID")
+	s, ok := cfg.requireSession(w, r)
+	if !ok {
 		return
 	}
 
@@ -36,16 +26,38 @@ func (cfg *apiConfig) handlerChirpsDelete(w http.ResponseWriter, r *http.Request
 		respondWithError(w, http.StatusNotFound, "Couldn't get chirp")
 		return
 	}
-	if dbChirp.AuthorID != userID {
+
+	// Moderators may delete the chirps of users with a lower role than
+	// theirs, optionally saying why, which goes in the moderation log.
+	if dbChirp.AuthorID == s.UserID {
+		err = cfg.DB.DeleteChirp(chirpID)
+	} else if s.Role.Includes(database.RoleModerator) {
+		reason, ok := decodeModerationReason(w, r, false)
+		if !ok {
+			return
+		}
+		err = cfg.DB.DeleteChirpAsModerator(chirpID, s.UserID, reason)
+	} else {
 		respondWithError(w, http.StatusForbidden, "You can't delete this chirp")
 		return
 	}
-
-	err = cfg.DB.DeleteChirp(chirpID)
+	if errors.Is(err, database.ErrOutranked) {
+		respondWithError(w, http.StatusForbidden, "You can't delete this chirp")
+		return
+	}
+	if errors.Is(err, database.ErrNotExist) {
+		respondWithError(w, http.StatusNotFound, "Couldn't get chirp")
+		return
+	}
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't delete chirp")
 		return
 	}
+	err = cfg.collectMedia(dbChirp.MediaIDs)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't delete media")
+		return
+	}
 
 	respondWithJSON(w, http.StatusOK, struct{}{})
 }
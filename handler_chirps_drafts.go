@@ -0,0 +1,232 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/brookwarren/chirpy/internal/database"
+)
+
+type ChirpDraft struct {
+	ID        int    `json:"id"`
+	AuthorID  int    `json:"author_id"`
+	Body      string `json:"body"`
+	InReplyTo int    `json:"in_reply_to,omitempty"`
+	MediaIDs  []int  `json:"media_ids"`
+	// Status is "draft", or "scheduled" for a draft with a PublishAt time.
+	Status    string     `json:"status"`
+	PublishAt *time.Time `json:"publish_at,omitempty"`
+	// Error says why a scheduled chirp couldn't be published.
+	Error      string              `json:"error,omitempty"`
+	CreatedAt  time.Time           `json:"created_at"`
+	UpdatedAt  time.Time           `json:"updated_at"`
+	Visibility database.Visibility `json:"visibility"`
+}
+
+func draftFromDB(draft database.ChirpDraft) ChirpDraft {
+	response := ChirpDraft{
+		ID:         draft.ID,
+		AuthorID:   draft.AuthorID,
+		Body:       draft.Body,
+		InReplyTo:  draft.InReplyTo,
+		MediaIDs:   append([]int{}, draft.MediaIDs...),
+		Status:     "draft",
+		Error:      draft.Error,
+		CreatedAt:  draft.CreatedAt,
+		UpdatedAt:  draft.UpdatedAt,
+		Visibility: draft.Visibility,
+	}
+	if draft.Scheduled() {
+		publishAt := draft.PublishAt
+		response.Status = "scheduled"
+		response.PublishAt = &publishAt
+	}
+	return response
+}
+
+// checkPublishAt checks the time a chirp was asked to be scheduled for,
+// returning an error with a message for the client.
+func checkPublishAt(publishAt *time.Time) error {
+	if publishAt != nil && !publishAt.After(time.Now()) {
+		return errors.New("publish_at must be in the future")
+	}
+	return nil
+}
+
+func derefTime(t *time.Time) time.Time {
+	if t == nil {
+		return time.Time{}
+	}
+	return *t
+}
+
+// handlerChirpDraftsList lists the caller's drafts and scheduled chirps.
+func (cfg *apiConfig) handlerChirpDraftsList(w http.ResponseWriter, r *http.Request) {
+	userID, ok := cfg.requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	drafts, err := cfg.DB.GetChirpDrafts(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get drafts")
+		return
+	}
+
+	response := make([]ChirpDraft, 0, len(drafts))
+	for _, draft := range drafts {
+		response = append(response, draftFromDB(draft))
+	}
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+// handlerChirpDraftsUpdate replaces a draft. Leaving out publish_at leaves
+// it unscheduled, and leaving out visibility makes it public.
+func (cfg *apiConfig) handlerChirpDraftsUpdate(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Body       string              `json:"body"`
+		InReplyTo  int                 `json:"in_reply_to"`
+		MediaIDs   []int               `json:"media_ids"`
+		PublishAt  *time.Time          `json:"publish_at"`
+		Visibility database.Visibility `json:"visibility"`
+	}
+
+	userID, ok := cfg.requireUser(w, r)
+	if !ok {
+		return
+	}
+	draft, ok := cfg.draftFromPath(w, r, userID)
+	if !ok {
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't decode parameters")
+		return
+	}
+	err = checkMediaIDs(params.MediaIDs)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	err = checkPublishAt(params.PublishAt)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	author, err := cfg.DB.GetUser(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get user")
+		return
+	}
+	_, err = cfg.validateChirp(params.Body, author)
+	if err != nil {
+		respondWithChirpError(w, err)
+		return
+	}
+
+	updated, err := cfg.DB.UpdateChirpDraft(database.ChirpDraft{
+		ID:         draft.ID,
+		Body:       params.Body,
+		InReplyTo:  params.InReplyTo,
+		MediaIDs:   params.MediaIDs,
+		PublishAt:  derefTime(params.PublishAt),
+		Visibility: params.Visibility,
+	})
+	if errors.Is(err, database.ErrNotExist) {
+		respondWithError(w, http.StatusNotFound, "Couldn't get draft")
+		return
+	}
+	if err != nil {
+		respondWithChirpStoreError(w, err, "Couldn't update draft")
+		return
+	}
+	err = cfg.collectMedia(draft.MediaIDs)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't delete media")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, draftFromDB(updated))
+}
+
+func (cfg *apiConfig) handlerChirpDraftsDelete(w http.ResponseWriter, r *http.Request) {
+	userID, ok := cfg.requireUser(w, r)
+	if !ok {
+		return
+	}
+	draft, ok := cfg.draftFromPath(w, r, userID)
+	if !ok {
+		return
+	}
+
+	err := cfg.DB.DeleteChirpDraft(draft.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't delete draft")
+		return
+	}
+	err = cfg.collectMedia(draft.MediaIDs)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't delete media")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, struct{}{})
+}
+
+// handlerChirpDraftsPublish publishes a draft straight away.
+func (cfg *apiConfig) handlerChirpDraftsPublish(w http.ResponseWriter, r *http.Request) {
+	userID, ok := cfg.requireUser(w, r)
+	if !ok {
+		return
+	}
+	draft, ok := cfg.draftFromPath(w, r, userID)
+	if !ok {
+		return
+	}
+
+	chirp, err := cfg.publishDraft(draft)
+	var tooLong chirpTooLongError
+	var rejected chirpRejectedError
+	if errors.As(err, &tooLong) || errors.As(err, &rejected) {
+		respondWithChirpError(w, err)
+		return
+	}
+	if errors.Is(err, errAuthorSuspended) {
+		respondWithError(w, http.StatusForbidden, "Account is suspended")
+		return
+	}
+	if errors.Is(err, database.ErrNotExist) {
+		respondWithError(w, http.StatusNotFound, "Couldn't get draft")
+		return
+	}
+	if err != nil {
+		respondWithChirpStoreError(w, err, "Couldn't publish draft")
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, chirpFromDB(chirp))
+}
+
+// draftFromPath gets the draft named in the path. Drafts are private, so
+// someone else's draft is reported as not found.
+func (cfg *apiConfig) draftFromPath(w http.ResponseWriter, r *http.Request, userID int) (database.ChirpDraft, bool) {
+	draftID, err := strconv.Atoi(r.PathValue("draftID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid draft ID")
+		return database.ChirpDraft{}, false
+	}
+	draft, err := cfg.DB.GetChirpDraft(draftID)
+	if err != nil || draft.AuthorID != userID {
+		respondWithError(w, http.StatusNotFound, "Couldn't get draft")
+		return database.ChirpDraft{}, false
+	}
+	return draft, true
+}
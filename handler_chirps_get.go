@@ -1,9 +1,15 @@
 package main
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
-	"sort"
+	"net/url"
 	"strconv"
+	"strings"
+	"time"
+
+	"github.com/brookwarren/chirpy/internal/database"
 )
 
 func (cfg *apiConfig) handlerChirpsGet(w http.ResponseWriter, r *http.Request) {
@@ -13,62 +19,191 @@ func (cfg *apiConfig) handlerChirpsGet(w http.ResponseWriter, r *http.Request) {
 		respondWithError(w, http.StatusBadRequest, "Invalid chirp ID")
 		return
 	}
+	viewerID, ok := cfg.optionalUser(w, r)
+	if !ok {
+		return
+	}
 
-	dbChirp, err := cfg.DB.GetChirp(chirpID)
+	dbChirp, ok := cfg.visibleChirp(w, chirpID, viewerID)
+	if !ok {
+		return
+	}
+
+	chirp, err := cfg.chirpForViewer(dbChirp, viewerID)
 	if err != nil {
-		respondWithError(w, http.StatusNotFound, "Couldn't get chirp")
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get chirp stats")
 		return
 	}
 
-	respondWithJSON(w, http.StatusOK, Chirp{
-		ID:       dbChirp.ID,
-		AuthorID: dbChirp.AuthorID,
-		Body:     dbChirp.Body,
-	})
+	respondWithJSON(w, http.StatusOK, chirp)
 }
 
 func (cfg *apiConfig) handlerChirpsRetrieve(w http.ResponseWriter, r *http.Request) {
-	dbChirps, err := cfg.DB.GetChirps()
+	viewerID, ok := cfg.optionalUser(w, r)
+	if !ok {
+		return
+	}
+
+	q, order, err := parseChirpQuery(r.URL.Query())
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve chirps")
+		respondWithError(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	authorID := -1
-	authorIDString := r.URL.Query().Get("author_id")
-	if authorIDString != "" {
-		authorID, err = strconv.Atoi(authorIDString)
+	cfg.respondWithChirpPage(w, r, q, order, viewerID)
+}
+
+// parseChirpQuery reads the filters, sort order and page that a listing of
+// chirps was asked for. The error is a message for the client. order
+// identifies the sort order for pagination cursors.
+func parseChirpQuery(query url.Values) (q database.ChirpQuery, order string, err error) {
+	q = database.ChirpQuery{
+		SortBy:          database.ChirpSortID,
+		IncludeRechirps: true,
+	}
+
+	authorIDs, err := parseAuthorIDs(query)
+	if err != nil {
+		return q, "", errors.New("Invalid author ID")
+	}
+	q.AuthorIDs = authorIDs
+
+	for param, t := range map[string]*time.Time{"since": &q.Since, "until": &q.Until} {
+		value := query.Get(param)
+		if value == "" {
+			continue
+		}
+		parsed, err := time.Parse(time.RFC3339, value)
 		if err != nil {
-			respondWithError(w, http.StatusBadRequest, "Invalid author ID")
-			return
+			return q, "", errors.New("Invalid " + param + " time")
 		}
+		*t = parsed
 	}
 
+	switch query.Get("sort_by") {
+	case "", "id":
+	case "created_at":
+		q.SortBy = database.ChirpSortCreatedAt
+	default:
+		return q, "", errors.New("Invalid sort_by")
+	}
 	sortDirection := "asc"
-	sortDirectionParam := r.URL.Query().Get("sort")
-	if sortDirectionParam == "desc" {
+	if query.Get("sort") == "desc" {
 		sortDirection = "desc"
+		q.Descending = true
 	}
 
-	chirps := []Chirp{}
-	for _, dbChirp := range dbChirps {
-		if authorID != -1 && dbChirp.AuthorID != authorID {
-			continue
+	limitString := query.Get("limit")
+	if limitString != "" {
+		limit, err := strconv.Atoi(limitString)
+		if err != nil || limit < 1 || limit > maxPageLimit {
+			return q, "", fmt.Errorf("Limit must be between 1 and %d", maxPageLimit)
 		}
+		q.Limit = limit
+	}
 
-		chirps = append(chirps, Chirp{
-			ID:       dbChirp.ID,
-			AuthorID: dbChirp.AuthorID,
-			Body:     dbChirp.Body,
-		})
+	order = string(q.SortBy) + ":" + sortDirection
+	err = applyCursor(&q, order, query.Get("cursor"))
+	if err != nil {
+		return q, "", errors.New("Invalid cursor")
+	}
+	return q, order, nil
+}
+
+// respondWithChirpPage runs q and responds with the page of chirps it
+// selects, linking to the pages either side.
+func (cfg *apiConfig) respondWithChirpPage(w http.ResponseWriter, r *http.Request, q database.ChirpQuery, order string, viewerID int) {
+	q.ViewerID = viewerID
+	page, err := cfg.DB.QueryChirps(q)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve chirps")
+		return
 	}
 
-	sort.Slice(chirps, func(i, j int) bool {
-		if sortDirection == "desc" {
-			return chirps[i].ID > chirps[j].ID
-		}
-		return chirps[i].ID < chirps[j].ID
-	})
+	chirps, err := cfg.chirpsForViewer(page.Chirps, page.Rechirps, viewerID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get chirp stats")
+		return
+	}
 
+	setPageLinks(w, r, order, page)
 	respondWithJSON(w, http.StatusOK, chirps)
 }
+
+// parseAuthorIDs reads author_id, which may be repeated or comma-separated.
+func parseAuthorIDs(query url.Values) ([]int, error) {
+	authorIDs := []int{}
+	for _, authorIDParam := range query["author_id"] {
+		for _, authorIDString := range strings.Split(authorIDParam, ",") {
+			authorID, err := strconv.Atoi(authorIDString)
+			if err != nil {
+				return nil, err
+			}
+			authorIDs = append(authorIDs, authorID)
+		}
+	}
+	return authorIDs, nil
+}
+
+func (cfg *apiConfig) handlerChirpsHistory(w http.ResponseWriter, r *http.Request) {
+	type revision struct {
+		Version   int       `json:"version"`
+		Body      string    `json:"body"`
+		CreatedAt time.Time `json:"created_at"`
+	}
+
+	chirpIDString := r.PathValue("chirpID")
+	chirpID, err := strconv.Atoi(chirpIDString)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid chirp ID")
+		return
+	}
+	viewerID, ok := cfg.optionalUser(w, r)
+	if !ok {
+		return
+	}
+	_, ok = cfg.visibleChirp(w, chirpID, viewerID)
+	if !ok {
+		return
+	}
+
+	dbRevisions, err := cfg.DB.GetChirpHistory(chirpID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't get chirp history")
+		return
+	}
+
+	revisions := []revision{}
+	for _, dbRevision := range dbRevisions {
+		revisions = append(revisions, revision{
+			Version:   dbRevision.Version,
+			Body:      dbRevision.Body,
+			CreatedAt: dbRevision.CreatedAt,
+		})
+	}
+
+	respondWithJSON(w, http.StatusOK, revisions)
+}
+
+// visibleChirp gets a chirp that viewerID, who is 0 when anonymous, may see:
+// its visibility lets them and they and its author haven't blocked each
+// other. A chirp they may not see is reported as not found, like one that
+// doesn't exist. Listings leave the same chirps out through
+// ChirpQuery.ViewerID.
+func (cfg *apiConfig) visibleChirp(w http.ResponseWriter, chirpID, viewerID int) (database.Chirp, bool) {
+	dbChirp, err := cfg.DB.GetChirp(chirpID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't get chirp")
+		return database.Chirp{}, false
+	}
+	visible, err := cfg.DB.CanViewChirp(dbChirp, viewerID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get chirp")
+		return database.Chirp{}, false
+	}
+	if !visible {
+		respondWithError(w, http.StatusNotFound, "Couldn't get chirp")
+		return database.Chirp{}, false
+	}
+	return dbChirp, true
+}
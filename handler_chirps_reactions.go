@@ -0,0 +1,76 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/brookwarren/chirpy/internal/database"
+)
+
+func (cfg *apiConfig) handlerChirpsLike(w http.ResponseWriter, r *http.Request) {
+	cfg.reactToChirp(w, r, database.ReactionLike, true)
+}
+
+func (cfg *apiConfig) handlerChirpsUnlike(w http.ResponseWriter, r *http.Request) {
+	cfg.reactToChirp(w, r, database.ReactionLike, false)
+}
+
+func (cfg *apiConfig) handlerChirpsRechirp(w http.ResponseWriter, r *http.Request) {
+	cfg.reactToChirp(w, r, database.ReactionRechirp, true)
+}
+
+func (cfg *apiConfig) handlerChirpsUnrechirp(w http.ResponseWriter, r *http.Request) {
+	cfg.reactToChirp(w, r, database.ReactionRechirp, false)
+}
+
+// reactToChirp adds or removes the caller's reaction to a chirp and responds
+// with the chirp's updated counts.
+func (cfg *apiConfig) reactToChirp(w http.ResponseWriter, r *http.Request, kind database.ReactionKind, add bool) {
+	chirpIDString := r.PathValue("chirpID")
+	chirpID, err := strconv.Atoi(chirpIDString)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid chirp ID")
+		return
+	}
+	userID, ok := cfg.requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	dbChirp, ok := cfg.visibleChirp(w, chirpID, userID)
+	if !ok {
+		return
+	}
+	if dbChirp.AuthorID == userID {
+		respondWithError(w, http.StatusForbidden, "You can't "+string(kind)+" your own chirp")
+		return
+	}
+	// Rechirping a followers-only chirp would show it to the rechirper's
+	// followers too. Private chirps are only ever seen by their authors.
+	if add && kind == database.ReactionRechirp && dbChirp.Visibility == database.VisibilityFollowers {
+		respondWithError(w, http.StatusForbidden, "You can't rechirp a followers-only chirp")
+		return
+	}
+
+	if add {
+		_, err = cfg.DB.AddReaction(kind, chirpID, userID)
+	} else {
+		err = cfg.DB.RemoveReaction(kind, chirpID, userID)
+	}
+	if errors.Is(err, database.ErrNotExist) {
+		respondWithError(w, http.StatusNotFound, "Couldn't get chirp")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update "+string(kind))
+		return
+	}
+
+	chirp, err := cfg.chirpForViewer(dbChirp, userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get chirp stats")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, chirp)
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/brookwarren/chirpy/internal/database"
+	"github.com/brookwarren/chirpy/internal/search"
+)
+
+const defaultSearchLimit = 20
+
+func (cfg *apiConfig) handlerChirpsSearch(w http.ResponseWriter, r *http.Request) {
+	viewerID, ok := cfg.optionalUser(w, r)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	s := database.ChirpSearch{
+		Query:     query.Get("q"),
+		SortBy:    database.ChirpSortRelevance,
+		Limit:     defaultSearchLimit,
+		ViewerID:  viewerID,
+		HideMuted: true,
+	}
+
+	authorIDs, err := parseAuthorIDs(query)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid author ID")
+		return
+	}
+	s.AuthorIDs = authorIDs
+
+	switch query.Get("sort") {
+	case "":
+	case "asc":
+		s.SortBy = database.ChirpSortID
+	case "desc":
+		s.SortBy = database.ChirpSortID
+		s.Descending = true
+	default:
+		respondWithError(w, http.StatusBadRequest, "Invalid sort")
+		return
+	}
+
+	limitString := query.Get("limit")
+	if limitString != "" {
+		limit, err := strconv.Atoi(limitString)
+		if err != nil || limit < 1 || limit > maxPageLimit {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Limit must be between 1 and %d", maxPageLimit))
+			return
+		}
+		s.Limit = limit
+	}
+
+	dbChirps, err := cfg.DB.SearchChirps(s)
+	if err != nil {
+		if errors.Is(err, search.ErrEmptyQuery) {
+			respondWithError(w, http.StatusBadRequest, "Missing search query")
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "Couldn't search chirps")
+		return
+	}
+
+	chirps, err := cfg.chirpsForViewer(dbChirps, nil, viewerID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get chirp stats")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, chirps)
+}
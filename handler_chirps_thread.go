@@ -0,0 +1,169 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/brookwarren/chirpy/internal/database"
+)
+
+const (
+	defaultThreadDepth = 10
+	maxThreadDepth     = 50
+)
+
+// ThreadNode is one chirp of a conversation. A deleted chirp that still has
+// replies is kept as a placeholder with Deleted set and no Chirp, and so is a
+// chirp the viewer may not see, with Hidden set. ReplyCount
+// is the number of direct replies, which is more than len(Replies) where the
+// depth limit cut the tree off.
+type ThreadNode struct {
+	ID         int          `json:"id"`
+	Deleted    bool         `json:"deleted,omitempty"`
+	Hidden     bool         `json:"hidden,omitempty"`
+	Chirp      *Chirp       `json:"chirp,omitempty"`
+	ReplyCount int          `json:"reply_count"`
+	Replies    []ThreadNode `json:"replies"`
+}
+
+// handlerChirpsThread returns the whole conversation a chirp belongs to as a
+// tree, starting from its root. Replies are expanded depth levels below the
+// root and below the requested chirp, and always along the path between them.
+func (cfg *apiConfig) handlerChirpsThread(w http.ResponseWriter, r *http.Request) {
+	chirpIDString := r.PathValue("chirpID")
+	chirpID, err := strconv.Atoi(chirpIDString)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid chirp ID")
+		return
+	}
+
+	depth := defaultThreadDepth
+	depthString := r.URL.Query().Get("depth")
+	if depthString != "" {
+		depth, err = strconv.Atoi(depthString)
+		if err != nil || depth < 0 || depth > maxThreadDepth {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Depth must be between 0 and %d", maxThreadDepth))
+			return
+		}
+	}
+
+	viewerID, ok := cfg.optionalUser(w, r)
+	if !ok {
+		return
+	}
+
+	entries, err := cfg.DB.GetThread(chirpID)
+	if errors.Is(err, database.ErrNotExist) {
+		respondWithError(w, http.StatusNotFound, "Couldn't get chirp")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get thread")
+		return
+	}
+
+	dbChirps := []database.Chirp{}
+	for _, entry := range entries {
+		if entry.Chirp == nil {
+			continue
+		}
+		visible, err := cfg.DB.CanViewChirp(*entry.Chirp, viewerID)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't get thread")
+			return
+		}
+		if !visible {
+			if entry.ID == chirpID {
+				respondWithError(w, http.StatusNotFound, "Couldn't get chirp")
+				return
+			}
+			continue
+		}
+		dbChirps = append(dbChirps, *entry.Chirp)
+	}
+	chirps, err := cfg.chirpsForViewer(dbChirps, nil, viewerID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get chirp stats")
+		return
+	}
+	chirpsByID := map[int]Chirp{}
+	for _, chirp := range chirps {
+		chirpsByID[chirp.ID] = chirp
+	}
+
+	root, ok := buildThread(entries, chirpsByID, chirpID, depth)
+	if !ok {
+		respondWithError(w, http.StatusNotFound, "Couldn't get chirp")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, root)
+}
+
+// buildThread turns the entries of a conversation, ordered by ID, into a tree
+// of the chirps in chirps. Entries missing from chirps are hidden from the
+// viewer. Deleted chirps with nothing but deleted chirps
+// below them are left out.
+func buildThread(entries []database.ThreadEntry, chirps map[int]Chirp, focusID, depth int) (ThreadNode, bool) {
+	byID := map[int]database.ThreadEntry{}
+	children := map[int][]int{}
+	for _, entry := range entries {
+		byID[entry.ID] = entry
+		children[entry.InReplyTo] = append(children[entry.InReplyTo], entry.ID)
+	}
+
+	// Replies have higher IDs than their parents, so walking backwards sees
+	// every reply before the chirp it replies to.
+	kept := map[int]bool{}
+	for i := len(entries) - 1; i >= 0; i-- {
+		entry := entries[i]
+		if entry.Chirp != nil || kept[entry.ID] {
+			kept[entry.ID] = true
+			kept[entry.InReplyTo] = true
+		}
+	}
+
+	onPath := map[int]bool{}
+	for id := focusID; ; {
+		entry, ok := byID[id]
+		if !ok || onPath[id] {
+			break
+		}
+		onPath[id] = true
+		id = entry.InReplyTo
+	}
+
+	var build func(id, remaining int) ThreadNode
+	build = func(id, remaining int) ThreadNode {
+		if onPath[id] {
+			remaining = depth
+		}
+		entry := byID[id]
+		node := ThreadNode{
+			ID:      id,
+			Deleted: entry.Chirp == nil,
+			Replies: []ThreadNode{},
+		}
+		if chirp, ok := chirps[id]; ok {
+			node.Chirp = &chirp
+		} else {
+			node.Hidden = !node.Deleted
+		}
+		for _, replyID := range children[id] {
+			if !kept[replyID] {
+				continue
+			}
+			node.ReplyCount++
+			if remaining > 0 || onPath[replyID] {
+				node.Replies = append(node.Replies, build(replyID, remaining-1))
+			}
+		}
+		return node
+	}
+
+	if len(entries) == 0 || !kept[entries[0].ID] {
+		return ThreadNode{}, false
+	}
+	return build(entries[0].ID, depth), true
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/brookwarren/chirpy/internal/database"
+)
+
+const (
+	// maxConversationMembers caps group conversations, creator included.
+	maxConversationMembers = 10
+	defaultMessagesLimit   = 50
+	messagesOrder          = "id:desc"
+)
+
+type Conversation struct {
+	ID        int       `json:"id"`
+	CreatorID int       `json:"creator_id"`
+	MemberIDs []int     `json:"member_ids"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type Message struct {
+	ID             int       `json:"id"`
+	ConversationID int       `json:"conversation_id"`
+	SenderID       int       `json:"sender_id"`
+	Body           string    `json:"body"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+func conversationFromDB(conversation database.Conversation) Conversation {
+	return Conversation{
+		ID:        conversation.ID,
+		CreatorID: conversation.CreatorID,
+		MemberIDs: conversation.MemberIDs,
+		CreatedAt: conversation.CreatedAt,
+		UpdatedAt: conversation.UpdatedAt,
+	}
+}
+
+func messageFromDB(message database.Message) Message {
+	return Message{
+		ID:             message.ID,
+		ConversationID: message.ConversationID,
+		SenderID:       message.SenderID,
+		Body:           message.Body,
+		CreatedAt:      message.CreatedAt,
+	}
+}
+
+// handlerConversationsCreate opens a conversation between the caller and
+// member_ids. Opening a 1:1 conversation that already exists returns it
+// with 200 instead of 201.
+func (cfg *apiConfig) handlerConversationsCreate(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		MemberIDs []int `json:"member_ids"`
+	}
+
+	userID, ok := cfg.requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't decode parameters")
+		return
+	}
+
+	others := map[int]struct{}{}
+	for _, id := range params.MemberIDs {
+		if id != userID {
+			others[id] = struct{}{}
+		}
+	}
+	if len(others) == 0 {
+		respondWithError(w, http.StatusBadRequest, "A conversation needs at least one other member")
+		return
+	}
+	if len(others)+1 > maxConversationMembers {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("A conversation can have at most %d members", maxConversationMembers))
+		return
+	}
+
+	conversation, created, err := cfg.DB.CreateConversation(userID, params.MemberIDs)
+	if errors.Is(err, database.ErrNotExist) {
+		respondWithError(w, http.StatusNotFound, "Couldn't get user")
+		return
+	}
+	if errors.Is(err, database.ErrBlocked) {
+		respondWithError(w, http.StatusForbidden, "You can't message this user")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create conversation")
+		return
+	}
+
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+	respondWithJSON(w, status, conversationFromDB(conversation))
+}
+
+// handlerConversationsList lists the caller's conversations, the one with
+// the latest message first.
+func (cfg *apiConfig) handlerConversationsList(w http.ResponseWriter, r *http.Request) {
+	userID, ok := cfg.requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	dbConversations, err := cfg.DB.GetConversations(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't list conversations")
+		return
+	}
+
+	conversations := []Conversation{}
+	for _, dbConversation := range dbConversations {
+		conversations = append(conversations, conversationFromDB(dbConversation))
+	}
+	respondWithJSON(w, http.StatusOK, conversations)
+}
+
+func (cfg *apiConfig) handlerConversationsGet(w http.ResponseWriter, r *http.Request) {
+	conversation, _, ok := cfg.memberConversation(w, r)
+	if !ok {
+		return
+	}
+	respondWithJSON(w, http.StatusOK, conversationFromDB(conversation))
+}
+
+// handlerMessagesCreate sends a message to a conversation. Messages are held
+// to the same length limit and moderation rules as chirps.
+func (cfg *apiConfig) handlerMessagesCreate(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Body string `json:"body"`
+	}
+
+	conversation, userID, ok := cfg.memberConversation(w, r)
+	if !ok {
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't decode parameters")
+		return
+	}
+
+	sender, err := cfg.DB.GetUser(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get user")
+		return
+	}
+	cleaned, err := cfg.validateChirp(params.Body, sender)
+	if err != nil {
+		respondWithChirpError(w, err)
+		return
+	}
+
+	message, err := cfg.DB.CreateMessage(conversation.ID, userID, cleaned)
+	if errors.Is(err, database.ErrBlocked) {
+		respondWithError(w, http.StatusForbidden, "You can't message this user")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't send message")
+		return
+	}
+	respondWithJSON(w, http.StatusCreated, messageFromDB(message))
+}
+
+// handlerMessagesList serves a conversation's messages, newest first. Older
+// messages are linked from the Link header.
+func (cfg *apiConfig) handlerMessagesList(w http.ResponseWriter, r *http.Request) {
+	conversation, _, ok := cfg.memberConversation(w, r)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	q := database.MessageQuery{
+		ConversationID: conversation.ID,
+		Limit:          defaultMessagesLimit,
+	}
+
+	limitString := query.Get("limit")
+	if limitString != "" {
+		limit, err := strconv.Atoi(limitString)
+		if err != nil || limit < 1 || limit > maxPageLimit {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Limit must be between 1 and %d", maxPageLimit))
+			return
+		}
+		q.Limit = limit
+	}
+
+	cursor := query.Get("cursor")
+	if cursor != "" {
+		decoded, err := decodeCursor(messagesOrder, cursor)
+		if err != nil || decoded.Backward {
+			respondWithError(w, http.StatusBadRequest, "Invalid cursor")
+			return
+		}
+		q.BeforeID = decoded.ID
+	}
+
+	page, err := cfg.DB.GetMessages(q)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve messages")
+		return
+	}
+
+	messages := []Message{}
+	for _, message := range page.Messages {
+		messages = append(messages, messageFromDB(message))
+	}
+	if page.HasNext {
+		last := page.Messages[len(page.Messages)-1]
+		next := encodeCursor(messagesOrder, false, last.CreatedAt, last.ID)
+		w.Header().Set("Link", pageLink(r, "next", next))
+	}
+	respondWithJSON(w, http.StatusOK, messages)
+}
+
+// memberConversation gets the conversation in the path and checks the
+// caller, whose ID it returns, is one of its members.
+func (cfg *apiConfig) memberConversation(w http.ResponseWriter, r *http.Request) (database.Conversation, int, bool) {
+	conversationID, err := strconv.Atoi(r.PathValue("conversationID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid conversation ID")
+		return database.Conversation{}, 0, false
+	}
+
+	userID, ok := cfg.requireUser(w, r)
+	if !ok {
+		return database.Conversation{}, 0, false
+	}
+
+	conversation, err := cfg.DB.GetConversation(conversationID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't get conversation")
+		return database.Conversation{}, 0, false
+	}
+	if !conversation.HasMember(userID) {
+		respondWithError(w, http.StatusForbidden, "You aren't a member of this conversation")
+		return database.Conversation{}, 0, false
+	}
+	return conversation, userID, true
+}
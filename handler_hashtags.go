@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/brookwarren/chirpy/internal/entities"
+)
+
+const (
+	defaultTrendingWindow = 24 * time.Hour
+	maxTrendingWindow     = 7 * 24 * time.Hour
+	defaultTrendingLimit  = 10
+	// A use of a hashtag counts for half as much after this fraction of the
+	// window has passed.
+	trendingHalfLifeFraction = 4
+)
+
+func (cfg *apiConfig) handlerHashtagChirps(w http.ResponseWriter, r *http.Request) {
+	viewerID, ok := cfg.optionalUser(w, r)
+	if !ok {
+		return
+	}
+
+	tag := entities.NormalizeHashtag(strings.TrimPrefix(r.PathValue("tag"), "#"))
+	if tag == "" {
+		respondWithError(w, http.StatusBadRequest, "Invalid hashtag")
+		return
+	}
+
+	q, order, err := parseChirpQuery(r.URL.Query())
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	q.Hashtag = tag
+
+	cfg.respondWithChirpPage(w, r, q, order, viewerID)
+}
+
+// handlerTrending ranks the hashtags used within a sliding window, by default
+// the last day, with recent uses counting for more than older ones.
+func (cfg *apiConfig) handlerTrending(w http.ResponseWriter, r *http.Request) {
+	type trendingHashtag struct {
+		Tag   string  `json:"tag"`
+		Uses  int     `json:"uses"`
+		Score float64 `json:"score"`
+	}
+
+	query := r.URL.Query()
+	window := defaultTrendingWindow
+	windowString := query.Get("window")
+	if windowString != "" {
+		parsed, err := time.ParseDuration(windowString)
+		if err != nil || parsed <= 0 || parsed > maxTrendingWindow {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Window must be a duration up to %s", maxTrendingWindow))
+			return
+		}
+		window = parsed
+	}
+
+	limit := defaultTrendingLimit
+	limitString := query.Get("limit")
+	if limitString != "" {
+		parsed, err := strconv.Atoi(limitString)
+		if err != nil || parsed < 1 || parsed > maxPageLimit {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Limit must be between 1 and %d", maxPageLimit))
+			return
+		}
+		limit = parsed
+	}
+
+	dbTrending, err := cfg.DB.TrendingHashtags(window, window/trendingHalfLifeFraction, limit)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get trending hashtags")
+		return
+	}
+
+	trending := []trendingHashtag{}
+	for _, hashtag := range dbTrending {
+		trending = append(trending, trendingHashtag{
+			Tag:   hashtag.Tag,
+			Uses:  hashtag.Uses,
+			Score: hashtag.Score,
+		})
+	}
+	respondWithJSON(w, http.StatusOK, trending)
+}
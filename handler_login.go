@@ -3,7 +3,6 @@ package main
 import (
 	"encoding/json"
 	"net/http"
-	"time"
 
 	"github.com/brookwarren/chirpy/internal/auth"
 )
@@ -38,35 +37,19 @@ func (cfg *apiConfig) handlerLogin(w http.ResponseWriter, r *http.Request) {
 		respondWithError(w, http.StatusUnauthorized, "Invalid password")
 		return
 	}
-
-	accessToken, err := auth.MakeJWT(
-		user.ID,
-		cfg.jwtSecret,
-		time.Hour,
-		auth.TokenTypeAccess,
-	)
-	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Couldn't create access JWT")
+	if user.Suspended {
+		respondWithError(w, http.StatusForbidden, "Account is suspended")
 		return
 	}
 
-	refreshToken, err := auth.MakeJWT(
-		user.ID,
-		cfg.jwtSecret,
-		time.Hour*24*30*6,
-		auth.TokenTypeRefresh,
-	)
+	accessToken, refreshToken, err := cfg.makeTokens(user)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Couldn't create refresh JWT")
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create JWT")
 		return
 	}
 
 	respondWithJSON(w, http.StatusOK, response{
-		User: User{
-			ID:          user.ID,
-			Email:       user.Email,
-			IsChirpyRed: user.IsChirpyRed,
-		},
+		User:         userFromDB(user),
 		Token:        accessToken,
 		RefreshToken: refreshToken,
 	})
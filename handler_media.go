@@ -0,0 +1,258 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/brookwarren/chirpy/internal/database"
+	"github.com/brookwarren/chirpy/internal/media"
+)
+
+const (
+	// maxMediaSize is the largest image that can be uploaded.
+	maxMediaSize = 10 << 20
+	// maxChirpMedia is how many media a chirp can be attached to.
+	maxChirpMedia = 4
+)
+
+type Media struct {
+	ID           int       `json:"id"`
+	ContentType  string    `json:"content_type"`
+	Size         int       `json:"size"`
+	Width        int       `json:"width"`
+	Height       int       `json:"height"`
+	URL          string    `json:"url"`
+	ThumbnailURL string    `json:"thumbnail_url"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+func mediaFromDB(dbMedia database.Media) Media {
+	return Media{
+		ID:           dbMedia.ID,
+		ContentType:  dbMedia.ContentType,
+		Size:         dbMedia.Size,
+		Width:        dbMedia.Width,
+		Height:       dbMedia.Height,
+		URL:          fmt.Sprintf("/api/media/%d/original", dbMedia.ID),
+		ThumbnailURL: fmt.Sprintf("/api/media/%d/thumbnail", dbMedia.ID),
+		CreatedAt:    dbMedia.CreatedAt,
+	}
+}
+
+// handlerMediaUpload accepts an image as the "file" part of a multipart form.
+// Uploading an image the caller has already uploaded returns the existing
+// media.
+func (cfg *apiConfig) handlerMediaUpload(w http.ResponseWriter, r *http.Request) {
+	userID, ok := cfg.requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	// Leave room for the multipart framing around the file.
+	r.Body = http.MaxBytesReader(w, r.Body, maxMediaSize+64<<10)
+	data, err := readMultipartFile(r, "file")
+	if errors.Is(err, errMediaTooLarge) {
+		respondWithError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("Media can't be larger than %d MiB", maxMediaSize>>20))
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't read file")
+		return
+	}
+
+	img, err := media.Process(data)
+	if errors.Is(err, media.ErrUnsupportedType) {
+		respondWithError(w, http.StatusUnsupportedMediaType, "Media must be a PNG, JPEG or GIF image")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't process image")
+		return
+	}
+
+	// Hold mediaMu so a chirp being deleted can't collect these blobs
+	// between storing them and recording the media that refers to them.
+	cfg.mediaMu.Lock()
+	defer cfg.mediaMu.Unlock()
+
+	err = cfg.blobs.Put(media.OriginalKey(img.SHA256), img.Data)
+	if err == nil {
+		err = cfg.blobs.Put(media.ThumbnailKey(img.SHA256), img.Thumbnail)
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't store media")
+		return
+	}
+
+	dbMedia, created, err := cfg.DB.CreateMedia(database.Media{
+		UploaderID:           userID,
+		SHA256:               img.SHA256,
+		ContentType:          img.ContentType,
+		ThumbnailContentType: img.ThumbnailContentType,
+		Size:                 len(img.Data),
+		Width:                img.Width,
+		Height:               img.Height,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create media")
+		return
+	}
+
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+	respondWithJSON(w, status, mediaFromDB(dbMedia))
+}
+
+// checkMediaIDs checks the media a chirp is to be attached to, returning an
+// error with a message for the client.
+func checkMediaIDs(ids []int) error {
+	if len(ids) > maxChirpMedia {
+		return fmt.Errorf("A chirp can have at most %d media", maxChirpMedia)
+	}
+	seen := map[int]bool{}
+	for _, id := range ids {
+		if seen[id] {
+			return errors.New("Media can't be attached twice")
+		}
+		seen[id] = true
+	}
+	return nil
+}
+
+var errMediaTooLarge = errors.New("media too large")
+
+// readMultipartFile reads the named part of a multipart form, stopping once
+// it is more than maxMediaSize long rather than buffering it all.
+func readMultipartFile(r *http.Request, name string) ([]byte, error) {
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		part, err := reader.NextPart()
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			return nil, errMediaTooLarge
+		}
+		if err != nil {
+			return nil, err
+		}
+		if part.FormName() != name {
+			continue
+		}
+
+		data, err := io.ReadAll(io.LimitReader(part, maxMediaSize+1))
+		if errors.As(err, &maxBytesErr) || len(data) > maxMediaSize {
+			return nil, errMediaTooLarge
+		}
+		return data, err
+	}
+}
+
+func (cfg *apiConfig) handlerMediaGet(w http.ResponseWriter, r *http.Request) {
+	dbMedia, ok := cfg.mediaFromPath(w, r)
+	if !ok {
+		return
+	}
+	respondWithJSON(w, http.StatusOK, mediaFromDB(dbMedia))
+}
+
+func (cfg *apiConfig) handlerMediaOriginal(w http.ResponseWriter, r *http.Request) {
+	dbMedia, ok := cfg.mediaFromPath(w, r)
+	if !ok {
+		return
+	}
+	cfg.serveBlob(w, r, media.OriginalKey(dbMedia.SHA256), dbMedia.ContentType, dbMedia.CreatedAt)
+}
+
+func (cfg *apiConfig) handlerMediaThumbnail(w http.ResponseWriter, r *http.Request) {
+	dbMedia, ok := cfg.mediaFromPath(w, r)
+	if !ok {
+		return
+	}
+	cfg.serveBlob(w, r, media.ThumbnailKey(dbMedia.SHA256), dbMedia.ThumbnailContentType, dbMedia.CreatedAt)
+}
+
+// mediaFromPath looks up the media named in the path, responding with 404 if
+// the caller may not see it, so that media on chirps they can't see, or in
+// someone else's drafts, can't be found by trying IDs.
+func (cfg *apiConfig) mediaFromPath(w http.ResponseWriter, r *http.Request) (database.Media, bool) {
+	mediaID, err := strconv.Atoi(r.PathValue("mediaID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid media ID")
+		return database.Media{}, false
+	}
+	viewerID, ok := cfg.optionalUser(w, r)
+	if !ok {
+		return database.Media{}, false
+	}
+	dbMedia, err := cfg.DB.GetMedia(mediaID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't get media")
+		return database.Media{}, false
+	}
+	visible, err := cfg.DB.CanViewMedia(dbMedia, viewerID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get media")
+		return database.Media{}, false
+	}
+	if !visible {
+		respondWithError(w, http.StatusNotFound, "Couldn't get media")
+		return database.Media{}, false
+	}
+	return dbMedia, true
+}
+
+// serveBlob serves a stored image. A media ID always names the same bytes,
+// so clients may cache them for as long as they like, but only privately,
+// since who may see them depends on the caller.
+func (cfg *apiConfig) serveBlob(w http.ResponseWriter, r *http.Request, key, contentType string, modTime time.Time) {
+	blob, err := cfg.blobs.Get(key)
+	if errors.Is(err, media.ErrNotExist) {
+		respondWithError(w, http.StatusNotFound, "Couldn't get media")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't read media")
+		return
+	}
+	defer blob.Close()
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Cache-Control", "private, max-age=31536000, immutable")
+	http.ServeContent(w, r, "", modTime, blob)
+}
+
+// collectMedia deletes the media in ids that no chirp or draft refers to,
+// along with their blobs. Failing to delete a blob only leaks disk space, so
+// it is logged rather than reported to the client.
+func (cfg *apiConfig) collectMedia(ids []int) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	cfg.mediaMu.Lock()
+	defer cfg.mediaMu.Unlock()
+
+	deleted, err := cfg.DB.DeleteUnreferencedMedia(ids)
+	if err != nil {
+		return err
+	}
+	for _, dbMedia := range deleted {
+		for _, key := range []string{media.OriginalKey(dbMedia.SHA256), media.ThumbnailKey(dbMedia.SHA256)} {
+			err := cfg.blobs.Delete(key)
+			if err != nil {
+				log.Printf("Couldn't delete blob %s: %s", key, err)
+			}
+		}
+	}
+	return nil
+}
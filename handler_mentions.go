@@ -0,0 +1,23 @@
+package main
+
+import (
+	"net/http"
+)
+
+// handlerMentions lists the chirps that mention the caller.
+func (cfg *apiConfig) handlerMentions(w http.ResponseWriter, r *http.Request) {
+	userID, ok := cfg.requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	q, order, err := parseChirpQuery(r.URL.Query())
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	q.MentionedUserID = userID
+	q.HideMuted = true
+
+	cfg.respondWithChirpPage(w, r, q, order, userID)
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/brookwarren/chirpy/internal/database"
+	"github.com/rivo/uniseg"
+)
+
+const (
+	defaultModerationLogLimit = 50
+	moderationLogOrder        = "id:desc"
+)
+
+func (cfg *apiConfig) handlerAdminChirpsHide(w http.ResponseWriter, r *http.Request) {
+	cfg.hideChirp(w, r, true)
+}
+
+func (cfg *apiConfig) handlerAdminChirpsUnhide(w http.ResponseWriter, r *http.Request) {
+	cfg.hideChirp(w, r, false)
+}
+
+func (cfg *apiConfig) handlerAdminUsersSuspend(w http.ResponseWriter, r *http.Request) {
+	cfg.suspendUser(w, r, true)
+}
+
+func (cfg *apiConfig) handlerAdminUsersUnsuspend(w http.ResponseWriter, r *http.Request) {
+	cfg.suspendUser(w, r, false)
+}
+
+// hideChirp hides the chirp in the path from everyone but its author, or
+// shows it again. Hiding needs a reason, and only chirps by users with a
+// lower role than the caller's can be hidden.
+func (cfg *apiConfig) hideChirp(w http.ResponseWriter, r *http.Request, hidden bool) {
+	chirpID, err := strconv.Atoi(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid chirp ID")
+		return
+	}
+	moderatorID, ok := cfg.requireModerator(w, r)
+	if !ok {
+		return
+	}
+	reason, ok := decodeModerationReason(w, r, hidden)
+	if !ok {
+		return
+	}
+
+	chirp, err := cfg.DB.HideChirp(chirpID, moderatorID, hidden, reason)
+	if errors.Is(err, database.ErrOutranked) {
+		respondWithError(w, http.StatusForbidden, "You can't moderate a chirp by a user whose role isn't below yours")
+		return
+	}
+	if errors.Is(err, database.ErrNotExist) {
+		respondWithError(w, http.StatusNotFound, "Couldn't get chirp")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update chirp")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, chirpFromDB(chirp))
+}
+
+// suspendUser suspends the user in the path, who can then neither log in
+// nor use the tokens they hold, or lifts their suspension. Suspending needs
+// a reason, and either way the caller's role must be above the user's.
+func (cfg *apiConfig) suspendUser(w http.ResponseWriter, r *http.Request, suspended bool) {
+	userID, err := strconv.Atoi(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+	s, ok := cfg.requireRole(w, r, database.RoleModerator)
+	if !ok {
+		return
+	}
+	if userID == s.UserID {
+		respondWithError(w, http.StatusBadRequest, "You can't suspend yourself")
+		return
+	}
+	reason, ok := decodeModerationReason(w, r, suspended)
+	if !ok {
+		return
+	}
+
+	user, err := cfg.DB.SuspendUser(userID, s.UserID, suspended, reason)
+	if errors.Is(err, database.ErrOutranked) {
+		respondWithError(w, http.StatusForbidden, "You can't moderate a user whose role isn't below yours")
+		return
+	}
+	if errors.Is(err, database.ErrNotExist) {
+		respondWithError(w, http.StatusNotFound, "Couldn't get user")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update user")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, userFromDB(user))
+}
+
+// decodeModerationReason reads the reason a moderator gave for an action,
+// which is optional unless required is set.
+func decodeModerationReason(w http.ResponseWriter, r *http.Request, required bool) (string, bool) {
+	type parameters struct {
+		Reason string `json:"reason"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil && !errors.Is(err, io.EOF) {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't decode parameters")
+		return "", false
+	}
+
+	reason := strings.TrimSpace(params.Reason)
+	if required && reason == "" {
+		respondWithError(w, http.StatusBadRequest, "A reason is required")
+		return "", false
+	}
+	if uniseg.GraphemeClusterCount(reason) > maxReportReasonLength {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("A reason can be at most %d characters", maxReportReasonLength))
+		return "", false
+	}
+	return reason, true
+}
+
+// handlerAdminUsersRole gives the user in the path a role. It is for admins
+// only, who can't change their own role or another admin's, so there is
+// always an admin left.
+func (cfg *apiConfig) handlerAdminUsersRole(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Role database.Role `json:"role"`
+	}
+
+	userID, err := strconv.Atoi(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+	s, ok := cfg.requireRole(w, r, database.RoleAdmin)
+	if !ok {
+		return
+	}
+	if userID == s.UserID {
+		respondWithError(w, http.StatusBadRequest, "You can't change your own role")
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err = decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't decode parameters")
+		return
+	}
+
+	user, err := cfg.DB.SetUserRole(userID, s.UserID, params.Role)
+	if errors.Is(err, database.ErrOutranked) {
+		respondWithError(w, http.StatusForbidden, "You can't moderate a user whose role isn't below yours")
+		return
+	}
+	if errors.Is(err, database.ErrInvalidRole) {
+		respondWithError(w, http.StatusBadRequest, "Role must be user, moderator or admin")
+		return
+	}
+	if errors.Is(err, database.ErrNotExist) {
+		respondWithError(w, http.StatusNotFound, "Couldn't get user")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update user")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, userFromDB(user))
+}
+
+// handlerAdminModerationLog serves the moderation log, newest entry first.
+// Older entries are linked from the Link header.
+func (cfg *apiConfig) handlerAdminModerationLog(w http.ResponseWriter, r *http.Request) {
+	_, ok := cfg.requireModerator(w, r)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	q := database.ModerationLogQuery{
+		Limit: defaultModerationLogLimit,
+	}
+
+	limitString := query.Get("limit")
+	if limitString != "" {
+		limit, err := strconv.Atoi(limitString)
+		if err != nil || limit < 1 || limit > maxPageLimit {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Limit must be between 1 and %d", maxPageLimit))
+			return
+		}
+		q.Limit = limit
+	}
+
+	cursor := query.Get("cursor")
+	if cursor != "" {
+		decoded, err := decodeCursor(moderationLogOrder, cursor)
+		if err != nil || decoded.Backward {
+			respondWithError(w, http.StatusBadRequest, "Invalid cursor")
+			return
+		}
+		q.BeforeID = decoded.ID
+	}
+
+	page, err := cfg.DB.GetModerationLog(q)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve moderation log")
+		return
+	}
+
+	if page.HasNext {
+		last := page.Actions[len(page.Actions)-1]
+		next := encodeCursor(moderationLogOrder, false, last.CreatedAt, last.ID)
+		w.Header().Set("Link", pageLink(r, "next", next))
+	}
+	respondWithJSON(w, http.StatusOK, page.Actions)
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/brookwarren/chirpy/internal/database"
+)
+
+const (
+	defaultNotificationsLimit = 20
+	// maxNotificationActors is how many of the users behind a grouped
+	// notification are listed; ActorCount says how many there are in all.
+	maxNotificationActors = 3
+	notificationsOrder    = "updated_at:desc"
+)
+
+// Notification is a group of events of one kind, such as the likes of one
+// chirp, rendered by clients as "alice and 4 others liked your chirp".
+type Notification struct {
+	ID         int                       `json:"id"`
+	Kind       database.NotificationKind `json:"kind"`
+	ChirpID    int                       `json:"chirp_id,omitempty"`
+	ActorIDs   []int                     `json:"actor_ids"`
+	ActorCount int                       `json:"actor_count"`
+	Read       bool                      `json:"read"`
+	CreatedAt  time.Time                 `json:"created_at"`
+	UpdatedAt  time.Time                 `json:"updated_at"`
+}
+
+func notificationFromDB(notification database.Notification) Notification {
+	actorIDs := notification.ActorIDs
+	if len(actorIDs) > maxNotificationActors {
+		actorIDs = actorIDs[:maxNotificationActors]
+	}
+	return Notification{
+		ID:         notification.ID,
+		Kind:       notification.Kind,
+		ChirpID:    notification.ChirpID,
+		ActorIDs:   actorIDs,
+		ActorCount: len(notification.ActorIDs),
+		Read:       notification.Read,
+		CreatedAt:  notification.CreatedAt,
+		UpdatedAt:  notification.UpdatedAt,
+	}
+}
+
+// handlerNotificationsList serves the caller's notifications, most recently
+// updated first, with "unread=true" leaving out the ones already read. The
+// next page is linked from the Link header.
+func (cfg *apiConfig) handlerNotificationsList(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		UnreadCount   int            `json:"unread_count"`
+		Notifications []Notification `json:"notifications"`
+	}
+
+	userID, ok := cfg.requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	q := database.NotificationQuery{
+		UserID:     userID,
+		UnreadOnly: query.Get("unread") == "true",
+		Limit:      defaultNotificationsLimit,
+	}
+
+	limitString := query.Get("limit")
+	if limitString != "" {
+		limit, err := strconv.Atoi(limitString)
+		if err != nil || limit < 1 || limit > maxPageLimit {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Limit must be between 1 and %d", maxPageLimit))
+			return
+		}
+		q.Limit = limit
+	}
+
+	cursor := query.Get("cursor")
+	if cursor != "" {
+		decoded, err := decodeCursor(notificationsOrder, cursor)
+		if err != nil || decoded.Backward {
+			respondWithError(w, http.StatusBadRequest, "Invalid cursor")
+			return
+		}
+		q.After = &database.NotificationCursor{UpdatedAt: decoded.CreatedAt, ID: decoded.ID}
+	}
+
+	page, err := cfg.DB.GetNotifications(q)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve notifications")
+		return
+	}
+
+	resp := response{
+		UnreadCount:   page.Unread,
+		Notifications: []Notification{},
+	}
+	for _, notification := range page.Notifications {
+		resp.Notifications = append(resp.Notifications, notificationFromDB(notification))
+	}
+	if page.HasNext {
+		last := page.Cursor(len(page.Notifications) - 1)
+		next := encodeCursor(notificationsOrder, false, last.UpdatedAt, last.ID)
+		w.Header().Set("Link", pageLink(r, "next", next))
+	}
+	respondWithJSON(w, http.StatusOK, resp)
+}
+
+// handlerNotificationsRead marks the notifications listed in "ids" read, or
+// every notification if no IDs are sent.
+func (cfg *apiConfig) handlerNotificationsRead(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		IDs []int `json:"ids"`
+	}
+	type response struct {
+		UnreadCount int `json:"unread_count"`
+	}
+
+	userID, ok := cfg.requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	// The body is optional: without one, everything is marked read.
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil && !errors.Is(err, io.EOF) {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't decode parameters")
+		return
+	}
+
+	unread, err := cfg.DB.MarkNotificationsRead(userID, params.IDs)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't mark notifications read")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, response{UnreadCount: unread})
+}
@@ -27,11 +27,22 @@ func (cfg *apiConfig) handlerRefresh(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	accessToken, err := auth.RefreshToken(refreshToken, cfg.jwtSecret)
+	claims, err := auth.ParseJWT(refreshToken, cfg.jwtSecret, auth.TokenTypeRefresh)
 	if err != nil {
 		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT")
 		return
 	}
+	user, ok := cfg.checkSession(w, claims.UserID, claims.IssuedAt)
+	if !ok {
+		return
+	}
+
+	// The new token carries the user's current role.
+	accessToken, err := auth.MakeJWT(user.ID, string(user.Role), cfg.jwtSecret, accessTokenLifetime, auth.TokenTypeAccess)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create access JWT")
+		return
+	}
 
 	respondWithJSON(w, http.StatusOK, response{
 		Token: accessToken,
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/brookwarren/chirpy/internal/database"
+	"github.com/rivo/uniseg"
+)
+
+const (
+	maxReportReasonLength = 500
+	defaultReportsLimit   = 50
+	reportsOrder          = "id:asc"
+)
+
+type Report struct {
+	ID         int                   `json:"id"`
+	ReporterID int                   `json:"reporter_id"`
+	ChirpID    int                   `json:"chirp_id,omitempty"`
+	UserID     int                   `json:"user_id"`
+	Reason     string                `json:"reason"`
+	Status     database.ReportStatus `json:"status"`
+	// ModeratorID is who claimed or closed the report, and Note what they
+	// wrote when closing it.
+	ModeratorID int       `json:"moderator_id,omitempty"`
+	Note        string    `json:"note,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+func reportFromDB(report database.Report) Report {
+	return Report{
+		ID:          report.ID,
+		ReporterID:  report.ReporterID,
+		ChirpID:     report.ChirpID,
+		UserID:      report.UserID,
+		Reason:      report.Reason,
+		Status:      report.Status,
+		ModeratorID: report.ModeratorID,
+		Note:        report.Note,
+		CreatedAt:   report.CreatedAt,
+		UpdatedAt:   report.UpdatedAt,
+	}
+}
+
+// handlerReportsCreate reports a chirp or a user, whichever of chirp_id and
+// user_id is sent, for the moderators to review.
+func (cfg *apiConfig) handlerReportsCreate(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		ChirpID int    `json:"chirp_id"`
+		UserID  int    `json:"user_id"`
+		Reason  string `json:"reason"`
+	}
+
+	userID, ok := cfg.requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't decode parameters")
+		return
+	}
+
+	if (params.ChirpID == 0) == (params.UserID == 0) {
+		respondWithError(w, http.StatusBadRequest, "Report either a chirp or a user")
+		return
+	}
+	reason := strings.TrimSpace(params.Reason)
+	if reason == "" {
+		respondWithError(w, http.StatusBadRequest, "A report needs a reason")
+		return
+	}
+	if uniseg.GraphemeClusterCount(reason) > maxReportReasonLength {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("A reason can be at most %d characters", maxReportReasonLength))
+		return
+	}
+
+	if params.ChirpID != 0 {
+		// Only chirps the reporter can see may be reported.
+		chirp, ok := cfg.visibleChirp(w, params.ChirpID, userID)
+		if !ok {
+			return
+		}
+		params.UserID = chirp.AuthorID
+	}
+	if params.UserID == userID {
+		respondWithError(w, http.StatusBadRequest, "You can't report yourself")
+		return
+	}
+
+	report, err := cfg.DB.CreateReport(database.Report{
+		ReporterID: userID,
+		ChirpID:    params.ChirpID,
+		UserID:     params.UserID,
+		Reason:     reason,
+	})
+	if errors.Is(err, database.ErrNotExist) {
+		if params.ChirpID != 0 {
+			respondWithError(w, http.StatusNotFound, "Couldn't get chirp")
+			return
+		}
+		respondWithError(w, http.StatusNotFound, "Couldn't get user")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create report")
+		return
+	}
+	respondWithJSON(w, http.StatusCreated, reportFromDB(report))
+}
+
+// handlerAdminReportsList serves the moderators' queue, oldest report first.
+// "status" is a comma-separated list of statuses and defaults to the open
+// and claimed reports. Newer reports are linked from the Link header.
+func (cfg *apiConfig) handlerAdminReportsList(w http.ResponseWriter, r *http.Request) {
+	_, ok := cfg.requireModerator(w, r)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	q := database.ReportQuery{
+		Statuses: []database.ReportStatus{database.ReportOpen, database.ReportClaimed},
+		Limit:    defaultReportsLimit,
+	}
+
+	statusString := query.Get("status")
+	if statusString != "" {
+		q.Statuses = nil
+		for _, status := range strings.Split(statusString, ",") {
+			q.Statuses = append(q.Statuses, database.ReportStatus(strings.TrimSpace(status)))
+		}
+	}
+
+	limitString := query.Get("limit")
+	if limitString != "" {
+		limit, err := strconv.Atoi(limitString)
+		if err != nil || limit < 1 || limit > maxPageLimit {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Limit must be between 1 and %d", maxPageLimit))
+			return
+		}
+		q.Limit = limit
+	}
+
+	cursor := query.Get("cursor")
+	if cursor != "" {
+		decoded, err := decodeCursor(reportsOrder, cursor)
+		if err != nil || decoded.Backward {
+			respondWithError(w, http.StatusBadRequest, "Invalid cursor")
+			return
+		}
+		q.AfterID = decoded.ID
+	}
+
+	page, err := cfg.DB.GetReports(q)
+	if errors.Is(err, database.ErrInvalidReportStatus) {
+		respondWithError(w, http.StatusBadRequest, "Status must be open, claimed, resolved or dismissed")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve reports")
+		return
+	}
+
+	reports := []Report{}
+	for _, report := range page.Reports {
+		reports = append(reports, reportFromDB(report))
+	}
+	if page.HasNext {
+		last := page.Reports[len(page.Reports)-1]
+		next := encodeCursor(reportsOrder, false, last.CreatedAt, last.ID)
+		w.Header().Set("Link", pageLink(r, "next", next))
+	}
+	respondWithJSON(w, http.StatusOK, reports)
+}
+
+func (cfg *apiConfig) handlerAdminReportsGet(w http.ResponseWriter, r *http.Request) {
+	reportID, err := strconv.Atoi(r.PathValue("reportID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid report ID")
+		return
+	}
+	_, ok := cfg.requireModerator(w, r)
+	if !ok {
+		return
+	}
+
+	report, err := cfg.DB.GetReport(reportID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't get report")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, reportFromDB(report))
+}
+
+func (cfg *apiConfig) handlerAdminReportsClaim(w http.ResponseWriter, r *http.Request) {
+	cfg.moderateReport(w, r, database.ReportClaimed)
+}
+
+func (cfg *apiConfig) handlerAdminReportsResolve(w http.ResponseWriter, r *http.Request) {
+	cfg.moderateReport(w, r, database.ReportResolved)
+}
+
+func (cfg *apiConfig) handlerAdminReportsDismiss(w http.ResponseWriter, r *http.Request) {
+	cfg.moderateReport(w, r, database.ReportDismissed)
+}
+
+// moderateReport moves the report in the path to status on the caller's
+// behalf. Resolving and dismissing take an optional note for the record.
+func (cfg *apiConfig) moderateReport(w http.ResponseWriter, r *http.Request, status database.ReportStatus) {
+	type parameters struct {
+		Note string `json:"note"`
+	}
+
+	reportID, err := strconv.Atoi(r.PathValue("reportID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid report ID")
+		return
+	}
+	moderatorID, ok := cfg.requireModerator(w, r)
+	if !ok {
+		return
+	}
+
+	// The body is optional.
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err = decoder.Decode(&params)
+	if err != nil && !errors.Is(err, io.EOF) {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't decode parameters")
+		return
+	}
+	note := strings.TrimSpace(params.Note)
+	if uniseg.GraphemeClusterCount(note) > maxReportReasonLength {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("A note can be at most %d characters", maxReportReasonLength))
+		return
+	}
+
+	report, err := cfg.DB.ModerateReport(reportID, moderatorID, status, note)
+	if errors.Is(err, database.ErrNotExist) {
+		respondWithError(w, http.StatusNotFound, "Couldn't get report")
+		return
+	}
+	if errors.Is(err, database.ErrReportClaimed) {
+		respondWithError(w, http.StatusConflict, "Another moderator has claimed this report")
+		return
+	}
+	if errors.Is(err, database.ErrReportClosed) {
+		respondWithError(w, http.StatusConflict, "This report is already closed")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update report")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, reportFromDB(report))
+}
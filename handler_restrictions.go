@@ -0,0 +1,111 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/brookwarren/chirpy/internal/database"
+)
+
+type Restriction struct {
+	UserID    int       `json:"user_id"`
+	TargetID  int       `json:"target_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func restrictionFromDB(restriction database.Restriction) Restriction {
+	return Restriction{
+		UserID:    restriction.UserID,
+		TargetID:  restriction.TargetID,
+		CreatedAt: restriction.CreatedAt,
+	}
+}
+
+func (cfg *apiConfig) handlerBlocksCreate(w http.ResponseWriter, r *http.Request) {
+	cfg.restrictUser(w, r, database.RestrictionBlock, true)
+}
+
+func (cfg *apiConfig) handlerBlocksDelete(w http.ResponseWriter, r *http.Request) {
+	cfg.restrictUser(w, r, database.RestrictionBlock, false)
+}
+
+func (cfg *apiConfig) handlerMutesCreate(w http.ResponseWriter, r *http.Request) {
+	cfg.restrictUser(w, r, database.RestrictionMute, true)
+}
+
+func (cfg *apiConfig) handlerMutesDelete(w http.ResponseWriter, r *http.Request) {
+	cfg.restrictUser(w, r, database.RestrictionMute, false)
+}
+
+func (cfg *apiConfig) handlerBlocksList(w http.ResponseWriter, r *http.Request) {
+	cfg.respondWithRestrictions(w, r, database.RestrictionBlock)
+}
+
+func (cfg *apiConfig) handlerMutesList(w http.ResponseWriter, r *http.Request) {
+	cfg.respondWithRestrictions(w, r, database.RestrictionMute)
+}
+
+// restrictUser adds or removes the caller's block or mute of the user in the
+// path.
+func (cfg *apiConfig) restrictUser(w http.ResponseWriter, r *http.Request, kind database.RestrictionKind, add bool) {
+	targetID, err := strconv.Atoi(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+	userID, ok := cfg.requireUser(w, r)
+	if !ok {
+		return
+	}
+	if targetID == userID {
+		respondWithError(w, http.StatusBadRequest, "You can't "+string(kind)+" yourself")
+		return
+	}
+
+	if !add {
+		err = cfg.DB.RemoveRestriction(kind, userID, targetID)
+		if errors.Is(err, database.ErrNotExist) {
+			respondWithError(w, http.StatusNotFound, "Couldn't get user")
+			return
+		}
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't update "+string(kind))
+			return
+		}
+		respondWithJSON(w, http.StatusOK, struct{}{})
+		return
+	}
+
+	restriction, err := cfg.DB.AddRestriction(kind, userID, targetID)
+	if errors.Is(err, database.ErrNotExist) {
+		respondWithError(w, http.StatusNotFound, "Couldn't get user")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update "+string(kind))
+		return
+	}
+	respondWithJSON(w, http.StatusOK, restrictionFromDB(restriction))
+}
+
+// respondWithRestrictions lists the users the caller has blocked or muted.
+func (cfg *apiConfig) respondWithRestrictions(w http.ResponseWriter, r *http.Request, kind database.RestrictionKind) {
+	userID, ok := cfg.requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	dbRestrictions, err := cfg.DB.GetRestrictions(kind, userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't list "+string(kind)+"s")
+		return
+	}
+
+	restrictions := []Restriction{}
+	for _, dbRestriction := range dbRestrictions {
+		restrictions = append(restrictions, restrictionFromDB(dbRestriction))
+	}
+	respondWithJSON(w, http.StatusOK, restrictions)
+}
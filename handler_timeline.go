@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/brookwarren/chirpy/internal/database"
+)
+
+const defaultTimelineLimit = 20
+
+// handlerTimeline serves the caller's home timeline: the chirps and rechirps
+// of the caller and everyone they follow, newest first. It is assembled on read from
+// the follow graph, so following or unfollowing someone takes effect at once.
+func (cfg *apiConfig) handlerTimeline(w http.ResponseWriter, r *http.Request) {
+	userID, ok := cfg.requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	q := database.ChirpQuery{
+		SortBy:          database.ChirpSortCreatedAt,
+		Descending:      true,
+		Limit:           defaultTimelineLimit,
+		IncludeRechirps: true,
+		ViewerID:        userID,
+		HideMuted:       true,
+	}
+
+	limitString := query.Get("limit")
+	if limitString != "" {
+		limit, err := strconv.Atoi(limitString)
+		if err != nil || limit < 1 || limit > maxPageLimit {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Limit must be between 1 and %d", maxPageLimit))
+			return
+		}
+		q.Limit = limit
+	}
+
+	const order = "created_at:desc"
+	err := applyCursor(&q, order, query.Get("cursor"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid cursor")
+		return
+	}
+
+	following, err := cfg.DB.GetFollowing(userID, 0)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get followed users")
+		return
+	}
+	q.AuthorIDs = []int{userID}
+	for _, follow := range following {
+		q.AuthorIDs = append(q.AuthorIDs, follow.FolloweeID)
+	}
+
+	page, err := cfg.DB.QueryChirps(q)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve timeline")
+		return
+	}
+
+	chirps, err := cfg.chirpsForViewer(page.Chirps, page.Rechirps, userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get chirp stats")
+		return
+	}
+
+	setPageLinks(w, r, order, page)
+	respondWithJSON(w, http.StatusOK, chirps)
+}
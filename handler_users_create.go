@@ -10,10 +10,33 @@ import (
 )
 
 type User struct {
-	ID          int    `json:"id"`
-	Email       string `json:"email"`
-	Password    string `json:"-"`
-	IsChirpyRed bool   `json:"is_chirpy_red"`
+	ID            int    `json:"id"`
+	Email         string `json:"email"`
+	Password      string `json:"-"`
+	IsChirpyRed   bool   `json:"is_chirpy_red"`
+	Handle        string `json:"handle"`
+	DisplayName   string `json:"display_name"`
+	Bio           string `json:"bio"`
+	AvatarMediaID int    `json:"avatar_media_id,omitempty"`
+	Suspended     bool   `json:"suspended,omitempty"`
+	// Role is "user", "moderator" or "admin".
+	Role database.Role `json:"role"`
+}
+
+// userFromDB is the user as they see themselves, email included. Everyone
+// else sees a Profile.
+func userFromDB(user database.User) User {
+	return User{
+		ID:            user.ID,
+		Email:         user.Email,
+		IsChirpyRed:   user.IsChirpyRed,
+		Handle:        user.Handle,
+		DisplayName:   user.DisplayName,
+		Bio:           user.Bio,
+		AvatarMediaID: user.AvatarMediaID,
+		Suspended:     user.Suspended,
+		Role:          user.Role,
+	}
 }
 
 func (cfg *apiConfig) handlerUsersCreate(w http.ResponseWriter, r *http.Request) {
@@ -51,10 +74,6 @@ func (cfg *apiConfig) handlerUsersCreate(w http.ResponseWriter, r *http.Request)
 	}
 
 	respondWithJSON(w, http.StatusCreated, response{
-		User: User{
-			ID:          user.ID,
-			Email:       user.Email,
-			IsChirpyRed: user.IsChirpyRed,
-		},
+		User: userFromDB(user),
 	})
 }
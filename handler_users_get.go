@@ -0,0 +1,70 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/brookwarren/chirpy/internal/database"
+)
+
+// Profile is what anyone can see of a user. It never includes their email.
+type Profile struct {
+	ID            int    `json:"id"`
+	Handle        string `json:"handle"`
+	DisplayName   string `json:"display_name"`
+	Bio           string `json:"bio"`
+	AvatarMediaID int    `json:"avatar_media_id,omitempty"`
+	IsChirpyRed   bool   `json:"is_chirpy_red"`
+}
+
+func profileFromDB(user database.User) Profile {
+	return Profile{
+		ID:            user.ID,
+		Handle:        user.Handle,
+		DisplayName:   user.DisplayName,
+		Bio:           user.Bio,
+		AvatarMediaID: user.AvatarMediaID,
+		IsChirpyRed:   user.IsChirpyRed,
+	}
+}
+
+func (cfg *apiConfig) handlerUsersGet(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+	user, err := cfg.DB.GetUser(userID)
+	respondWithProfile(w, user, err)
+}
+
+func (cfg *apiConfig) handlerUsersGetByHandle(w http.ResponseWriter, r *http.Request) {
+	user, err := cfg.DB.GetUserByHandle(r.PathValue("handle"))
+	respondWithProfile(w, user, err)
+}
+
+func respondWithProfile(w http.ResponseWriter, user database.User, err error) {
+	if errors.Is(err, database.ErrNotExist) {
+		respondWithError(w, http.StatusNotFound, "Couldn't get user")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get user")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, profileFromDB(user))
+}
+
+// handlerUsersRelation serves the lists of users related to a user, such as
+// /api/users/{userID}/followers.
+func (cfg *apiConfig) handlerUsersRelation(w http.ResponseWriter, r *http.Request) {
+	switch r.PathValue("relation") {
+	case "followers":
+		cfg.handlerFollowersList(w, r)
+	case "following":
+		cfg.handlerFollowingList(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
@@ -2,63 +2,165 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
-	"strconv"
+	"regexp"
+	"time"
 
 	"github.com/brookwarren/chirpy/internal/auth"
+	"github.com/brookwarren/chirpy/internal/database"
+	"github.com/rivo/uniseg"
 )
 
+const (
+	maxDisplayNameLength = 50
+	maxBioLength         = 160
+)
+
+// handlePattern matches the handles users can choose, the same characters
+// an @mention can name.
+var handlePattern = regexp.MustCompile(`^[A-Za-z0-9_]{1,15}$`)
+
+// handlerUsersUpdate changes the fields sent and leaves the rest alone, so
+// a client can change a bio without sending the password again. Sending an
+// empty handle removes it, and an avatar_media_id of 0 removes the avatar.
+//
+// Changing the password needs the current one, with either method. PUT
+// always sends a password, so sending the current one again changes only the
+// email, as it always has. Changing the password or the email revokes all of
+// the user's sessions, so the response carries new tokens for the caller to
+// carry on with.
 func (cfg *apiConfig) handlerUsersUpdate(w http.ResponseWriter, r *http.Request) {
 	type parameters struct {
-		Password string `json:"password"`
-		Email    string `json:"email"`
+		Password        *string `json:"password"`
+		CurrentPassword *string `json:"current_password"`
+		Email           *string `json:"email"`
+		Handle          *string `json:"handle"`
+		DisplayName     *string `json:"display_name"`
+		Bio             *string `json:"bio"`
+		AvatarMediaID   *int    `json:"avatar_media_id"`
 	}
 	type response struct {
 		User
+		Token        string `json:"token,omitempty"`
+		RefreshToken string `json:"refresh_token,omitempty"`
 	}
 
-	token, err := auth.GetBearerToken(r.Header)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT")
-		return
-	}
-	subject, err := auth.ValidateJWT(token, cfg.jwtSecret)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT")
+	userID, ok := cfg.requireUser(w, r)
+	if !ok {
 		return
 	}
 
 	decoder := json.NewDecoder(r.Body)
 	params := parameters{}
-	err = decoder.Decode(&params)
+	err := decoder.Decode(&params)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't decode parameters")
 		return
 	}
-
-	hashedPassword, err := auth.HashPassword(params.Password)
+	// PUT replaces the email and password, as it always has.
+	if r.Method == http.MethodPut && (params.Email == nil || params.Password == nil) {
+		respondWithError(w, http.StatusBadRequest, "Email and password are required")
+		return
+	}
+	if params.Email != nil && *params.Email == "" {
+		respondWithError(w, http.StatusBadRequest, "Email can't be empty")
+		return
+	}
+	if params.Password != nil && *params.Password == "" {
+		respondWithError(w, http.StatusBadRequest, "Password can't be empty")
+		return
+	}
+	err = checkProfile(params.Handle, params.DisplayName, params.Bio)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Couldn't hash password")
+		respondWithError(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	userIDInt, err := strconv.Atoi(subject)
+	old, err := cfg.DB.GetUser(userID)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Couldn't parse user ID")
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get user")
 		return
 	}
 
-	user, err := cfg.DB.UpdateUser(userIDInt, params.Email, hashedPassword)
+	update := database.UserUpdate{
+		Email:         params.Email,
+		Handle:        params.Handle,
+		DisplayName:   params.DisplayName,
+		Bio:           params.Bio,
+		AvatarMediaID: params.AvatarMediaID,
+	}
+	passwordChanged := params.Password != nil && auth.CheckPasswordHash(*params.Password, old.HashedPassword) != nil
+	if passwordChanged {
+		if params.CurrentPassword == nil || auth.CheckPasswordHash(*params.CurrentPassword, old.HashedPassword) != nil {
+			respondWithError(w, http.StatusUnauthorized, "Invalid current password")
+			return
+		}
+		hashedPassword, err := auth.HashPassword(*params.Password)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't hash password")
+			return
+		}
+		update.HashedPassword = &hashedPassword
+	}
+	revokeSessions := passwordChanged || (params.Email != nil && *params.Email != old.Email)
+	if revokeSessions {
+		// Issue times are compared to the millisecond, so truncating keeps
+		// the tokens made below, in the same millisecond, valid.
+		now := time.Now().Truncate(time.Millisecond)
+		update.SessionsValidAfter = &now
+	}
+
+	user, err := cfg.DB.UpdateUser(userID, update)
+	if errors.Is(err, database.ErrHandleTaken) {
+		respondWithError(w, http.StatusConflict, "Handle is already taken")
+		return
+	}
+	if errors.Is(err, database.ErrAlreadyExists) {
+		respondWithError(w, http.StatusConflict, "User already exists")
+		return
+	}
+	if errors.Is(err, database.ErrMediaNotExist) {
+		respondWithError(w, http.StatusBadRequest, "Couldn't find media")
+		return
+	}
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Couldn't create user")
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update user")
 		return
 	}
+	if old.AvatarMediaID != 0 && old.AvatarMediaID != user.AvatarMediaID {
+		err = cfg.collectMedia([]int{old.AvatarMediaID})
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't delete media")
+			return
+		}
+	}
+
+	resp := response{
+		User: userFromDB(user),
+	}
+	if revokeSessions {
+		resp.Token, resp.RefreshToken, err = cfg.makeTokens(user)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't create JWT")
+			return
+		}
+	}
+	respondWithJSON(w, http.StatusOK, resp)
+}
 
-	respondWithJSON(w, http.StatusOK, response{
-		User: User{
-			ID:          user.ID,
-			Email:       user.Email,
-			IsChirpyRed: user.IsChirpyRed,
-		},
-	})
+// checkProfile checks the profile fields of an update, returning an error
+// with a message for the client. Lengths are counted the way chirps are.
+func checkProfile(handle, displayName, bio *string) error {
+	if handle != nil && *handle != "" && !handlePattern.MatchString(*handle) {
+		return errors.New("A handle must be 1 to 15 letters, digits or underscores")
+	}
+	if displayName != nil && uniseg.GraphemeClusterCount(*displayName) > maxDisplayNameLength {
+		return fmt.Errorf("A display name can be at most %d characters", maxDisplayNameLength)
+	}
+	if bio != nil && uniseg.GraphemeClusterCount(*bio) > maxBioLength {
+		return fmt.Errorf("A bio can be at most %d characters", maxBioLength)
+	}
+	return nil
 }
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/brookwarren/chirpy/internal/auth"
+	"github.com/brookwarren/chirpy/internal/database"
+)
+
+// TestUsersUpdatePutPassword checks that PUT /api/users needs the current
+// password to change the password, but not to change only the email.
+func TestUsersUpdatePutPassword(t *testing.T) {
+	db, err := database.NewDB(filepath.Join(t.TempDir(), "database.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := &apiConfig{DB: db, jwtSecret: "secret"}
+
+	hashedPassword, err := auth.HashPassword("old")
+	if err != nil {
+		t.Fatal(err)
+	}
+	user, err := db.CreateUser("a@example.com", hashedPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	put := func(body string) int {
+		t.Helper()
+		user, err := db.GetUser(user.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		token, _, err := cfg.makeTokens(user)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := httptest.NewRequest(http.MethodPut, "/api/users", strings.NewReader(body))
+		r.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		cfg.handlerUsersUpdate(w, r)
+		return w.Code
+	}
+	password := func() string {
+		t.Helper()
+		user, err := db.GetUser(user.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, password := range []string{"old", "new"} {
+			if auth.CheckPasswordHash(password, user.HashedPassword) == nil {
+				return password
+			}
+		}
+		return ""
+	}
+
+	tests := []struct {
+		name         string
+		body         string
+		wantStatus   int
+		wantPassword string
+	}{
+		{"no current password", `{"email": "a@example.com", "password": "new"}`, http.StatusUnauthorized, "old"},
+		{"wrong current password", `{"email": "a@example.com", "password": "new", "current_password": "nope"}`, http.StatusUnauthorized, "old"},
+		{"same password", `{"email": "b@example.com", "password": "old"}`, http.StatusOK, "old"},
+		{"current password", `{"email": "b@example.com", "password": "new", "current_password": "old"}`, http.StatusOK, "new"},
+	}
+	for _, tt := range tests {
+		status := put(tt.body)
+		if status != tt.wantStatus {
+			t.Errorf("%s: got status %d, want %d", tt.name, status, tt.wantStatus)
+		}
+		if got := password(); got != tt.wantPassword {
+			t.Errorf("%s: got password %q, want %q", tt.name, got, tt.wantPassword)
+		}
+	}
+}
@@ -24,6 +24,13 @@ const (
 // ErrNoAuthHeaderIncluded -
 var ErrNoAuthHeaderIncluded = errors.New("not auth header included in request")
 
+func init() {
+	// Issue times are compared with the time a user's sessions were revoked,
+	// so whole seconds are too coarse: a token issued just after the
+	// revocation would look as if it had been issued before it. See ParseJWT.
+	jwt.TimePrecision = time.Microsecond
+}
+
 // HashPassword -
 func HashPassword(password string) (string, error) {
 	dat, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
@@ -38,93 +45,88 @@ func CheckPasswordHash(password, hash string) error {
 	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
 }
 
+// Claims are what a token says about the user it was issued to.
+type Claims struct {
+	UserID int
+	// Role is the role the user had when the token was issued.
+	Role string
+	// IssuedAt is when the token was issued, to the millisecond.
+	IssuedAt time.Time
+}
+
+// tokenClaims are the claims encoded in a token.
+type tokenClaims struct {
+	jwt.RegisteredClaims
+	Role string `json:"role,omitempty"`
+}
+
 // MakeJWT -
 func MakeJWT(
 	userID int,
+	role string,
 	tokenSecret string,
 	expiresIn time.Duration,
 	tokenType TokenType,
 ) (string, error) {
 	signingKey := []byte(tokenSecret)
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
-		Issuer:    string(tokenType),
-		IssuedAt:  jwt.NewNumericDate(time.Now().UTC()),
-		ExpiresAt: jwt.NewNumericDate(time.Now().UTC().Add(expiresIn)),
-		Subject:   fmt.Sprintf("%d", userID),
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, tokenClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    string(tokenType),
+			IssuedAt:  jwt.NewNumericDate(time.Now().UTC()),
+			ExpiresAt: jwt.NewNumericDate(time.Now().UTC().Add(expiresIn)),
+			Subject:   fmt.Sprintf("%d", userID),
+		},
+		Role: role,
 	})
 	return token.SignedString(signingKey)
 }
 
-// RefreshToken -
-func RefreshToken(tokenString, tokenSecret string) (string, error) {
-	claimsStruct := jwt.RegisteredClaims{}
+// ParseJWT validates a token of the given type and returns its claims. Issue
+// times are encoded as floating point seconds, which don't round-trip
+// exactly, so the time is rounded rather than truncated.
+func ParseJWT(tokenString, tokenSecret string, tokenType TokenType) (Claims, error) {
+	claimsStruct := tokenClaims{}
 	token, err := jwt.ParseWithClaims(
 		tokenString,
 		&claimsStruct,
 		func(token *jwt.Token) (interface{}, error) { return []byte(tokenSecret), nil },
 	)
 	if err != nil {
-		return "", err
+		return Claims{}, err
 	}
 
 	userIDString, err := token.Claims.GetSubject()
 	if err != nil {
-		return "", err
+		return Claims{}, err
 	}
 
 	issuer, err := token.Claims.GetIssuer()
 	if err != nil {
-		return "", err
+		return Claims{}, err
 	}
-	if issuer != string(TokenTypeRefresh) {
-		return "", errors.New("invalid issuer")
+	if issuer != string(tokenType) {
+		return Claims{}, errors.New("invalid issuer")
 	}
 
-	userID, err := strconv.Atoi(userIDString)
+	issuedAt, err := token.Claims.GetIssuedAt()
 	if err != nil {
-		return "", err
+		return Claims{}, err
 	}
-
-	newToken, err := MakeJWT(
-		userID,
-		tokenSecret,
-		time.Hour,
-		TokenTypeAccess,
-	)
-	if err != nil {
-		return "", err
+	if issuedAt == nil {
+		return Claims{}, errors.New("missing issue time")
 	}
 
-	return newToken, nil
-}
-
-// ValidateJWT -
-func ValidateJWT(tokenString, tokenSecret string) (string, error) {
-	claimsStruct := jwt.RegisteredClaims{}
-	token, err := jwt.ParseWithClaims(
-		tokenString,
-		&claimsStruct,
-		func(token *jwt.Token) (interface{}, error) { return []byte(tokenSecret), nil },
-	)
-	if err != nil {
-		return "", err
-	}
-
-	userIDString, err := token.Claims.GetSubject()
-	if err != nil {
-		return "", err
-	}
-
-	issuer, err := token.Claims.GetIssuer()
+	userID, err := strconv.Atoi(userIDString)
 	if err != nil {
-		return "", err
-	}
-	if issuer != string(TokenTypeAccess) {
-		return "", errors.New("invalid issuer")
+		return Claims{}, err
 	}
 
-	return userIDString, nil
+	return Claims{
+		UserID:   userID,
+		Role:     claimsStruct.Role,
+		IssuedAt: issuedAt.Round(time.Millisecond),
+	}, nil
 }
 
 // GetBearerToken -
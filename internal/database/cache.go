@@ -0,0 +1,541 @@
+package database
+
+import (
+	"errors"
+	"os"
+
+	"github.com/brookwarren/chirpy/internal/search"
+)
+
+// dbCache is the decoded database kept in memory between requests, along with
+// the bytes it was decoded from and the state of the files it was read from.
+type dbCache struct {
+	structure DBStructure
+	raw       []byte
+	files     fileState
+}
+
+// fileState identifies the versions of the snapshot and journal on disk.
+type fileState struct {
+	snapshot os.FileInfo
+	journal  os.FileInfo
+}
+
+func (db *DB) statFiles() (fileState, error) {
+	snapshot, err := os.Stat(db.path)
+	if err != nil {
+		return fileState{}, err
+	}
+	journal, err := os.Stat(db.journalPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return fileState{snapshot: snapshot}, nil
+	}
+	if err != nil {
+		return fileState{}, err
+	}
+	return fileState{snapshot: snapshot, journal: journal}, nil
+}
+
+func (s fileState) matches(other fileState) bool {
+	return sameFileVersion(s.snapshot, other.snapshot) && sameFileVersion(s.journal, other.journal)
+}
+
+func sameFileVersion(a, b os.FileInfo) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return os.SameFile(a, b) && a.ModTime().Equal(b.ModTime()) && a.Size() == b.Size()
+}
+
+// cacheFresh reports whether the cache still matches the files on disk.
+// Callers must hold db.mu.
+func (db *DB) cacheFresh() bool {
+	if db.cache == nil {
+		return false
+	}
+	files, err := db.statFiles()
+	if err != nil {
+		return false
+	}
+	return db.cache.files.matches(files)
+}
+
+// loadCache (re)loads the cache if the files changed since it was filled.
+// Callers must hold db.mu for writing.
+func (db *DB) loadCache() error {
+	files, err := db.statFiles()
+	if err != nil {
+		return err
+	}
+	if db.cache != nil && db.cache.files.matches(files) {
+		return nil
+	}
+
+	dbStructure, raw, err := db.loadDB()
+	if err != nil {
+		return err
+	}
+	dbStructure.buildIndexes()
+	db.cache = &dbCache{
+		structure: dbStructure,
+		raw:       raw,
+		files:     files,
+	}
+	return nil
+}
+
+// cacheWritten records that the cached structure was persisted as dat.
+func (db *DB) cacheWritten(dat []byte) error {
+	files, err := db.statFiles()
+	if err != nil {
+		db.cache = nil
+		return err
+	}
+	db.cache.raw = dat
+	db.cache.files = files
+	return nil
+}
+
+// buildIndexes rebuilds the secondary indexes from scratch. Code that edits
+// the indexed collections goes through putUser, putChirp, removeChirp,
+// putTombstone, putReaction, removeReaction, putFollow, removeFollow,
+// putRestriction, removeRestriction, putNotification, removeNotification,
+// putConversation, putMessage, putMedia and removeMedia so the indexes
+// stay current for the rest of the transaction.
+func (dbStructure *DBStructure) buildIndexes() {
+	dbStructure.usersByEmail = make(map[string]int, len(dbStructure.Users))
+	dbStructure.usersByHandle = make(map[string]int, len(dbStructure.Users))
+	dbStructure.usersByAvatar = map[int]map[int]struct{}{}
+	for _, user := range dbStructure.Users {
+		dbStructure.indexUser(user)
+	}
+
+	dbStructure.chirpsByAuthor = map[int]map[int]struct{}{}
+	dbStructure.replies = map[int]map[int]struct{}{}
+	dbStructure.chirpsByTag = map[string]map[int]struct{}{}
+	dbStructure.mentionsOf = map[int]map[int]struct{}{}
+	dbStructure.chirpsByMedia = map[int]map[int]struct{}{}
+	dbStructure.searchIndex = search.NewIndex()
+	for id, chirp := range dbStructure.Chirps {
+		dbStructure.indexChirp(chirp)
+		dbStructure.searchIndex.Add(id, chirp.Body)
+	}
+	for id, tombstone := range dbStructure.ChirpTombstones {
+		dbStructure.indexReply(id, tombstone.InReplyTo)
+	}
+
+	dbStructure.rechirpsByUser = map[int]map[int]struct{}{}
+	for _, rechirps := range dbStructure.Rechirps {
+		for _, rechirp := range rechirps {
+			dbStructure.indexRechirp(rechirp)
+		}
+	}
+
+	dbStructure.followers = map[int]map[int]struct{}{}
+	for followerID, follows := range dbStructure.Follows {
+		for followeeID := range follows {
+			dbStructure.indexFollow(followerID, followeeID)
+		}
+	}
+
+	dbStructure.blockedBy = map[int]map[int]struct{}{}
+	for userID, blocks := range dbStructure.Blocks {
+		for targetID := range blocks {
+			dbStructure.indexBlock(userID, targetID)
+		}
+	}
+
+	dbStructure.notificationsByUser = map[int]map[int]struct{}{}
+	dbStructure.notificationsByChirp = map[int]map[int]struct{}{}
+	dbStructure.openNotifications = map[notificationKey]int{}
+	for _, notification := range dbStructure.Notifications {
+		dbStructure.indexNotification(notification)
+	}
+
+	dbStructure.conversationsByMember = map[int]map[int]struct{}{}
+	dbStructure.directConversations = map[directKey]int{}
+	for _, conversation := range dbStructure.Conversations {
+		dbStructure.indexConversation(conversation)
+	}
+	dbStructure.messagesByConversation = map[int]map[int]struct{}{}
+	for _, message := range dbStructure.Messages {
+		dbStructure.indexMessage(message)
+	}
+
+	dbStructure.mediaBySHA = map[string]map[int]struct{}{}
+	for _, media := range dbStructure.Media {
+		dbStructure.indexMedia(media)
+	}
+}
+
+func (dbStructure *DBStructure) userByEmail(email string) (User, bool) {
+	id, ok := dbStructure.usersByEmail[email]
+	if !ok {
+		return User{}, false
+	}
+	user, ok := dbStructure.Users[id]
+	return user, ok
+}
+
+func (dbStructure *DBStructure) userByHandle(handle string) (User, bool) {
+	if handle == "" {
+		return User{}, false
+	}
+	id, ok := dbStructure.usersByHandle[handleKey(handle)]
+	if !ok {
+		return User{}, false
+	}
+	user, ok := dbStructure.Users[id]
+	return user, ok
+}
+
+func (dbStructure *DBStructure) putUser(user User) {
+	if old, ok := dbStructure.Users[user.ID]; ok {
+		dbStructure.unindexUser(old)
+	}
+	dbStructure.Users[user.ID] = user
+	dbStructure.indexUser(user)
+}
+
+func (dbStructure *DBStructure) indexUser(user User) {
+	dbStructure.usersByEmail[user.Email] = user.ID
+	if user.Handle != "" {
+		dbStructure.usersByHandle[handleKey(user.Handle)] = user.ID
+	}
+	if user.AvatarMediaID != 0 {
+		ids, ok := dbStructure.usersByAvatar[user.AvatarMediaID]
+		if !ok {
+			ids = map[int]struct{}{}
+			dbStructure.usersByAvatar[user.AvatarMediaID] = ids
+		}
+		ids[user.ID] = struct{}{}
+	}
+}
+
+func (dbStructure *DBStructure) unindexUser(user User) {
+	if dbStructure.usersByEmail[user.Email] == user.ID {
+		delete(dbStructure.usersByEmail, user.Email)
+	}
+	if key := handleKey(user.Handle); user.Handle != "" && dbStructure.usersByHandle[key] == user.ID {
+		delete(dbStructure.usersByHandle, key)
+	}
+	delete(dbStructure.usersByAvatar[user.AvatarMediaID], user.ID)
+	if len(dbStructure.usersByAvatar[user.AvatarMediaID]) == 0 {
+		delete(dbStructure.usersByAvatar, user.AvatarMediaID)
+	}
+}
+
+func (dbStructure *DBStructure) putChirp(chirp Chirp) {
+	if old, ok := dbStructure.Chirps[chirp.ID]; ok {
+		dbStructure.unindexChirp(old)
+	}
+	dbStructure.Chirps[chirp.ID] = chirp
+	dbStructure.indexChirp(chirp)
+	dbStructure.searchIndex.Add(chirp.ID, chirp.Body)
+}
+
+// removeChirp deletes a chirp along with the reactions to it and the
+// notifications about it.
+func (dbStructure *DBStructure) removeChirp(id int) {
+	chirp, ok := dbStructure.Chirps[id]
+	if !ok {
+		return
+	}
+	delete(dbStructure.Chirps, id)
+	dbStructure.unindexChirp(chirp)
+	for userID := range dbStructure.Rechirps[id] {
+		delete(dbStructure.rechirpsByUser[userID], id)
+	}
+	delete(dbStructure.Likes, id)
+	delete(dbStructure.Rechirps, id)
+	for notificationID := range dbStructure.notificationsByChirp[id] {
+		dbStructure.removeNotification(notificationID)
+	}
+}
+
+func (dbStructure *DBStructure) unindexChirp(chirp Chirp) {
+	delete(dbStructure.chirpsByAuthor[chirp.AuthorID], chirp.ID)
+	delete(dbStructure.replies[chirp.InReplyTo], chirp.ID)
+	dbStructure.searchIndex.Remove(chirp.ID)
+	for _, tag := range tags(chirp.Hashtags) {
+		delete(dbStructure.chirpsByTag[tag], chirp.ID)
+		if len(dbStructure.chirpsByTag[tag]) == 0 {
+			delete(dbStructure.chirpsByTag, tag)
+		}
+	}
+	for _, userID := range mentionedUserIDs(chirp.Mentions) {
+		delete(dbStructure.mentionsOf[userID], chirp.ID)
+	}
+	for _, mediaID := range chirp.MediaIDs {
+		delete(dbStructure.chirpsByMedia[mediaID], chirp.ID)
+		if len(dbStructure.chirpsByMedia[mediaID]) == 0 {
+			delete(dbStructure.chirpsByMedia, mediaID)
+		}
+	}
+}
+
+func (dbStructure *DBStructure) putTombstone(tombstone ChirpTombstone) {
+	dbStructure.ChirpTombstones[tombstone.ID] = tombstone
+	dbStructure.indexReply(tombstone.ID, tombstone.InReplyTo)
+}
+
+func (dbStructure *DBStructure) indexChirp(chirp Chirp) {
+	ids, ok := dbStructure.chirpsByAuthor[chirp.AuthorID]
+	if !ok {
+		ids = map[int]struct{}{}
+		dbStructure.chirpsByAuthor[chirp.AuthorID] = ids
+	}
+	ids[chirp.ID] = struct{}{}
+	dbStructure.indexReply(chirp.ID, chirp.InReplyTo)
+
+	for _, tag := range tags(chirp.Hashtags) {
+		ids, ok := dbStructure.chirpsByTag[tag]
+		if !ok {
+			ids = map[int]struct{}{}
+			dbStructure.chirpsByTag[tag] = ids
+		}
+		ids[chirp.ID] = struct{}{}
+	}
+	for _, userID := range mentionedUserIDs(chirp.Mentions) {
+		ids, ok := dbStructure.mentionsOf[userID]
+		if !ok {
+			ids = map[int]struct{}{}
+			dbStructure.mentionsOf[userID] = ids
+		}
+		ids[chirp.ID] = struct{}{}
+	}
+	for _, mediaID := range chirp.MediaIDs {
+		ids, ok := dbStructure.chirpsByMedia[mediaID]
+		if !ok {
+			ids = map[int]struct{}{}
+			dbStructure.chirpsByMedia[mediaID] = ids
+		}
+		ids[chirp.ID] = struct{}{}
+	}
+}
+
+func (dbStructure *DBStructure) indexReply(id, inReplyTo int) {
+	if inReplyTo == 0 {
+		return
+	}
+	ids, ok := dbStructure.replies[inReplyTo]
+	if !ok {
+		ids = map[int]struct{}{}
+		dbStructure.replies[inReplyTo] = ids
+	}
+	ids[id] = struct{}{}
+}
+
+func (dbStructure *DBStructure) putReaction(kind ReactionKind, reaction Reaction) {
+	collection := dbStructure.reactions(kind)
+	reactions, ok := collection[reaction.ChirpID]
+	if !ok {
+		reactions = map[int]Reaction{}
+		collection[reaction.ChirpID] = reactions
+	}
+	reactions[reaction.UserID] = reaction
+	if kind == ReactionRechirp {
+		dbStructure.indexRechirp(reaction)
+	}
+}
+
+func (dbStructure *DBStructure) removeReaction(kind ReactionKind, chirpID, userID int) {
+	collection := dbStructure.reactions(kind)
+	delete(collection[chirpID], userID)
+	if len(collection[chirpID]) == 0 {
+		delete(collection, chirpID)
+	}
+	if kind == ReactionRechirp {
+		delete(dbStructure.rechirpsByUser[userID], chirpID)
+	}
+}
+
+func (dbStructure *DBStructure) indexRechirp(rechirp Reaction) {
+	ids, ok := dbStructure.rechirpsByUser[rechirp.UserID]
+	if !ok {
+		ids = map[int]struct{}{}
+		dbStructure.rechirpsByUser[rechirp.UserID] = ids
+	}
+	ids[rechirp.ChirpID] = struct{}{}
+}
+
+func (dbStructure *DBStructure) putFollow(follow Follow) {
+	follows, ok := dbStructure.Follows[follow.FollowerID]
+	if !ok {
+		follows = map[int]Follow{}
+		dbStructure.Follows[follow.FollowerID] = follows
+	}
+	follows[follow.FolloweeID] = follow
+	dbStructure.indexFollow(follow.FollowerID, follow.FolloweeID)
+}
+
+func (dbStructure *DBStructure) removeFollow(followerID, followeeID int) {
+	delete(dbStructure.Follows[followerID], followeeID)
+	if len(dbStructure.Follows[followerID]) == 0 {
+		delete(dbStructure.Follows, followerID)
+	}
+	delete(dbStructure.followers[followeeID], followerID)
+}
+
+func (dbStructure *DBStructure) indexFollow(followerID, followeeID int) {
+	ids, ok := dbStructure.followers[followeeID]
+	if !ok {
+		ids = map[int]struct{}{}
+		dbStructure.followers[followeeID] = ids
+	}
+	ids[followerID] = struct{}{}
+}
+
+func (dbStructure *DBStructure) putRestriction(kind RestrictionKind, restriction Restriction) {
+	restrictions := dbStructure.restrictions(kind)
+	byTarget, ok := restrictions[restriction.UserID]
+	if !ok {
+		byTarget = map[int]Restriction{}
+		restrictions[restriction.UserID] = byTarget
+	}
+	byTarget[restriction.TargetID] = restriction
+	if kind == RestrictionBlock {
+		dbStructure.indexBlock(restriction.UserID, restriction.TargetID)
+	}
+}
+
+func (dbStructure *DBStructure) removeRestriction(kind RestrictionKind, userID, targetID int) {
+	restrictions := dbStructure.restrictions(kind)
+	delete(restrictions[userID], targetID)
+	if len(restrictions[userID]) == 0 {
+		delete(restrictions, userID)
+	}
+	if kind == RestrictionBlock {
+		delete(dbStructure.blockedBy[targetID], userID)
+	}
+}
+
+func (dbStructure *DBStructure) indexBlock(userID, targetID int) {
+	ids, ok := dbStructure.blockedBy[targetID]
+	if !ok {
+		ids = map[int]struct{}{}
+		dbStructure.blockedBy[targetID] = ids
+	}
+	ids[userID] = struct{}{}
+}
+
+func (dbStructure *DBStructure) putNotification(notification Notification) {
+	if old, ok := dbStructure.Notifications[notification.ID]; ok {
+		dbStructure.unindexNotification(old)
+	}
+	dbStructure.Notifications[notification.ID] = notification
+	dbStructure.indexNotification(notification)
+}
+
+func (dbStructure *DBStructure) removeNotification(id int) {
+	notification, ok := dbStructure.Notifications[id]
+	if !ok {
+		return
+	}
+	delete(dbStructure.Notifications, id)
+	dbStructure.unindexNotification(notification)
+}
+
+func (dbStructure *DBStructure) indexNotification(notification Notification) {
+	ids, ok := dbStructure.notificationsByUser[notification.UserID]
+	if !ok {
+		ids = map[int]struct{}{}
+		dbStructure.notificationsByUser[notification.UserID] = ids
+	}
+	ids[notification.ID] = struct{}{}
+	if notification.ChirpID != 0 {
+		ids, ok := dbStructure.notificationsByChirp[notification.ChirpID]
+		if !ok {
+			ids = map[int]struct{}{}
+			dbStructure.notificationsByChirp[notification.ChirpID] = ids
+		}
+		ids[notification.ID] = struct{}{}
+	}
+	if !notification.Read {
+		dbStructure.openNotifications[notification.key()] = notification.ID
+	}
+}
+
+func (dbStructure *DBStructure) unindexNotification(notification Notification) {
+	delete(dbStructure.notificationsByUser[notification.UserID], notification.ID)
+	delete(dbStructure.notificationsByChirp[notification.ChirpID], notification.ID)
+	if len(dbStructure.notificationsByChirp[notification.ChirpID]) == 0 {
+		delete(dbStructure.notificationsByChirp, notification.ChirpID)
+	}
+	if key := notification.key(); dbStructure.openNotifications[key] == notification.ID {
+		delete(dbStructure.openNotifications, key)
+	}
+}
+
+// putConversation stores a new conversation or an update to one. Members
+// never change, so the indexes only ever grow.
+func (dbStructure *DBStructure) putConversation(conversation Conversation) {
+	dbStructure.Conversations[conversation.ID] = conversation
+	dbStructure.indexConversation(conversation)
+}
+
+func (dbStructure *DBStructure) indexConversation(conversation Conversation) {
+	for _, userID := range conversation.MemberIDs {
+		ids, ok := dbStructure.conversationsByMember[userID]
+		if !ok {
+			ids = map[int]struct{}{}
+			dbStructure.conversationsByMember[userID] = ids
+		}
+		ids[conversation.ID] = struct{}{}
+	}
+	if conversation.Direct() {
+		dbStructure.directConversations[conversation.directKey()] = conversation.ID
+	}
+}
+
+func (dbStructure *DBStructure) putMessage(message Message) {
+	dbStructure.Messages[message.ID] = message
+	dbStructure.indexMessage(message)
+}
+
+func (dbStructure *DBStructure) indexMessage(message Message) {
+	ids, ok := dbStructure.messagesByConversation[message.ConversationID]
+	if !ok {
+		ids = map[int]struct{}{}
+		dbStructure.messagesByConversation[message.ConversationID] = ids
+	}
+	ids[message.ID] = struct{}{}
+}
+
+// mediaBySHA256 finds what uploaderID has uploaded with the given SHA-256.
+// Each uploader has their own media, even for the same image.
+func (dbStructure *DBStructure) mediaBySHA256(uploaderID int, sha256 string) (Media, bool) {
+	for id := range dbStructure.mediaBySHA[sha256] {
+		media := dbStructure.Media[id]
+		if media.UploaderID == uploaderID {
+			return media, true
+		}
+	}
+	return Media{}, false
+}
+
+func (dbStructure *DBStructure) putMedia(media Media) {
+	dbStructure.Media[media.ID] = media
+	dbStructure.indexMedia(media)
+}
+
+func (dbStructure *DBStructure) indexMedia(media Media) {
+	ids, ok := dbStructure.mediaBySHA[media.SHA256]
+	if !ok {
+		ids = map[int]struct{}{}
+		dbStructure.mediaBySHA[media.SHA256] = ids
+	}
+	ids[media.ID] = struct{}{}
+}
+
+func (dbStructure *DBStructure) removeMedia(id int) {
+	media, ok := dbStructure.Media[id]
+	if !ok {
+		return
+	}
+	delete(dbStructure.Media, id)
+	delete(dbStructure.mediaBySHA[media.SHA256], id)
+	if len(dbStructure.mediaBySHA[media.SHA256]) == 0 {
+		delete(dbStructure.mediaBySHA, media.SHA256)
+	}
+}
@@ -0,0 +1,231 @@
+package database
+
+import (
+	"sort"
+	"time"
+)
+
+// ChirpDraft is a chirp that hasn't been published yet. A draft with a
+// PublishAt time is scheduled and is published once that time comes; one
+// without waits for its author.
+type ChirpDraft struct {
+	ID        int       `json:"id"`
+	AuthorID  int       `json:"author_id"`
+	Body      string    `json:"body"`
+	InReplyTo int       `json:"in_reply_to,omitempty"`
+	MediaIDs  []int     `json:"media_ids,omitempty"`
+	PublishAt time.Time `json:"publish_at"`
+	// Error says why the draft couldn't be published when it was due. The
+	// draft is unscheduled, so it isn't retried until its author fixes it.
+	Error      string     `json:"error,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+	Visibility Visibility `json:"visibility"`
+}
+
+// Scheduled reports whether the draft has a publish time.
+func (draft ChirpDraft) Scheduled() bool {
+	return !draft.PublishAt.IsZero()
+}
+
+// CreateChirpDraft stores a new draft from the author, body, parent, media,
+// visibility and publish time of params. They are checked as they are by
+// CreateChirp.
+func (db *DB) CreateChirpDraft(params ChirpDraft) (ChirpDraft, error) {
+	visibility := params.Visibility.orPublic()
+	err := visibility.validate()
+	if err != nil {
+		return ChirpDraft{}, err
+	}
+
+	draft := ChirpDraft{}
+	err = db.Update(func(dbStructure *DBStructure) error {
+		err := dbStructure.checkReferences(params.AuthorID, params.InReplyTo, params.MediaIDs)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now().UTC()
+		draft = ChirpDraft{
+			ID:         dbStructure.nextID(sequenceDrafts),
+			AuthorID:   params.AuthorID,
+			Body:       params.Body,
+			InReplyTo:  params.InReplyTo,
+			MediaIDs:   params.MediaIDs,
+			PublishAt:  params.PublishAt.UTC(),
+			CreatedAt:  now,
+			UpdatedAt:  now,
+			Visibility: visibility,
+		}
+		dbStructure.ChirpDrafts[draft.ID] = draft
+		return nil
+	})
+	if err != nil {
+		return ChirpDraft{}, err
+	}
+
+	return draft, nil
+}
+
+func (db *DB) GetChirpDraft(id int) (ChirpDraft, error) {
+	draft := ChirpDraft{}
+	err := db.View(func(dbStructure *DBStructure) error {
+		var ok bool
+		draft, ok = dbStructure.ChirpDrafts[id]
+		if !ok {
+			return ErrNotExist
+		}
+		return nil
+	})
+	if err != nil {
+		return ChirpDraft{}, err
+	}
+
+	return draft, nil
+}
+
+// GetChirpDrafts lists the drafts of authorID, oldest first.
+func (db *DB) GetChirpDrafts(authorID int) ([]ChirpDraft, error) {
+	drafts := []ChirpDraft{}
+	err := db.View(func(dbStructure *DBStructure) error {
+		for _, draft := range dbStructure.ChirpDrafts {
+			if draft.AuthorID == authorID {
+				drafts = append(drafts, draft)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sortDrafts(drafts)
+	return drafts, nil
+}
+
+// GetDueChirpDrafts lists the scheduled drafts whose publish time is no later
+// than now, in the order they are due.
+func (db *DB) GetDueChirpDrafts(now time.Time) ([]ChirpDraft, error) {
+	drafts := []ChirpDraft{}
+	err := db.View(func(dbStructure *DBStructure) error {
+		for _, draft := range dbStructure.ChirpDrafts {
+			if draft.Scheduled() && !draft.PublishAt.After(now) {
+				drafts = append(drafts, draft)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(drafts, func(i, j int) bool {
+		if !drafts[i].PublishAt.Equal(drafts[j].PublishAt) {
+			return drafts[i].PublishAt.Before(drafts[j].PublishAt)
+		}
+		return drafts[i].ID < drafts[j].ID
+	})
+	return drafts, nil
+}
+
+// UpdateChirpDraft replaces the body, parent, media, visibility, publish
+// time and error of a draft.
+func (db *DB) UpdateChirpDraft(params ChirpDraft) (ChirpDraft, error) {
+	visibility := params.Visibility.orPublic()
+	err := visibility.validate()
+	if err != nil {
+		return ChirpDraft{}, err
+	}
+
+	draft := ChirpDraft{}
+	err = db.Update(func(dbStructure *DBStructure) error {
+		var ok bool
+		draft, ok = dbStructure.ChirpDrafts[params.ID]
+		if !ok {
+			return ErrNotExist
+		}
+		err := dbStructure.checkReferences(draft.AuthorID, params.InReplyTo, params.MediaIDs)
+		if err != nil {
+			return err
+		}
+
+		draft.Body = params.Body
+		draft.InReplyTo = params.InReplyTo
+		draft.MediaIDs = params.MediaIDs
+		draft.Visibility = visibility
+		draft.PublishAt = params.PublishAt.UTC()
+		draft.Error = params.Error
+		draft.UpdatedAt = time.Now().UTC()
+		dbStructure.ChirpDrafts[draft.ID] = draft
+		return nil
+	})
+	if err != nil {
+		return ChirpDraft{}, err
+	}
+
+	return draft, nil
+}
+
+// UnscheduleChirpDraft turns a scheduled draft that couldn't be published
+// back into a plain draft, recording why in its Error.
+func (db *DB) UnscheduleChirpDraft(id int, reason string) error {
+	return db.Update(func(dbStructure *DBStructure) error {
+		draft, ok := dbStructure.ChirpDrafts[id]
+		if !ok {
+			return ErrNotExist
+		}
+		draft.PublishAt = time.Time{}
+		draft.Error = reason
+		draft.UpdatedAt = time.Now().UTC()
+		dbStructure.ChirpDrafts[id] = draft
+		return nil
+	})
+}
+
+// DeleteChirpDraft removes a draft. Deleting a missing draft is not an error.
+func (db *DB) DeleteChirpDraft(id int) error {
+	return db.Update(func(dbStructure *DBStructure) error {
+		delete(dbStructure.ChirpDrafts, id)
+		return nil
+	})
+}
+
+// PublishChirpDraft turns a draft into a chirp with the given body, which
+// has been through validation again, and deletes the draft in the same
+// transaction, so a draft is published once or not at all. It returns
+// ErrNotExist if the draft is gone, for example because it has already been
+// published, and otherwise fails the way CreateChirp does.
+func (db *DB) PublishChirpDraft(id int, body string) (Chirp, error) {
+	chirp := Chirp{}
+	err := db.Update(func(dbStructure *DBStructure) error {
+		draft, ok := dbStructure.ChirpDrafts[id]
+		if !ok {
+			return ErrNotExist
+		}
+
+		var err error
+		chirp, err = dbStructure.insertChirp(Chirp{
+			AuthorID:   draft.AuthorID,
+			Body:       body,
+			InReplyTo:  draft.InReplyTo,
+			MediaIDs:   draft.MediaIDs,
+			Visibility: draft.Visibility,
+		})
+		if err != nil {
+			return err
+		}
+		delete(dbStructure.ChirpDrafts, id)
+		return nil
+	})
+	if err != nil {
+		return Chirp{}, err
+	}
+
+	return chirp, nil
+}
+
+func sortDrafts(drafts []ChirpDraft) {
+	sort.Slice(drafts, func(i, j int) bool {
+		return drafts[i].ID < drafts[j].ID
+	})
+}
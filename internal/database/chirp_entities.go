@@ -0,0 +1,187 @@
+package database
+
+import (
+	"math"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/brookwarren/chirpy/internal/entities"
+)
+
+// Hashtag is a hashtag in a chirp's body. Tag is normalised with
+// entities.NormalizeHashtag; Start and End are rune offsets into the body.
+type Hashtag struct {
+	Tag   string `json:"tag"`
+	Start int    `json:"start"`
+	End   int    `json:"end"`
+}
+
+// Mention is an @mention in a chirp's body. UserID is 0 if Username didn't
+// name anyone when the chirp was posted.
+type Mention struct {
+	Username string `json:"username"`
+	UserID   int    `json:"user_id,omitempty"`
+	Start    int    `json:"start"`
+	End      int    `json:"end"`
+}
+
+// parseEntities extracts the hashtags and mentions of body. resolve looks up
+// the user a mention names, returning 0 for nobody.
+func parseEntities(body string, resolve func(username string) (int, error)) ([]Hashtag, []Mention, error) {
+	hashtags := []Hashtag{}
+	mentions := []Mention{}
+	for _, entity := range entities.Parse(body) {
+		switch entity.Kind {
+		case entities.Hashtag:
+			hashtags = append(hashtags, Hashtag{
+				Tag:   entities.NormalizeHashtag(entity.Text),
+				Start: entity.Start,
+				End:   entity.End,
+			})
+		case entities.Mention:
+			userID, err := resolve(entity.Text)
+			if err != nil {
+				return nil, nil, err
+			}
+			mentions = append(mentions, Mention{
+				Username: entity.Text,
+				UserID:   userID,
+				Start:    entity.Start,
+				End:      entity.End,
+			})
+		}
+	}
+	return hashtags, mentions, nil
+}
+
+// tags returns the distinct tags of hashtags.
+func tags(hashtags []Hashtag) []string {
+	seen := map[string]bool{}
+	distinct := []string{}
+	for _, hashtag := range hashtags {
+		if !seen[hashtag.Tag] {
+			seen[hashtag.Tag] = true
+			distinct = append(distinct, hashtag.Tag)
+		}
+	}
+	return distinct
+}
+
+// mentionedUserIDs returns the distinct users that mentions resolved to.
+func mentionedUserIDs(mentions []Mention) []int {
+	seen := map[int]bool{}
+	distinct := []int{}
+	for _, mention := range mentions {
+		if mention.UserID != 0 && !seen[mention.UserID] {
+			seen[mention.UserID] = true
+			distinct = append(distinct, mention.UserID)
+		}
+	}
+	return distinct
+}
+
+// withoutEmailMentions returns mentions with those that name an email
+// address unresolved, along with the users they no longer mention at all.
+func withoutEmailMentions(mentions []Mention) ([]Mention, []int) {
+	before := mentionedUserIDs(mentions)
+	unresolved := slices.Clone(mentions)
+	for i, mention := range unresolved {
+		if strings.Contains(mention.Username, "@") {
+			unresolved[i].UserID = 0
+		}
+	}
+	after := mentionedUserIDs(unresolved)
+	unmentioned := []int{}
+	for _, userID := range before {
+		if !slices.Contains(after, userID) {
+			unmentioned = append(unmentioned, userID)
+		}
+	}
+	return unresolved, unmentioned
+}
+
+// TrendingHashtag is a hashtag ranked by TrendingHashtags.
+type TrendingHashtag struct {
+	Tag   string
+	Uses  int
+	Score float64
+}
+
+// hashtagUse is one chirp using a hashtag.
+type hashtagUse struct {
+	Tag       string
+	CreatedAt time.Time
+}
+
+// rankHashtags scores each tag by its uses, each worth 1 when it happens and
+// half as much every halfLife after that, and returns the top limit tags.
+func rankHashtags(uses []hashtagUse, now time.Time, halfLife time.Duration, limit int) []TrendingHashtag {
+	byTag := map[string]*TrendingHashtag{}
+	for _, use := range uses {
+		trending, ok := byTag[use.Tag]
+		if !ok {
+			trending = &TrendingHashtag{Tag: use.Tag}
+			byTag[use.Tag] = trending
+		}
+		age := max(now.Sub(use.CreatedAt), 0)
+		trending.Uses++
+		trending.Score += math.Pow(0.5, float64(age)/float64(halfLife))
+	}
+
+	ranked := make([]TrendingHashtag, 0, len(byTag))
+	for _, trending := range byTag {
+		ranked = append(ranked, *trending)
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+		if ranked[i].Score != ranked[j].Score {
+			return ranked[i].Score > ranked[j].Score
+		}
+		return ranked[i].Tag < ranked[j].Tag
+	})
+	if limit > 0 && len(ranked) > limit {
+		ranked = ranked[:limit]
+	}
+	return ranked
+}
+
+// TrendingHashtags ranks the hashtags used in the last window by recency-
+// weighted use; see rankHashtags. Only public chirps that haven't been
+// hidden count.
+func (db *DB) TrendingHashtags(window, halfLife time.Duration, limit int) ([]TrendingHashtag, error) {
+	now := time.Now().UTC()
+	since := now.Add(-window)
+	uses := []hashtagUse{}
+	err := db.View(func(dbStructure *DBStructure) error {
+		for tag, ids := range dbStructure.chirpsByTag {
+			for id := range ids {
+				chirp := dbStructure.Chirps[id]
+				if chirp.Visibility == VisibilityPublic && !chirp.Hidden && !chirp.CreatedAt.Before(since) {
+					uses = append(uses, hashtagUse{Tag: tag, CreatedAt: chirp.CreatedAt})
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return rankHashtags(uses, now, halfLife, limit), nil
+}
+
+// mentionResolver finds the users a chirp by authorID mentions, by handle
+// only: no handle contains an @, so mentions of email addresses are left
+// unresolved and can't reveal who signed up with one. Users blocked either
+// way by the author are left unresolved too, so the mention doesn't reach
+// them.
+func (dbStructure *DBStructure) mentionResolver(authorID int) func(username string) (int, error) {
+	return func(username string) (int, error) {
+		user, ok := dbStructure.userByHandle(username)
+		if !ok || dbStructure.blocked(authorID, user.ID) {
+			return 0, nil
+		}
+		return user.ID, nil
+	}
+}
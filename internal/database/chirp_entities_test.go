@@ -0,0 +1,39 @@
+package database
+
+import (
+	"testing"
+)
+
+// TestMentionsResolveByHandleOnly checks that mentioning someone's email
+// address doesn't resolve to them, which would reveal who signed up with it.
+func TestMentionsResolveByHandleOnly(t *testing.T) {
+	forEachStore(t, func(t *testing.T, db Store) {
+		author, err := db.CreateUser("author@example.com", "hash")
+		if err != nil {
+			t.Fatal(err)
+		}
+		victim, err := db.CreateUser("victim@example.com", "hash")
+		if err != nil {
+			t.Fatal(err)
+		}
+		handle := "victim"
+		_, err = db.UpdateUser(victim.ID, UserUpdate{Handle: &handle})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		chirp, err := db.CreateChirp(Chirp{AuthorID: author.ID, Body: "@victim@example.com @Victim"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(chirp.Mentions) != 2 {
+			t.Fatalf("got mentions %+v, want two", chirp.Mentions)
+		}
+		if chirp.Mentions[0].UserID != 0 {
+			t.Errorf("email mention resolved to user %d", chirp.Mentions[0].UserID)
+		}
+		if chirp.Mentions[1].UserID != victim.ID {
+			t.Errorf("handle mention resolved to user %d, want %d", chirp.Mentions[1].UserID, victim.ID)
+		}
+	})
+}
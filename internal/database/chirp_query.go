@@ -0,0 +1,315 @@
+package database
+
+import (
+	"errors"
+	"sort"
+	"time"
+)
+
+type ChirpSort string
+
+const (
+	ChirpSortID        ChirpSort = "id"
+	ChirpSortCreatedAt ChirpSort = "created_at"
+)
+
+// ChirpCursor is a position in a sorted list of chirps: the sort key and ID
+// of the chirp a page starts or ends at.
+type ChirpCursor struct {
+	CreatedAt time.Time
+	ID        int
+}
+
+// ChirpQuery selects a page of chirps. Zero values mean "no filter".
+type ChirpQuery struct {
+	AuthorIDs []int
+	// Hashtag, if set, must be normalised with entities.NormalizeHashtag.
+	Hashtag         string
+	MentionedUserID int
+	// Since is inclusive, Until is exclusive.
+	Since      time.Time
+	Until      time.Time
+	SortBy     ChirpSort
+	Descending bool
+	Limit      int
+	// At most one of After and Before may be set. After returns the chirps
+	// that follow the cursor in sort order, Before the ones that precede it.
+	After  *ChirpCursor
+	Before *ChirpCursor
+	// IncludeRechirps also selects the chirps AuthorIDs have rechirped. A
+	// chirp is placed, for sorting and for Since and Until, at its latest
+	// rechirp by one of them if that is later than when it was posted.
+	IncludeRechirps bool
+	// ViewerID leaves out the chirps and rechirps of users blocked either
+	// way by the viewer, and HideMuted those of users the viewer muted too.
+	// It also leaves out the chirps whose visibility doesn't let the viewer
+	// see them, and other people's unlisted chirps unless the query is
+	// scoped to authors or a mention. 0 is an anonymous viewer, who isn't
+	// blocked by anyone and follows no one.
+	ViewerID  int
+	HideMuted bool
+
+	// hidden is the users ViewerID and HideMuted leave out, filled in by
+	// hide, and following the users ViewerID follows.
+	hidden    map[int]struct{}
+	following map[int]struct{}
+}
+
+// ChirpPage is one page of a ChirpQuery, in sort order.
+type ChirpPage struct {
+	Chirps  []Chirp
+	HasPrev bool
+	HasNext bool
+	// Rechirps holds the rechirp that placed each chirp, for the chirps that
+	// were placed by one.
+	Rechirps map[int]Reaction
+}
+
+// Cursor returns the position of the i'th chirp of the page.
+func (p ChirpPage) Cursor(i int) ChirpCursor {
+	return positionOf(p.Chirps[i], p.Rechirps)
+}
+
+var ErrInvalidQuery = errors.New("invalid query")
+
+func (q ChirpQuery) validate() error {
+	if q.After != nil && q.Before != nil {
+		return ErrInvalidQuery
+	}
+	if q.SortBy != "" && q.SortBy != ChirpSortID && q.SortBy != ChirpSortCreatedAt {
+		return ErrInvalidQuery
+	}
+	if q.Limit < 0 {
+		return ErrInvalidQuery
+	}
+	return nil
+}
+
+// hide drops the users in hidden from the query's authors and leaves out
+// their chirps. It reports false if that leaves none of the authors the
+// query asked for, in which case it selects nothing.
+func (q ChirpQuery) hide(hidden map[int]struct{}) (ChirpQuery, bool) {
+	q.hidden = hidden
+	if len(q.AuthorIDs) == 0 || len(hidden) == 0 {
+		return q, true
+	}
+	authorIDs := []int{}
+	for _, authorID := range q.AuthorIDs {
+		if _, ok := hidden[authorID]; !ok {
+			authorIDs = append(authorIDs, authorID)
+		}
+	}
+	q.AuthorIDs = authorIDs
+	return q, len(authorIDs) > 0
+}
+
+// scoped reports whether the query lists particular authors' chirps or
+// mentions, which include unlisted chirps.
+func (q ChirpQuery) scoped() bool {
+	return len(q.AuthorIDs) > 0 || q.MentionedUserID != 0
+}
+
+// selects reports whether chirp has the hashtag and mention the query asks
+// for, is listed for the viewer and isn't by a hidden user.
+func (q ChirpQuery) selects(chirp Chirp) bool {
+	if _, ok := q.hidden[chirp.AuthorID]; ok {
+		return false
+	}
+	if !chirp.listedFor(q.ViewerID, q.following, q.scoped()) {
+		return false
+	}
+	if q.Hashtag != "" && !containsFunc(chirp.Hashtags, func(h Hashtag) bool { return h.Tag == q.Hashtag }) {
+		return false
+	}
+	if q.MentionedUserID != 0 && !containsFunc(chirp.Mentions, func(m Mention) bool { return m.UserID == q.MentionedUserID }) {
+		return false
+	}
+	return true
+}
+
+func containsFunc[T any](items []T, match func(T) bool) bool {
+	for _, item := range items {
+		if match(item) {
+			return true
+		}
+	}
+	return false
+}
+
+// matches reports whether a chirp placed at position is within Since and
+// Until.
+func (q ChirpQuery) matches(position ChirpCursor) bool {
+	if !q.Since.IsZero() && position.CreatedAt.Before(q.Since) {
+		return false
+	}
+	if !q.Until.IsZero() && !position.CreatedAt.Before(q.Until) {
+		return false
+	}
+	return true
+}
+
+// less orders chirps by the query's sort key, breaking ties on ID.
+func (q ChirpQuery) less(a, b ChirpCursor) bool {
+	if q.SortBy == ChirpSortCreatedAt && !a.CreatedAt.Equal(b.CreatedAt) {
+		if q.Descending {
+			return a.CreatedAt.After(b.CreatedAt)
+		}
+		return a.CreatedAt.Before(b.CreatedAt)
+	}
+	if q.Descending {
+		return a.ID > b.ID
+	}
+	return a.ID < b.ID
+}
+
+func cursorOf(chirp Chirp) ChirpCursor {
+	return ChirpCursor{CreatedAt: chirp.CreatedAt, ID: chirp.ID}
+}
+
+// positionOf places a chirp at the rechirp in rechirps that selected it, if
+// there is one, and otherwise at the time it was posted.
+func positionOf(chirp Chirp, rechirps map[int]Reaction) ChirpCursor {
+	if rechirp, ok := rechirps[chirp.ID]; ok {
+		return ChirpCursor{CreatedAt: rechirp.CreatedAt, ID: chirp.ID}
+	}
+	return cursorOf(chirp)
+}
+
+// feedRechirp picks the rechirp that places chirp in a feed of authors: the
+// latest of rechirps, all of which are by authors, unless the chirp is one of
+// theirs and was posted later still.
+func feedRechirp(chirp Chirp, authors map[int]struct{}, rechirps []Reaction) (Reaction, bool) {
+	latest := Reaction{}
+	for _, rechirp := range rechirps {
+		if rechirp.CreatedAt.After(latest.CreatedAt) {
+			latest = rechirp
+		}
+	}
+	if latest.UserID == 0 {
+		return Reaction{}, false
+	}
+	if _, ok := authors[chirp.AuthorID]; ok && !latest.CreatedAt.After(chirp.CreatedAt) {
+		return Reaction{}, false
+	}
+	return latest, true
+}
+
+// paginate picks the requested page out of chirps, which must already be
+// filtered and sorted by their positions.
+func (q ChirpQuery) paginate(chirps []Chirp, rechirps map[int]Reaction) ChirpPage {
+	start, end := 0, len(chirps)
+	if q.After != nil {
+		start = sort.Search(len(chirps), func(i int) bool {
+			return q.less(*q.After, positionOf(chirps[i], rechirps))
+		})
+	}
+	if q.Before != nil {
+		end = sort.Search(len(chirps), func(i int) bool {
+			return !q.less(positionOf(chirps[i], rechirps), *q.Before)
+		})
+	}
+	if q.Limit > 0 && end-start > q.Limit {
+		if q.Before != nil {
+			start = end - q.Limit
+		} else {
+			end = start + q.Limit
+		}
+	}
+
+	page := ChirpPage{
+		Chirps:   chirps[start:end],
+		HasPrev:  start > 0,
+		HasNext:  end < len(chirps),
+		Rechirps: map[int]Reaction{},
+	}
+	for _, chirp := range page.Chirps {
+		if rechirp, ok := rechirps[chirp.ID]; ok {
+			page.Rechirps[chirp.ID] = rechirp
+		}
+	}
+	return page
+}
+
+func (db *DB) QueryChirps(q ChirpQuery) (ChirpPage, error) {
+	err := q.validate()
+	if err != nil {
+		return ChirpPage{}, err
+	}
+
+	chirps := []Chirp{}
+	rechirps := map[int]Reaction{}
+	err = db.View(func(dbStructure *DBStructure) error {
+		var ok bool
+		q, ok = q.hide(dbStructure.hiddenFrom(q.ViewerID, q.HideMuted))
+		if !ok {
+			return nil
+		}
+		q.following = dbStructure.following(q.ViewerID)
+		if len(q.AuthorIDs) == 0 {
+			for id := range dbStructure.candidateChirps(q) {
+				chirp := dbStructure.Chirps[id]
+				if q.selects(chirp) && q.matches(cursorOf(chirp)) {
+					chirps = append(chirps, chirp)
+				}
+			}
+			return nil
+		}
+
+		authors := map[int]struct{}{}
+		candidates := map[int]struct{}{}
+		for _, authorID := range q.AuthorIDs {
+			authors[authorID] = struct{}{}
+			for id := range dbStructure.chirpsByAuthor[authorID] {
+				candidates[id] = struct{}{}
+			}
+			if q.IncludeRechirps {
+				for id := range dbStructure.rechirpsByUser[authorID] {
+					candidates[id] = struct{}{}
+				}
+			}
+		}
+
+		for id := range candidates {
+			chirp := dbStructure.Chirps[id]
+			if q.IncludeRechirps {
+				byAuthors := []Reaction{}
+				for userID, rechirp := range dbStructure.Rechirps[id] {
+					if _, ok := authors[userID]; ok {
+						byAuthors = append(byAuthors, rechirp)
+					}
+				}
+				if rechirp, ok := feedRechirp(chirp, authors, byAuthors); ok {
+					rechirps[id] = rechirp
+				}
+			}
+			if q.selects(chirp) && q.matches(positionOf(chirp, rechirps)) {
+				chirps = append(chirps, chirp)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return ChirpPage{}, err
+	}
+
+	sort.Slice(chirps, func(i, j int) bool {
+		return q.less(positionOf(chirps[i], rechirps), positionOf(chirps[j], rechirps))
+	})
+	return q.paginate(chirps, rechirps), nil
+}
+
+// candidateChirps narrows down the chirps a query without authors could
+// select using the hashtag and mention indexes.
+func (dbStructure *DBStructure) candidateChirps(q ChirpQuery) map[int]struct{} {
+	if q.Hashtag != "" {
+		return dbStructure.chirpsByTag[q.Hashtag]
+	}
+	if q.MentionedUserID != 0 {
+		return dbStructure.mentionsOf[q.MentionedUserID]
+	}
+	candidates := make(map[int]struct{}, len(dbStructure.Chirps))
+	for id := range dbStructure.Chirps {
+		candidates[id] = struct{}{}
+	}
+	return candidates
+}
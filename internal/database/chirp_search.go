@@ -0,0 +1,85 @@
+package database
+
+import (
+	"sort"
+
+	"github.com/brookwarren/chirpy/internal/search"
+)
+
+// ChirpSortRelevance orders search results by how well they match.
+const ChirpSortRelevance ChirpSort = "relevance"
+
+// ChirpSearch is a full-text query over chirp bodies. See search.ParseQuery
+// for the query syntax.
+type ChirpSearch struct {
+	Query      string
+	AuthorIDs  []int
+	SortBy     ChirpSort
+	Descending bool
+	Limit      int
+	// ViewerID and HideMuted leave out chirps as they do in a ChirpQuery,
+	// except that other people's unlisted chirps are never found.
+	ViewerID  int
+	HideMuted bool
+}
+
+// rank turns index matches into the chirps the search asked for, leaving
+// out those by hidden users and those not listed for a viewer following the
+// users in following. lookup returns the stored chirp for an ID.
+func (s ChirpSearch) rank(matches []search.Match, lookup func(id int) (Chirp, bool), hidden, following map[int]struct{}) []Chirp {
+	authors := map[int]struct{}{}
+	for _, authorID := range s.AuthorIDs {
+		authors[authorID] = struct{}{}
+	}
+
+	chirps := []Chirp{}
+	for _, match := range matches {
+		chirp, ok := lookup(match.ID)
+		if !ok {
+			continue
+		}
+		if _, ok := authors[chirp.AuthorID]; len(authors) > 0 && !ok {
+			continue
+		}
+		if _, ok := hidden[chirp.AuthorID]; ok {
+			continue
+		}
+		if !chirp.listedFor(s.ViewerID, following, false) {
+			continue
+		}
+		chirps = append(chirps, chirp)
+	}
+
+	if s.SortBy != "" && s.SortBy != ChirpSortRelevance {
+		q := ChirpQuery{SortBy: s.SortBy, Descending: s.Descending}
+		sort.SliceStable(chirps, func(i, j int) bool {
+			return q.less(cursorOf(chirps[i]), cursorOf(chirps[j]))
+		})
+	}
+	if s.Limit > 0 && len(chirps) > s.Limit {
+		chirps = chirps[:s.Limit]
+	}
+	return chirps
+}
+
+func (db *DB) SearchChirps(s ChirpSearch) ([]Chirp, error) {
+	q, err := search.ParseQuery(s.Query)
+	if err != nil {
+		return nil, err
+	}
+
+	chirps := []Chirp{}
+	err = db.View(func(dbStructure *DBStructure) error {
+		matches := dbStructure.searchIndex.Search(q)
+		chirps = s.rank(matches, func(id int) (Chirp, bool) {
+			chirp, ok := dbStructure.Chirps[id]
+			return chirp, ok
+		}, dbStructure.hiddenFrom(s.ViewerID, s.HideMuted), dbStructure.following(s.ViewerID))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return chirps, nil
+}
@@ -1,72 +1,252 @@
 package database
 
+import (
+	"errors"
+	"time"
+)
+
+// ErrParentNotExist is returned for a reply to a chirp that doesn't exist.
+var ErrParentNotExist = errors.New("chirp being replied to does not exist")
+
 type Chirp struct {
-	ID       int    `json:"id"`
-	AuthorID int    `json:"author_id"`
-	Body     string `json:"body"`
+	ID        int       `json:"id"`
+	AuthorID  int       `json:"author_id"`
+	Body      string    `json:"body"`
+	InReplyTo int       `json:"in_reply_to,omitempty"`
+	Hashtags  []Hashtag `json:"hashtags,omitempty"`
+	Mentions  []Mention `json:"mentions,omitempty"`
+	MediaIDs  []int     `json:"media_ids,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	// Visibility is public if unset when the chirp is created.
+	Visibility Visibility `json:"visibility"`
+	// Hidden chirps have been taken down by a moderator. Only their authors
+	// still see them.
+	Hidden bool `json:"hidden,omitempty"`
+}
+
+// ChirpRevision is one version of a chirp's body. Version 1 is the body the
+// chirp was created with; every edit adds the next version.
+type ChirpRevision struct {
+	Version   int       `json:"version"`
+	Body      string    `json:"body"`
+	CreatedAt time.Time `json:"created_at"`
 }
 
-func (db *DB) CreateChirp(body string, authorID int) (Chirp, error) {
-	dbStructure, err := db.loadDB()
+// CreateChirp stores a new chirp from the author, body, parent, media and
+// visibility of params; the ID, timestamps, hashtags and mentions are filled
+// in here. A reply's parent must exist and be visible to the author, or
+// ErrParentNotExist is returned, and every attached media must exist and be
+// the author's own, or ErrMediaNotExist is returned. Replying to someone blocked either way
+// returns ErrBlocked, and an unknown visibility ErrInvalidVisibility.
+func (db *DB) CreateChirp(params Chirp) (Chirp, error) {
+	chirp := Chirp{}
+	err := db.Update(func(dbStructure *DBStructure) error {
+		var err error
+		chirp, err = dbStructure.insertChirp(params)
+		return err
+	})
 	if err != nil {
 		return Chirp{}, err
 	}
 
-	id := len(dbStructure.Chirps) + 1
-	chirp := Chirp{
-		ID:       id,
-		Body:     body,
-		AuthorID: authorID,
+	return chirp, nil
+}
+
+func (dbStructure *DBStructure) insertChirp(params Chirp) (Chirp, error) {
+	visibility := params.Visibility.orPublic()
+	err := visibility.validate()
+	if err != nil {
+		return Chirp{}, err
+	}
+	err = dbStructure.checkReferences(params.AuthorID, params.InReplyTo, params.MediaIDs)
+	if err != nil {
+		return Chirp{}, err
 	}
-	dbStructure.Chirps[id] = chirp
 
-	err = db.writeDB(dbStructure)
+	hashtags, mentions, err := parseEntities(params.Body, dbStructure.mentionResolver(params.AuthorID))
 	if err != nil {
 		return Chirp{}, err
 	}
 
+	id := dbStructure.nextID(sequenceChirps)
+	now := time.Now().UTC()
+	chirp := Chirp{
+		ID:         id,
+		Body:       params.Body,
+		AuthorID:   params.AuthorID,
+		InReplyTo:  params.InReplyTo,
+		Hashtags:   hashtags,
+		Mentions:   mentions,
+		MediaIDs:   params.MediaIDs,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+		Visibility: visibility,
+	}
+	dbStructure.putChirp(chirp)
+	dbStructure.ChirpRevisions[id] = []ChirpRevision{{
+		Version:   1,
+		Body:      chirp.Body,
+		CreatedAt: now,
+	}}
+	dbStructure.notifyChirp(chirp)
 	return chirp, nil
 }
 
+// checkReferences makes sure the chirp a new chirp by authorID replies to
+// exists and is visible to them, that the media it attaches are theirs, and
+// that the author of the parent and authorID haven't blocked each other.
+func (dbStructure *DBStructure) checkReferences(authorID, inReplyTo int, mediaIDs []int) error {
+	if inReplyTo != 0 {
+		parent, ok := dbStructure.Chirps[inReplyTo]
+		if !ok || !parent.visibleTo(authorID, dbStructure.following(authorID)) {
+			return ErrParentNotExist
+		}
+		if dbStructure.blocked(authorID, parent.AuthorID) {
+			return ErrBlocked
+		}
+	}
+	return dbStructure.checkMediaIDs(authorID, mediaIDs)
+}
+
 func (db *DB) GetChirps() ([]Chirp, error) {
-	dbStructure, err := db.loadDB()
+	chirps := []Chirp{}
+	err := db.View(func(dbStructure *DBStructure) error {
+		chirps = make([]Chirp, 0, len(dbStructure.Chirps))
+		for _, chirp := range dbStructure.Chirps {
+			chirps = append(chirps, chirp)
+		}
+		return nil
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	chirps := make([]Chirp, 0, len(dbStructure.Chirps))
-	for _, chirp := range dbStructure.Chirps {
-		chirps = append(chirps, chirp)
-	}
-
 	return chirps, nil
 }
 
 func (db *DB) GetChirp(id int) (Chirp, error) {
-	dbStructure, err := db.loadDB()
+	chirp := Chirp{}
+	err := db.View(func(dbStructure *DBStructure) error {
+		var ok bool
+		chirp, ok = dbStructure.Chirps[id]
+		if !ok {
+			return ErrNotExist
+		}
+		return nil
+	})
 	if err != nil {
 		return Chirp{}, err
 	}
 
-	chirp, ok := dbStructure.Chirps[id]
-	if !ok {
-		return Chirp{}, ErrNotExist
-	}
-
 	return chirp, nil
 }
 
-func (db *DB) DeleteChirp(id int) error {
-	dbStructure, err := db.loadDB()
+// UpdateChirp replaces the body of a chirp and records the new version in
+// its history. Users the new body mentions for the first time are notified.
+func (db *DB) UpdateChirp(id int, body string) (Chirp, error) {
+	chirp := Chirp{}
+	err := db.Update(func(dbStructure *DBStructure) error {
+		var ok bool
+		chirp, ok = dbStructure.Chirps[id]
+		if !ok {
+			return ErrNotExist
+		}
+
+		hashtags, mentions, err := parseEntities(body, dbStructure.mentionResolver(chirp.AuthorID))
+		if err != nil {
+			return err
+		}
+
+		now := time.Now().UTC()
+		mentioned := mentionedUserIDs(chirp.Mentions)
+		chirp.Body = body
+		chirp.Hashtags = hashtags
+		chirp.Mentions = mentions
+		chirp.UpdatedAt = now
+		dbStructure.putChirp(chirp)
+		dbStructure.notifyMentions(chirp, mentioned)
+
+		revisions := dbStructure.ChirpRevisions[id]
+		dbStructure.ChirpRevisions[id] = append(revisions, ChirpRevision{
+			Version:   len(revisions) + 1,
+			Body:      body,
+			CreatedAt: now,
+		})
+		return nil
+	})
 	if err != nil {
-		return err
+		return Chirp{}, err
 	}
 
-	delete(dbStructure.Chirps, id)
-	err = db.writeDB(dbStructure)
+	return chirp, nil
+}
+
+// GetChirpHistory returns every version of a chirp, oldest first.
+func (db *DB) GetChirpHistory(id int) ([]ChirpRevision, error) {
+	revisions := []ChirpRevision{}
+	err := db.View(func(dbStructure *DBStructure) error {
+		if _, ok := dbStructure.Chirps[id]; !ok {
+			return ErrNotExist
+		}
+		revisions = append(revisions, dbStructure.ChirpRevisions[id]...)
+		return nil
+	})
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	return nil
+	return revisions, nil
+}
+
+// DeleteChirp removes a chirp and its history. A chirp with replies leaves a
+// tombstone behind so the replies stay attached to their conversation.
+func (db *DB) DeleteChirp(id int) error {
+	return db.Update(func(dbStructure *DBStructure) error {
+		chirp, ok := dbStructure.Chirps[id]
+		if !ok {
+			return nil
+		}
+		dbStructure.deleteChirp(chirp)
+		return nil
+	})
+}
+
+// DeleteChirpAsModerator is DeleteChirp for a moderator deleting someone
+// else's chirp, which is recorded in the moderation log with reason.
+// moderatorID's role must be above the author's, or ErrOutranked is
+// returned.
+func (db *DB) DeleteChirpAsModerator(id, moderatorID int, reason string) error {
+	return db.Update(func(dbStructure *DBStructure) error {
+		chirp, ok := dbStructure.Chirps[id]
+		if !ok {
+			return ErrNotExist
+		}
+		err := dbStructure.checkOutranks(moderatorID, chirp.AuthorID)
+		if err != nil {
+			return err
+		}
+		dbStructure.deleteChirp(chirp)
+		dbStructure.logModeration(ModerationAction{
+			ModeratorID: moderatorID,
+			Kind:        ModerationDeleteChirp,
+			ChirpID:     id,
+			UserID:      chirp.AuthorID,
+			Reason:      reason,
+			CreatedAt:   time.Now().UTC(),
+		})
+		return nil
+	})
+}
+
+func (dbStructure *DBStructure) deleteChirp(chirp Chirp) {
+	dbStructure.removeChirp(chirp.ID)
+	delete(dbStructure.ChirpRevisions, chirp.ID)
+	if len(dbStructure.replies[chirp.ID]) > 0 {
+		dbStructure.putTombstone(ChirpTombstone{
+			ID:        chirp.ID,
+			InReplyTo: chirp.InReplyTo,
+			DeletedAt: time.Now().UTC(),
+		})
+	}
 }
@@ -0,0 +1,87 @@
+package database
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+// TestConcurrentCreateChirp fires parallel chirp creates at one store and
+// checks none of them are lost or share an ID. Run it with -race.
+func TestConcurrentCreateChirp(t *testing.T) {
+	forEachStore(t, func(t *testing.T, db Store) {
+		user, err := db.CreateUser("a@example.com", "hash")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		const n = 50
+		var wg sync.WaitGroup
+		errs := make(chan error, n)
+		for i := 0; i < n; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				_, err := db.CreateChirp(Chirp{AuthorID: user.ID, Body: fmt.Sprintf("chirp %d", i)})
+				if err != nil {
+					errs <- err
+				}
+			}(i)
+		}
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			t.Error(err)
+		}
+
+		chirps, err := db.GetChirps()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(chirps) != n {
+			t.Fatalf("got %d chirps, want %d", len(chirps), n)
+		}
+		ids := map[int]struct{}{}
+		for _, chirp := range chirps {
+			if _, ok := ids[chirp.ID]; ok {
+				t.Fatalf("chirp ID %d is used twice", chirp.ID)
+			}
+			ids[chirp.ID] = struct{}{}
+		}
+	})
+}
+
+// TestConcurrentResetAndSearch resets a store while searches are running.
+// Run it with -race.
+func TestConcurrentResetAndSearch(t *testing.T) {
+	forEachStore(t, func(t *testing.T, db Store) {
+		user, err := db.CreateUser("a@example.com", "hash")
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = db.CreateChirp(Chirp{AuthorID: user.ID, Body: "hello"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var wg sync.WaitGroup
+		for i := 0; i < 4; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 20; j++ {
+					_, err := db.SearchChirps(ChirpSearch{Query: "hello"})
+					if err != nil {
+						t.Error(err)
+						return
+					}
+				}
+			}()
+		}
+		err = db.ResetDB()
+		if err != nil {
+			t.Error(err)
+		}
+		wg.Wait()
+	})
+}
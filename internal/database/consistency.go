@@ -0,0 +1,195 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// checkConsistency looks for data the API could never have produced, such as
+// two users sharing an email, which would make later lookups ambiguous.
+func (dbStructure *DBStructure) checkConsistency() error {
+	problems := []error{}
+
+	emails := map[string]int{}
+	handles := map[string]int{}
+	for _, id := range sortedKeys(dbStructure.Users) {
+		user := dbStructure.Users[id]
+		if user.ID != id {
+			problems = append(problems, fmt.Errorf("user stored under key %d has id %d", id, user.ID))
+		}
+		if other, ok := emails[user.Email]; ok {
+			problems = append(problems, fmt.Errorf("users %d and %d share the email %q", other, id, user.Email))
+		}
+		emails[user.Email] = id
+		if user.Handle != "" {
+			if other, ok := handles[handleKey(user.Handle)]; ok {
+				problems = append(problems, fmt.Errorf("users %d and %d share the handle %q", other, id, user.Handle))
+			}
+			handles[handleKey(user.Handle)] = id
+		}
+		if id > dbStructure.Sequences[sequenceUsers] {
+			problems = append(problems, fmt.Errorf("user %d is ahead of the users sequence", id))
+		}
+		if user.Role.validate() != nil {
+			problems = append(problems, fmt.Errorf("user %d has invalid role %q", id, user.Role))
+		}
+	}
+
+	for _, id := range sortedKeys(dbStructure.Chirps) {
+		chirp := dbStructure.Chirps[id]
+		if chirp.ID != id {
+			problems = append(problems, fmt.Errorf("chirp stored under key %d has id %d", id, chirp.ID))
+		}
+		if id > dbStructure.Sequences[sequenceChirps] {
+			problems = append(problems, fmt.Errorf("chirp %d is ahead of the chirps sequence", id))
+		}
+		if chirp.Visibility.validate() != nil {
+			problems = append(problems, fmt.Errorf("chirp %d has invalid visibility %q", id, chirp.Visibility))
+		}
+		for _, mediaID := range chirp.MediaIDs {
+			if _, ok := dbStructure.Media[mediaID]; !ok {
+				problems = append(problems, fmt.Errorf("chirp %d refers to missing media %d", id, mediaID))
+			}
+		}
+	}
+
+	for _, id := range sortedKeys(dbStructure.ChirpDrafts) {
+		draft := dbStructure.ChirpDrafts[id]
+		if draft.ID != id {
+			problems = append(problems, fmt.Errorf("draft stored under key %d has id %d", id, draft.ID))
+		}
+		if id > dbStructure.Sequences[sequenceDrafts] {
+			problems = append(problems, fmt.Errorf("draft %d is ahead of the drafts sequence", id))
+		}
+	}
+
+	open := map[notificationKey]int{}
+	for _, id := range sortedKeys(dbStructure.Notifications) {
+		notification := dbStructure.Notifications[id]
+		if notification.ID != id {
+			problems = append(problems, fmt.Errorf("notification stored under key %d has id %d", id, notification.ID))
+		}
+		if id > dbStructure.Sequences[sequenceNotifications] {
+			problems = append(problems, fmt.Errorf("notification %d is ahead of the notifications sequence", id))
+		}
+		if notification.Read {
+			continue
+		}
+		if other, ok := open[notification.key()]; ok {
+			problems = append(problems, fmt.Errorf("notifications %d and %d are both unread for the same group", other, id))
+		}
+		open[notification.key()] = id
+	}
+
+	for _, id := range sortedKeys(dbStructure.Conversations) {
+		conversation := dbStructure.Conversations[id]
+		if conversation.ID != id {
+			problems = append(problems, fmt.Errorf("conversation stored under key %d has id %d", id, conversation.ID))
+		}
+		if id > dbStructure.Sequences[sequenceConversations] {
+			problems = append(problems, fmt.Errorf("conversation %d is ahead of the conversations sequence", id))
+		}
+	}
+	for _, id := range sortedKeys(dbStructure.Messages) {
+		message := dbStructure.Messages[id]
+		if message.ID != id {
+			problems = append(problems, fmt.Errorf("message stored under key %d has id %d", id, message.ID))
+		}
+		if id > dbStructure.Sequences[sequenceMessages] {
+			problems = append(problems, fmt.Errorf("message %d is ahead of the messages sequence", id))
+		}
+		if _, ok := dbStructure.Conversations[message.ConversationID]; !ok {
+			problems = append(problems, fmt.Errorf("message %d belongs to missing conversation %d", id, message.ConversationID))
+		}
+	}
+
+	for _, id := range sortedKeys(dbStructure.Reports) {
+		report := dbStructure.Reports[id]
+		if report.ID != id {
+			problems = append(problems, fmt.Errorf("report stored under key %d has id %d", id, report.ID))
+		}
+		if id > dbStructure.Sequences[sequenceReports] {
+			problems = append(problems, fmt.Errorf("report %d is ahead of the reports sequence", id))
+		}
+		if report.Status.validate() != nil {
+			problems = append(problems, fmt.Errorf("report %d has invalid status %q", id, report.Status))
+		}
+	}
+	for _, id := range sortedKeys(dbStructure.ModerationLog) {
+		action := dbStructure.ModerationLog[id]
+		if action.ID != id {
+			problems = append(problems, fmt.Errorf("moderation log entry stored under key %d has id %d", id, action.ID))
+		}
+		if id > dbStructure.Sequences[sequenceModerationLog] {
+			problems = append(problems, fmt.Errorf("moderation log entry %d is ahead of the moderation log sequence", id))
+		}
+		if action.Kind == ModerationSetRole && action.Role.validate() != nil {
+			problems = append(problems, fmt.Errorf("moderation log entry %d has invalid role %q", id, action.Role))
+		}
+	}
+
+	type upload struct {
+		uploaderID int
+		sha256     string
+	}
+	uploads := map[upload]int{}
+	for _, id := range sortedKeys(dbStructure.Media) {
+		media := dbStructure.Media[id]
+		if media.ID != id {
+			problems = append(problems, fmt.Errorf("media stored under key %d has id %d", id, media.ID))
+		}
+		key := upload{media.UploaderID, media.SHA256}
+		if other, ok := uploads[key]; ok {
+			problems = append(problems, fmt.Errorf(
+				"media %d and %d by user %d share the SHA-256 %s", other, id, media.UploaderID, media.SHA256,
+			))
+		}
+		uploads[key] = id
+		if id > dbStructure.Sequences[sequenceMedia] {
+			problems = append(problems, fmt.Errorf("media %d is ahead of the media sequence", id))
+		}
+	}
+
+	for _, followerID := range sortedKeys(dbStructure.Follows) {
+		follows := dbStructure.Follows[followerID]
+		for _, followeeID := range sortedKeys(follows) {
+			follow := follows[followeeID]
+			if follow.FollowerID != followerID || follow.FolloweeID != followeeID {
+				problems = append(problems, fmt.Errorf(
+					"follow stored under %d->%d is %d->%d",
+					followerID, followeeID, follow.FollowerID, follow.FolloweeID,
+				))
+			}
+		}
+	}
+
+	for _, kind := range []RestrictionKind{RestrictionBlock, RestrictionMute} {
+		restrictions := dbStructure.restrictions(kind)
+		for _, userID := range sortedKeys(restrictions) {
+			for _, targetID := range sortedKeys(restrictions[userID]) {
+				restriction := restrictions[userID][targetID]
+				if restriction.UserID != userID || restriction.TargetID != targetID {
+					problems = append(problems, fmt.Errorf(
+						"%s stored under %d->%d is %d->%d",
+						kind, userID, targetID, restriction.UserID, restriction.TargetID,
+					))
+				}
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("database is inconsistent: %w", errors.Join(problems...))
+	}
+	return nil
+}
+
+func sortedKeys[V any](m map[int]V) []int {
+	keys := make([]int, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Ints(keys)
+	return keys
+}
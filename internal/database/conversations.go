@@ -0,0 +1,220 @@
+package database
+
+import (
+	"sort"
+	"time"
+)
+
+// Conversation is a private exchange of messages between its members. A
+// conversation between exactly two users is direct, and there is at most
+// one of those per pair.
+type Conversation struct {
+	ID        int `json:"id"`
+	CreatorID int `json:"creator_id"`
+	// MemberIDs are sorted and include the creator.
+	MemberIDs []int     `json:"member_ids"`
+	CreatedAt time.Time `json:"created_at"`
+	// UpdatedAt is when the last message was sent, or CreatedAt before then.
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Message is one message of a conversation.
+type Message struct {
+	ID             int       `json:"id"`
+	ConversationID int       `json:"conversation_id"`
+	SenderID       int       `json:"sender_id"`
+	Body           string    `json:"body"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// MessageQuery selects a page of a conversation's messages, newest first.
+type MessageQuery struct {
+	ConversationID int
+	Limit          int
+	// BeforeID, if set, returns the messages older than that message.
+	BeforeID int
+}
+
+// MessagePage is one page of a MessageQuery.
+type MessagePage struct {
+	Messages []Message
+	HasNext  bool
+}
+
+// HasMember reports whether userID is in the conversation.
+func (conversation Conversation) HasMember(userID int) bool {
+	return containsFunc(conversation.MemberIDs, func(id int) bool { return id == userID })
+}
+
+// Direct reports whether the conversation is between two users.
+func (conversation Conversation) Direct() bool {
+	return len(conversation.MemberIDs) == 2
+}
+
+// conversationMembers returns the creator and memberIDs sorted and without
+// duplicates.
+func conversationMembers(creatorID int, memberIDs []int) []int {
+	members := []int{creatorID}
+	for _, id := range memberIDs {
+		if !containsFunc(members, func(other int) bool { return other == id }) {
+			members = append(members, id)
+		}
+	}
+	sort.Ints(members)
+	return members
+}
+
+// directKey identifies the direct conversation between two users.
+type directKey struct {
+	UserID  int
+	OtherID int
+}
+
+func (conversation Conversation) directKey() directKey {
+	return directKey{UserID: conversation.MemberIDs[0], OtherID: conversation.MemberIDs[1]}
+}
+
+// CreateConversation starts a conversation between creatorID and memberIDs.
+// Opening a direct conversation that already exists returns it, with
+// created false. Every member must exist, or ErrNotExist is returned, and
+// none may have blocked the creator or been blocked by them, or ErrBlocked
+// is returned.
+func (db *DB) CreateConversation(creatorID int, memberIDs []int) (conversation Conversation, created bool, err error) {
+	members := conversationMembers(creatorID, memberIDs)
+	err = db.Update(func(dbStructure *DBStructure) error {
+		for _, id := range members {
+			if _, ok := dbStructure.Users[id]; !ok {
+				return ErrNotExist
+			}
+			if dbStructure.blocked(creatorID, id) {
+				return ErrBlocked
+			}
+		}
+
+		now := time.Now().UTC()
+		conversation = Conversation{
+			CreatorID: creatorID,
+			MemberIDs: members,
+			CreatedAt: now,
+			UpdatedAt: now,
+		}
+		if conversation.Direct() {
+			existing, ok := dbStructure.Conversations[dbStructure.directConversations[conversation.directKey()]]
+			if ok {
+				conversation = existing
+				return nil
+			}
+		}
+		conversation.ID = dbStructure.nextID(sequenceConversations)
+		dbStructure.putConversation(conversation)
+		created = true
+		return nil
+	})
+	if err != nil {
+		return Conversation{}, false, err
+	}
+
+	return conversation, created, nil
+}
+
+func (db *DB) GetConversation(id int) (Conversation, error) {
+	conversation := Conversation{}
+	err := db.View(func(dbStructure *DBStructure) error {
+		var ok bool
+		conversation, ok = dbStructure.Conversations[id]
+		if !ok {
+			return ErrNotExist
+		}
+		return nil
+	})
+	if err != nil {
+		return Conversation{}, err
+	}
+
+	return conversation, nil
+}
+
+// GetConversations lists the conversations userID is in, the one with the
+// latest message first.
+func (db *DB) GetConversations(userID int) ([]Conversation, error) {
+	conversations := []Conversation{}
+	err := db.View(func(dbStructure *DBStructure) error {
+		for id := range dbStructure.conversationsByMember[userID] {
+			conversations = append(conversations, dbStructure.Conversations[id])
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(conversations, func(i, j int) bool {
+		if !conversations[i].UpdatedAt.Equal(conversations[j].UpdatedAt) {
+			return conversations[i].UpdatedAt.After(conversations[j].UpdatedAt)
+		}
+		return conversations[i].ID > conversations[j].ID
+	})
+	return conversations, nil
+}
+
+// CreateMessage adds a message from senderID to a conversation; callers
+// check the sender is a member. A direct conversation between users who
+// have since blocked each other returns ErrBlocked.
+func (db *DB) CreateMessage(conversationID, senderID int, body string) (Message, error) {
+	message := Message{}
+	err := db.Update(func(dbStructure *DBStructure) error {
+		conversation, ok := dbStructure.Conversations[conversationID]
+		if !ok {
+			return ErrNotExist
+		}
+		if conversation.Direct() && dbStructure.blocked(conversation.MemberIDs[0], conversation.MemberIDs[1]) {
+			return ErrBlocked
+		}
+
+		message = Message{
+			ID:             dbStructure.nextID(sequenceMessages),
+			ConversationID: conversationID,
+			SenderID:       senderID,
+			Body:           body,
+			CreatedAt:      time.Now().UTC(),
+		}
+		dbStructure.putMessage(message)
+		conversation.UpdatedAt = message.CreatedAt
+		dbStructure.putConversation(conversation)
+		return nil
+	})
+	if err != nil {
+		return Message{}, err
+	}
+
+	return message, nil
+}
+
+// GetMessages returns a page of a conversation's messages, newest first.
+func (db *DB) GetMessages(q MessageQuery) (MessagePage, error) {
+	messages := []Message{}
+	err := db.View(func(dbStructure *DBStructure) error {
+		if _, ok := dbStructure.Conversations[q.ConversationID]; !ok {
+			return ErrNotExist
+		}
+		for id := range dbStructure.messagesByConversation[q.ConversationID] {
+			if q.BeforeID == 0 || id < q.BeforeID {
+				messages = append(messages, dbStructure.Messages[id])
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return MessagePage{}, err
+	}
+
+	sort.Slice(messages, func(i, j int) bool {
+		return messages[i].ID > messages[j].ID
+	})
+	page := MessagePage{Messages: messages}
+	if q.Limit > 0 && len(messages) > q.Limit {
+		page.Messages = messages[:q.Limit]
+		page.HasNext = true
+	}
+	return page, nil
+}
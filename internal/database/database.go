@@ -1,29 +1,94 @@
 package database
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"os"
 	"sync"
+
+	"github.com/brookwarren/chirpy/internal/search"
 )
 
 var ErrNotExist = errors.New("resource does not exist")
 
 type DB struct {
-	path string
-	mu   *sync.RWMutex
+	path           string
+	mu             *sync.RWMutex
+	journal        bool
+	journalRecords int
+	skipMigrations bool
+	cache          *dbCache
 }
 
 type DBStructure struct {
+	Version     int                   `json:"version"`
 	Chirps      map[int]Chirp         `json:"chirps"`
 	Users       map[int]User          `json:"users"`
 	Revocations map[string]Revocation `json:"revocations"`
+	Sequences   map[string]int        `json:"sequences"`
+
+	ChirpRevisions  map[int][]ChirpRevision     `json:"chirp_revisions"`
+	Follows         map[int]map[int]Follow      `json:"follows"`
+	ChirpTombstones map[int]ChirpTombstone      `json:"chirp_tombstones"`
+	Likes           map[int]map[int]Reaction    `json:"likes"`
+	Rechirps        map[int]map[int]Reaction    `json:"rechirps"`
+	Media           map[int]Media               `json:"media"`
+	ChirpDrafts     map[int]ChirpDraft          `json:"chirp_drafts"`
+	Blocks          map[int]map[int]Restriction `json:"blocks"`
+	Mutes           map[int]map[int]Restriction `json:"mutes"`
+	Notifications   map[int]Notification        `json:"notifications"`
+	Conversations   map[int]Conversation        `json:"conversations"`
+	Messages        map[int]Message             `json:"messages"`
+	Reports         map[int]Report              `json:"reports"`
+	ModerationLog   map[int]ModerationAction    `json:"moderation_log"`
+
+	usersByEmail   map[string]int
+	usersByHandle  map[string]int
+	usersByAvatar  map[int]map[int]struct{}
+	chirpsByAuthor map[int]map[int]struct{}
+	replies        map[int]map[int]struct{}
+	chirpsByTag    map[string]map[int]struct{}
+	mentionsOf     map[int]map[int]struct{}
+	rechirpsByUser map[int]map[int]struct{}
+	followers      map[int]map[int]struct{}
+	blockedBy      map[int]map[int]struct{}
+	mediaBySHA     map[string]map[int]struct{}
+	chirpsByMedia  map[int]map[int]struct{}
+	searchIndex    *search.Index
+
+	// notificationsByUser and notificationsByChirp index every notification;
+	// openNotifications only the unread ones, which new events join.
+	notificationsByUser  map[int]map[int]struct{}
+	notificationsByChirp map[int]map[int]struct{}
+	openNotifications    map[notificationKey]int
+
+	conversationsByMember  map[int]map[int]struct{}
+	directConversations    map[directKey]int
+	messagesByConversation map[int]map[int]struct{}
+}
+
+// Options tunes how a store is opened.
+type Options struct {
+	// Journal appends each write to <path>.journal instead of rewriting the
+	// whole file. The journal is folded back into the snapshot periodically
+	// and whenever the database is opened. JSON store only.
+	Journal bool
+	// SkipMigrations opens the store without migrating it to the latest
+	// schema version, so it can be inspected or migrated through Migrator.
+	SkipMigrations bool
 }
 
 func NewDB(path string) (*DB, error) {
+	return NewDBWithOptions(path, Options{})
+}
+
+func NewDBWithOptions(path string, opts Options) (*DB, error) {
 	db := &DB{
-		path: path,
-		mu:   &sync.RWMutex{},
+		path:           path,
+		mu:             &sync.RWMutex{},
+		journal:        opts.Journal,
+		skipMigrations: opts.SkipMigrations,
 	}
 	err := db.ensureDB()
 	return db, err
@@ -31,58 +96,219 @@ func NewDB(path string) (*DB, error) {
 
 func (db *DB) createDB() error {
 	dbStructure := DBStructure{
+		Version:     latestSchemaVersion(),
 		Chirps:      map[int]Chirp{},
 		Users:       map[int]User{},
 		Revocations: map[string]Revocation{},
+		Sequences:   map[string]int{},
+
+		ChirpRevisions:  map[int][]ChirpRevision{},
+		Follows:         map[int]map[int]Follow{},
+		ChirpTombstones: map[int]ChirpTombstone{},
+		Likes:           map[int]map[int]Reaction{},
+		Rechirps:        map[int]map[int]Reaction{},
+		Media:           map[int]Media{},
+		ChirpDrafts:     map[int]ChirpDraft{},
+		Blocks:          map[int]map[int]Restriction{},
+		Mutes:           map[int]map[int]Restriction{},
+		Notifications:   map[int]Notification{},
+		Conversations:   map[int]Conversation{},
+		Messages:        map[int]Message{},
+		Reports:         map[int]Report{},
+		ModerationLog:   map[int]ModerationAction{},
 	}
-	return db.writeDB(dbStructure)
+	dat, err := json.Marshal(dbStructure)
+	if err != nil {
+		return err
+	}
+	return db.writeSnapshot(dat)
 }
 
+// ensureDB restores or creates the snapshot as needed, replays any journal
+// left behind by the previous run, brings the schema up to date and checks
+// the data is consistent.
 func (db *DB) ensureDB() error {
-	_, err := os.ReadFile(db.path)
+	err := db.recoverSnapshot()
 	if errors.Is(err, os.ErrNotExist) {
-		return db.createDB()
+		err = db.createDB()
+	}
+	if err != nil {
+		return err
 	}
-	return err
+	err = db.compactJournal()
+	if err != nil {
+		return err
+	}
+	if db.skipMigrations {
+		return nil
+	}
+	err = db.update(func(dbStructure *DBStructure) error {
+		_, err := runMigrations(dbStructure)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return db.cache.structure.checkConsistency()
 }
 
 func (db *DB) ResetDB() error {
-	err := os.Remove(db.path)
-	if errors.Is(err, os.ErrNotExist) {
-		return nil
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.cache = nil
+	for _, path := range []string{db.path, db.backupPath(), db.journalPath()} {
+		err := os.Remove(path)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
 	}
 	return db.ensureDB()
 }
 
-func (db *DB) loadDB() (DBStructure, error) {
+// Close is a no-op for the JSON store; every write is already flushed to disk.
+func (db *DB) Close() error {
+	return nil
+}
+
+// View runs fn against the cached database, reloading it first if the files
+// changed on disk. fn must not modify the structure it is given.
+func (db *DB) View(fn func(*DBStructure) error) error {
 	db.mu.RLock()
 	defer db.mu.RUnlock()
 
+	for !db.cacheFresh() {
+		db.mu.RUnlock()
+		db.mu.Lock()
+		err := db.loadCache()
+		db.mu.Unlock()
+		db.mu.RLock()
+		if err != nil {
+			return err
+		}
+	}
+	return fn(&db.cache.structure)
+}
+
+// Update runs fn and persists the structure it leaves behind, holding the
+// write lock for the whole read-modify-write cycle so concurrent updates can't
+// overwrite each other. If fn returns an error nothing is written.
+func (db *DB) Update(fn func(*DBStructure) error) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	return db.update(fn)
+}
+
+// update is Update for callers that already hold db.mu for writing. fn edits
+// the cached structure in place, so the cache is dropped whenever the
+// transaction fails and is reloaded from disk by the next caller.
+func (db *DB) update(fn func(*DBStructure) error) error {
+	err := db.loadCache()
+	if err != nil {
+		return err
+	}
+
+	err = fn(&db.cache.structure)
+	if err == nil {
+		err = db.writeDB(db.cache.raw, db.cache.structure)
+	}
+	if err != nil {
+		db.cache = nil
+		return err
+	}
+	return nil
+}
+
+// loadDB reads the current structure from disk, bypassing the cache, along
+// with the bytes it was decoded from. Callers must hold db.mu.
+func (db *DB) loadDB() (DBStructure, []byte, error) {
 	dbStructure := DBStructure{}
-	dat, err := os.ReadFile(db.path)
-	if errors.Is(err, os.ErrNotExist) {
-		return dbStructure, err
+	dat, err := db.readCurrent()
+	if err != nil {
+		return dbStructure, nil, err
 	}
 	err = json.Unmarshal(dat, &dbStructure)
 	if err != nil {
-		return dbStructure, err
+		return dbStructure, nil, err
 	}
 
-	return dbStructure, nil
+	return dbStructure, dat, nil
 }
 
-func (db *DB) writeDB(dbStructure DBStructure) error {
-	db.mu.Lock()
-	defer db.mu.Unlock()
+// readCurrent returns the snapshot with any journal records applied on top.
+func (db *DB) readCurrent() ([]byte, error) {
+	dat, err := os.ReadFile(db.path)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(db.journalPath()); errors.Is(err, os.ErrNotExist) {
+		return dat, nil
+	}
+
+	doc, err := decodeRawDocument(dat)
+	if err != nil {
+		return nil, err
+	}
+	_, err = db.replayJournal(doc)
+	if err != nil {
+		return nil, err
+	}
+	return doc.encode()
+}
 
+// writeDB persists dbStructure, which replaces the state previously read as
+// current, and records what was written in the cache. Callers must hold db.mu
+// for writing.
+func (db *DB) writeDB(current []byte, dbStructure DBStructure) error {
 	dat, err := json.Marshal(dbStructure)
 	if err != nil {
 		return err
 	}
+	if bytes.Equal(dat, current) {
+		return nil
+	}
+
+	if !db.journal {
+		err = db.writeSnapshot(dat)
+	} else {
+		err = db.writeJournal(current, dat)
+	}
+	if err != nil {
+		return err
+	}
+	return db.cacheWritten(dat)
+}
+
+// writeJournal records the difference between current and dat as a single
+// journal record.
+func (db *DB) writeJournal(current, dat []byte) error {
+	before, err := decodeRawDocument(current)
+	if err != nil {
+		return err
+	}
+	after, err := decodeRawDocument(dat)
+	if err != nil {
+		return err
+	}
 
-	err = os.WriteFile(db.path, dat, 0600)
+	ops, err := diffRawDocuments(before, after)
 	if err != nil {
 		return err
 	}
+	if len(ops) == 0 {
+		return nil
+	}
+	err = db.appendJournal(ops)
+	if err != nil {
+		// The append may have left part of a record behind. Start over
+		// from a snapshot rather than append after it.
+		return errors.Join(err, db.resetJournal(current))
+	}
+
+	db.journalRecords++
+	if db.journalRecords >= journalCompactEvery {
+		return db.compactJournal()
+	}
 	return nil
 }
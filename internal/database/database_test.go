@@ -0,0 +1,75 @@
+package database
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+// TestUpdateRollback checks that an Update whose function fails leaves
+// nothing behind, neither in the cache nor on disk.
+func TestUpdateRollback(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "database.json")
+	db, err := NewDB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	errBoom := errors.New("boom")
+	err = db.Update(func(dbStructure *DBStructure) error {
+		dbStructure.putUser(User{ID: dbStructure.nextID(sequenceUsers), Email: "a@example.com"})
+		return errBoom
+	})
+	if !errors.Is(err, errBoom) {
+		t.Fatalf("got error %v, want %v", err, errBoom)
+	}
+
+	for _, db := range []*DB{db, mustOpen(t, path)} {
+		err = db.View(func(dbStructure *DBStructure) error {
+			if len(dbStructure.Users) != 0 || dbStructure.Sequences[sequenceUsers] != 0 {
+				t.Errorf("failed update left users %v and sequence %d", dbStructure.Users, dbStructure.Sequences[sequenceUsers])
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func mustOpen(t *testing.T, path string) *DB {
+	t.Helper()
+	db, err := NewDB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// forEachStore runs test against a fresh, empty store of each kind: a JSON
+// file, a journaled JSON file and SQLite.
+func forEachStore(t *testing.T, test func(t *testing.T, db Store)) {
+	stores := map[string]func(dir string) (Store, error){
+		"json": func(dir string) (Store, error) {
+			return NewDB(filepath.Join(dir, "database.json"))
+		},
+		"journal": func(dir string) (Store, error) {
+			return NewDBWithOptions(filepath.Join(dir, "database.json"), Options{Journal: true})
+		},
+		"sqlite": func(dir string) (Store, error) {
+			return NewSQLiteDB(filepath.Join(dir, "database.sqlite"))
+		},
+	}
+
+	for name, open := range stores {
+		t.Run(name, func(t *testing.T) {
+			db, err := open(t.TempDir())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+
+			test(t, db)
+		})
+	}
+}
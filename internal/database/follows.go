@@ -0,0 +1,132 @@
+package database
+
+import (
+	"sort"
+	"time"
+)
+
+// Follow records that FollowerID follows FolloweeID.
+type Follow struct {
+	FollowerID int       `json:"follower_id"`
+	FolloweeID int       `json:"followee_id"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// FollowUser makes followerID follow followeeID and notifies followeeID.
+// Following someone twice is not an error; the original follow is returned.
+// It returns ErrBlocked if either user has blocked the other.
+func (db *DB) FollowUser(followerID, followeeID int) (Follow, error) {
+	follow := Follow{}
+	err := db.Update(func(dbStructure *DBStructure) error {
+		if _, ok := dbStructure.Users[followeeID]; !ok {
+			return ErrNotExist
+		}
+		if dbStructure.blocked(followerID, followeeID) {
+			return ErrBlocked
+		}
+		existing, ok := dbStructure.Follows[followerID][followeeID]
+		if ok {
+			follow = existing
+			return nil
+		}
+		follow = Follow{
+			FollowerID: followerID,
+			FolloweeID: followeeID,
+			CreatedAt:  time.Now().UTC(),
+		}
+		dbStructure.putFollow(follow)
+		dbStructure.notify(NotificationFollow, followeeID, followerID, 0, follow.CreatedAt)
+		return nil
+	})
+	if err != nil {
+		return Follow{}, err
+	}
+
+	return follow, nil
+}
+
+// UnfollowUser removes a follow. Unfollowing someone who isn't followed is not
+// an error.
+func (db *DB) UnfollowUser(followerID, followeeID int) error {
+	return db.Update(func(dbStructure *DBStructure) error {
+		if _, ok := dbStructure.Users[followeeID]; !ok {
+			return ErrNotExist
+		}
+		if _, ok := dbStructure.Follows[followerID][followeeID]; ok {
+			dbStructure.retractNotification(NotificationFollow, followeeID, followerID, 0)
+		}
+		dbStructure.removeFollow(followerID, followeeID)
+		return nil
+	})
+}
+
+// GetFollowers lists who follows userID, most recent first. Follows with
+// either side blocked by or blocking viewerID are left out.
+func (db *DB) GetFollowers(userID, viewerID int) ([]Follow, error) {
+	follows := []Follow{}
+	err := db.View(func(dbStructure *DBStructure) error {
+		if _, ok := dbStructure.Users[userID]; !ok {
+			return ErrNotExist
+		}
+		hidden := dbStructure.hiddenFrom(viewerID, false)
+		for followerID := range dbStructure.followers[userID] {
+			follow := dbStructure.Follows[followerID][userID]
+			if !follow.hidden(hidden) {
+				follows = append(follows, follow)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sortFollows(follows)
+	return follows, nil
+}
+
+// GetFollowing lists who userID follows, most recent first, leaving out
+// follows hidden from viewerID as GetFollowers does.
+func (db *DB) GetFollowing(userID, viewerID int) ([]Follow, error) {
+	follows := []Follow{}
+	err := db.View(func(dbStructure *DBStructure) error {
+		if _, ok := dbStructure.Users[userID]; !ok {
+			return ErrNotExist
+		}
+		hidden := dbStructure.hiddenFrom(viewerID, false)
+		for _, follow := range dbStructure.Follows[userID] {
+			if !follow.hidden(hidden) {
+				follows = append(follows, follow)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sortFollows(follows)
+	return follows, nil
+}
+
+// hidden reports whether either side of the follow is in hidden.
+func (follow Follow) hidden(hidden map[int]struct{}) bool {
+	_, ok := hidden[follow.FollowerID]
+	if ok {
+		return true
+	}
+	_, ok = hidden[follow.FolloweeID]
+	return ok
+}
+
+func sortFollows(follows []Follow) {
+	sort.Slice(follows, func(i, j int) bool {
+		if !follows[i].CreatedAt.Equal(follows[j].CreatedAt) {
+			return follows[i].CreatedAt.After(follows[j].CreatedAt)
+		}
+		if follows[i].FollowerID != follows[j].FollowerID {
+			return follows[i].FollowerID < follows[j].FollowerID
+		}
+		return follows[i].FolloweeID < follows[j].FolloweeID
+	})
+}
@@ -0,0 +1,59 @@
+package database
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestFollowsHiddenFromBlocked checks that follower and following lists leave
+// out users the viewer is blocked by or has blocked.
+func TestFollowsHiddenFromBlocked(t *testing.T) {
+	forEachStore(t, func(t *testing.T, db Store) {
+		for _, email := range []string{"a@example.com", "b@example.com", "c@example.com"} {
+			_, err := db.CreateUser(email, "hash")
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		const a, b, c = 1, 2, 3
+		for _, follow := range [][2]int{{b, a}, {c, a}, {a, c}} {
+			_, err := db.FollowUser(follow[0], follow[1])
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		_, err := db.AddRestriction(RestrictionBlock, c, b)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		tests := []struct {
+			name     string
+			list     func(userID, viewerID int) ([]Follow, error)
+			userID   int
+			viewerID int
+			want     [][2]int
+		}{
+			{"anonymous lists a's followers", db.GetFollowers, a, 0, [][2]int{{c, a}, {b, a}}},
+			{"blocked lists a's followers", db.GetFollowers, a, b, [][2]int{{b, a}}},
+			{"blocker lists a's followers", db.GetFollowers, a, c, [][2]int{{c, a}}},
+			{"blocked lists c's followers", db.GetFollowers, c, b, [][2]int{}},
+			{"blocked lists c's following", db.GetFollowing, c, b, [][2]int{}},
+			{"blocked lists a's following", db.GetFollowing, a, b, [][2]int{}},
+			{"a lists a's following", db.GetFollowing, a, a, [][2]int{{a, c}}},
+		}
+		for _, tt := range tests {
+			follows, err := tt.list(tt.userID, tt.viewerID)
+			if err != nil {
+				t.Fatalf("%s: %v", tt.name, err)
+			}
+			got := [][2]int{}
+			for _, follow := range follows {
+				got = append(got, [2]int{follow.FollowerID, follow.FolloweeID})
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+			}
+		}
+	})
+}
@@ -0,0 +1,286 @@
+package database
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"os"
+)
+
+// journalCompactEvery is how many journal records may pile up before they are
+// folded back into a fresh snapshot.
+const journalCompactEvery = 100
+
+// journalRecord is one committed write. A record is a single line in the
+// journal file, so a write torn by a crash is dropped as a whole on replay.
+type journalRecord struct {
+	Ops []journalOp `json:"ops"`
+}
+
+type journalOp struct {
+	// Op is "put" or "delete" for a key inside a collection, or "set" to
+	// replace a top-level value outright.
+	Op         string          `json:"op"`
+	Collection string          `json:"collection"`
+	Key        string          `json:"key,omitempty"`
+	Value      json.RawMessage `json:"value,omitempty"`
+}
+
+// rawDocument is the database file decoded just far enough to diff and patch
+// it: every top-level JSON object is treated as a keyed collection.
+type rawDocument struct {
+	collections map[string]map[string]json.RawMessage
+	values      map[string]json.RawMessage
+}
+
+func decodeRawDocument(dat []byte) (rawDocument, error) {
+	top := map[string]json.RawMessage{}
+	err := json.Unmarshal(dat, &top)
+	if err != nil {
+		return rawDocument{}, err
+	}
+
+	doc := rawDocument{
+		collections: map[string]map[string]json.RawMessage{},
+		values:      map[string]json.RawMessage{},
+	}
+	for name, value := range top {
+		err := doc.set(name, value)
+		if err != nil {
+			return rawDocument{}, err
+		}
+	}
+	return doc, nil
+}
+
+func (doc rawDocument) encode() ([]byte, error) {
+	top := make(map[string]any, len(doc.collections)+len(doc.values))
+	for name, value := range doc.values {
+		top[name] = value
+	}
+	for name, collection := range doc.collections {
+		top[name] = collection
+	}
+	return json.Marshal(top)
+}
+
+// set replaces a top-level value; a nil value removes it.
+func (doc rawDocument) set(name string, value json.RawMessage) error {
+	delete(doc.collections, name)
+	delete(doc.values, name)
+	if value == nil {
+		return nil
+	}
+	if !bytes.HasPrefix(bytes.TrimSpace(value), []byte("{")) {
+		doc.values[name] = value
+		return nil
+	}
+	collection := map[string]json.RawMessage{}
+	err := json.Unmarshal(value, &collection)
+	if err != nil {
+		return err
+	}
+	doc.collections[name] = collection
+	return nil
+}
+
+func (doc rawDocument) apply(op journalOp) error {
+	switch op.Op {
+	case "put":
+		collection, ok := doc.collections[op.Collection]
+		if !ok {
+			collection = map[string]json.RawMessage{}
+			doc.collections[op.Collection] = collection
+		}
+		collection[op.Key] = op.Value
+	case "delete":
+		delete(doc.collections[op.Collection], op.Key)
+	case "set":
+		return doc.set(op.Collection, op.Value)
+	}
+	return nil
+}
+
+// diffRawDocuments returns the ops that turn before into after.
+func diffRawDocuments(before, after rawDocument) ([]journalOp, error) {
+	ops := []journalOp{}
+	for name, afterColl := range after.collections {
+		beforeColl, ok := before.collections[name]
+		if !ok {
+			value, err := json.Marshal(afterColl)
+			if err != nil {
+				return nil, err
+			}
+			ops = append(ops, journalOp{Op: "set", Collection: name, Value: value})
+			continue
+		}
+		for key, value := range afterColl {
+			if old, ok := beforeColl[key]; ok && bytes.Equal(old, value) {
+				continue
+			}
+			ops = append(ops, journalOp{Op: "put", Collection: name, Key: key, Value: value})
+		}
+		for key := range beforeColl {
+			if _, ok := afterColl[key]; !ok {
+				ops = append(ops, journalOp{Op: "delete", Collection: name, Key: key})
+			}
+		}
+	}
+	for name, value := range after.values {
+		if old, ok := before.values[name]; ok && bytes.Equal(old, value) {
+			continue
+		}
+		ops = append(ops, journalOp{Op: "set", Collection: name, Value: value})
+	}
+	for name := range before.names() {
+		if !after.has(name) {
+			ops = append(ops, journalOp{Op: "set", Collection: name})
+		}
+	}
+	return ops, nil
+}
+
+func (doc rawDocument) names() map[string]struct{} {
+	names := map[string]struct{}{}
+	for name := range doc.collections {
+		names[name] = struct{}{}
+	}
+	for name := range doc.values {
+		names[name] = struct{}{}
+	}
+	return names
+}
+
+func (doc rawDocument) has(name string) bool {
+	_, isCollection := doc.collections[name]
+	_, isValue := doc.values[name]
+	return isCollection || isValue
+}
+
+func (db *DB) journalPath() string {
+	return db.path + ".journal"
+}
+
+// writeJournalRecord writes line to the journal file f and syncs it. Tests
+// replace it to make appends fail part way through.
+var writeJournalRecord = func(f *os.File, line []byte) error {
+	_, err := f.Write(line)
+	if err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+// appendJournal durably appends one record to the journal.
+func (db *DB) appendJournal(ops []journalOp) error {
+	line, err := json.Marshal(journalRecord{Ops: ops})
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	f, err := os.OpenFile(db.journalPath(), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	err = writeJournalRecord(f, line)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// replayJournal applies every complete journal record to doc and returns how
+// many were applied. An incomplete or garbled record ends the replay: it can
+// only be the tail of a write that never finished.
+func (db *DB) replayJournal(doc rawDocument) (int, error) {
+	f, err := os.Open(db.journalPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	applied := 0
+	reader := bufio.NewReader(f)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			if len(bytes.TrimSpace(line)) > 0 {
+				log.Printf("Discarding incomplete record at the end of %s", db.journalPath())
+			}
+			return applied, nil
+		}
+		if err != nil {
+			return applied, err
+		}
+
+		record := journalRecord{}
+		err = json.Unmarshal(line, &record)
+		if err != nil {
+			log.Printf("Discarding corrupt records in %s after record %d", db.journalPath(), applied)
+			return applied, nil
+		}
+		for _, op := range record.Ops {
+			err := doc.apply(op)
+			if err != nil {
+				return applied, err
+			}
+		}
+		applied++
+	}
+}
+
+// resetJournal makes dat, the state before a failed append, the snapshot
+// and removes the journal, which may now end in a partial record.
+func (db *DB) resetJournal(dat []byte) error {
+	err := db.writeSnapshot(dat)
+	if err != nil {
+		return err
+	}
+
+	db.journalRecords = 0
+	err = os.Remove(db.journalPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// compactJournal folds the journal into a new snapshot and removes it.
+func (db *DB) compactJournal() error {
+	dat, err := os.ReadFile(db.path)
+	if err != nil {
+		return err
+	}
+	doc, err := decodeRawDocument(dat)
+	if err != nil {
+		return err
+	}
+	applied, err := db.replayJournal(doc)
+	if err != nil {
+		return err
+	}
+	if applied > 0 {
+		dat, err = doc.encode()
+		if err != nil {
+			return err
+		}
+		err = db.writeSnapshot(dat)
+		if err != nil {
+			return err
+		}
+	}
+
+	db.journalRecords = 0
+	err = os.Remove(db.journalPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,108 @@
+package database
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestJournalTornTail checks that a record torn by a crash is dropped when
+// the database is opened, and doesn't swallow the records written after it.
+func TestJournalTornTail(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "database.json")
+	opts := Options{Journal: true}
+
+	db, err := NewDBWithOptions(path, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user, err := db.CreateUser("a@example.com", "hash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.CreateChirp(Chirp{AuthorID: user.ID, Body: "before"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.OpenFile(db.journalPath(), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = f.WriteString(`{"ops":[{"op":"put","collection":"chirps","key":"9","value":{"id":9`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	db, err = NewDBWithOptions(path, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.CreateChirp(Chirp{AuthorID: user.ID, Body: "after"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db, err = NewDBWithOptions(path, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chirps, err := db.GetChirps()
+	if err != nil {
+		t.Fatal(err)
+	}
+	bodies := map[string]bool{}
+	for _, chirp := range chirps {
+		bodies[chirp.Body] = true
+	}
+	if len(chirps) != 2 || !bodies["before"] || !bodies["after"] {
+		t.Fatalf("got chirps %+v, want the ones before and after the torn record", chirps)
+	}
+}
+
+// TestJournalFailedAppend checks that an append which fails part way through
+// doesn't leave a partial record for the next append to be written after,
+// which would make replaying the journal drop it.
+func TestJournalFailedAppend(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "database.json")
+	opts := Options{Journal: true}
+
+	db, err := NewDBWithOptions(path, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user, err := db.CreateUser("a@example.com", "hash")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	write := writeJournalRecord
+	writeJournalRecord = func(f *os.File, line []byte) error {
+		f.Write(line[:len(line)/2])
+		return errors.New("disk full")
+	}
+	_, err = db.CreateChirp(Chirp{AuthorID: user.ID, Body: "failed"})
+	writeJournalRecord = write
+	if err == nil {
+		t.Fatal("append didn't fail")
+	}
+
+	_, err = db.CreateChirp(Chirp{AuthorID: user.ID, Body: "after"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db, err = NewDBWithOptions(path, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chirps, err := db.GetChirps()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chirps) != 1 || chirps[0].Body != "after" {
+		t.Fatalf("got chirps %+v, want only the one after the failed append", chirps)
+	}
+}
@@ -0,0 +1,149 @@
+package database
+
+import (
+	"errors"
+	"slices"
+	"time"
+)
+
+var ErrMediaNotExist = errors.New("media does not exist")
+
+// Media describes an uploaded image. The image itself is kept in a blob
+// store under its SHA-256, which is also how an uploader's duplicate uploads
+// are found.
+type Media struct {
+	ID                   int       `json:"id"`
+	UploaderID           int       `json:"uploader_id"`
+	SHA256               string    `json:"sha256"`
+	ContentType          string    `json:"content_type"`
+	ThumbnailContentType string    `json:"thumbnail_content_type"`
+	Size                 int       `json:"size"`
+	Width                int       `json:"width"`
+	Height               int       `json:"height"`
+	CreatedAt            time.Time `json:"created_at"`
+}
+
+// CreateMedia stores the description of an upload; the ID and creation time
+// are filled in here. If the uploader already has media with the same
+// SHA-256, it is returned instead and created is false. Other users' uploads
+// of the same image get media of their own, sharing only the blob.
+func (db *DB) CreateMedia(params Media) (media Media, created bool, err error) {
+	err = db.Update(func(dbStructure *DBStructure) error {
+		if existing, ok := dbStructure.mediaBySHA256(params.UploaderID, params.SHA256); ok {
+			media = existing
+			return nil
+		}
+		media = params
+		media.ID = dbStructure.nextID(sequenceMedia)
+		media.CreatedAt = time.Now().UTC()
+		dbStructure.putMedia(media)
+		created = true
+		return nil
+	})
+	if err != nil {
+		return Media{}, false, err
+	}
+
+	return media, created, nil
+}
+
+func (db *DB) GetMedia(id int) (Media, error) {
+	media := Media{}
+	err := db.View(func(dbStructure *DBStructure) error {
+		var ok bool
+		media, ok = dbStructure.Media[id]
+		if !ok {
+			return ErrNotExist
+		}
+		return nil
+	})
+	if err != nil {
+		return Media{}, err
+	}
+
+	return media, nil
+}
+
+// CanViewMedia reports whether viewerID, who is 0 when anonymous, may see
+// media. Its uploader always may, and anyone may see an avatar. Otherwise the
+// viewer must be able to see a chirp it is attached to, so media that is
+// unattached or only in drafts stays private to its uploader.
+func (db *DB) CanViewMedia(media Media, viewerID int) (bool, error) {
+	visible := false
+	err := db.View(func(dbStructure *DBStructure) error {
+		visible = dbStructure.canViewMedia(media, viewerID)
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return visible, nil
+}
+
+func (dbStructure *DBStructure) canViewMedia(media Media, viewerID int) bool {
+	if viewerID != 0 && viewerID == media.UploaderID {
+		return true
+	}
+	if len(dbStructure.usersByAvatar[media.ID]) > 0 {
+		return true
+	}
+	for chirpID := range dbStructure.chirpsByMedia[media.ID] {
+		if dbStructure.canView(dbStructure.Chirps[chirpID], viewerID) {
+			return true
+		}
+	}
+	return false
+}
+
+// DeleteUnreferencedMedia deletes those of ids that no chirp, draft or
+// avatar refers to any more. It returns the ones whose blobs no other media
+// shares, so those can be deleted too.
+func (db *DB) DeleteUnreferencedMedia(ids []int) ([]Media, error) {
+	deleted := []Media{}
+	err := db.Update(func(dbStructure *DBStructure) error {
+		for _, id := range ids {
+			media, ok := dbStructure.Media[id]
+			if !ok || dbStructure.mediaReferenced(id) {
+				continue
+			}
+			dbStructure.removeMedia(id)
+			if len(dbStructure.mediaBySHA[media.SHA256]) == 0 {
+				deleted = append(deleted, media)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return deleted, nil
+}
+
+// mediaReferenced reports whether any chirp, draft or avatar is using media
+// id. Drafts are few enough to check one by one.
+func (dbStructure *DBStructure) mediaReferenced(id int) bool {
+	if len(dbStructure.chirpsByMedia[id]) > 0 || len(dbStructure.usersByAvatar[id]) > 0 {
+		return true
+	}
+	for _, draft := range dbStructure.ChirpDrafts {
+		if slices.Contains(draft.MediaIDs, id) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkMediaIDs makes sure every media ID a chirp or avatar refers to exists
+// and was uploaded by uploaderID. Someone else's media is reported as not
+// existing: using it would publish it, and it may not be theirs to share.
+func (dbStructure *DBStructure) checkMediaIDs(uploaderID int, ids []int) error {
+	for _, id := range ids {
+		media, ok := dbStructure.Media[id]
+		if !ok || media.UploaderID != uploaderID {
+			return ErrMediaNotExist
+		}
+	}
+	return nil
+}
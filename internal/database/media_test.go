@@ -0,0 +1,173 @@
+package database
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// TestCanViewMedia checks that media is only seen by those who can see a
+// chirp it is attached to, besides its uploader.
+func TestCanViewMedia(t *testing.T) {
+	forEachStore(t, func(t *testing.T, db Store) {
+		author, err := db.CreateUser("author@example.com", "hash")
+		if err != nil {
+			t.Fatal(err)
+		}
+		other, err := db.CreateUser("other@example.com", "hash")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		upload := func(sha string) Media {
+			t.Helper()
+			media, _, err := db.CreateMedia(Media{UploaderID: author.ID, SHA256: sha, ContentType: "image/png", ThumbnailContentType: "image/png"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			return media
+		}
+		unattached := upload("unattached")
+		drafted := upload("drafted")
+		private := upload("private")
+		public := upload("public")
+
+		_, err = db.CreateChirpDraft(ChirpDraft{AuthorID: author.ID, Body: "draft", MediaIDs: []int{drafted.ID}, PublishAt: time.Now().Add(time.Hour), Visibility: VisibilityPublic})
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = db.CreateChirp(Chirp{AuthorID: author.ID, Body: "private", MediaIDs: []int{private.ID}, Visibility: VisibilityPrivate})
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = db.CreateChirp(Chirp{AuthorID: author.ID, Body: "public", MediaIDs: []int{public.ID}, Visibility: VisibilityPublic})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		tests := []struct {
+			media    Media
+			viewerID int
+			want     bool
+		}{
+			{unattached, author.ID, true},
+			{unattached, other.ID, false},
+			{drafted, other.ID, false},
+			{drafted, 0, false},
+			{private, author.ID, true},
+			{private, other.ID, false},
+			{public, 0, true},
+			{public, other.ID, true},
+		}
+		for _, tt := range tests {
+			got, err := db.CanViewMedia(tt.media, tt.viewerID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("media %s seen by user %d: got %v, want %v", tt.media.SHA256, tt.viewerID, got, tt.want)
+			}
+		}
+	})
+}
+
+// TestCreateMediaPerUploader checks that uploading an image someone else
+// already uploaded gives the uploader media of their own, and that the blob
+// they share is only reported for deletion along with the last of them.
+func TestCreateMediaPerUploader(t *testing.T) {
+	forEachStore(t, func(t *testing.T, db Store) {
+		first, err := db.CreateUser("first@example.com", "hash")
+		if err != nil {
+			t.Fatal(err)
+		}
+		second, err := db.CreateUser("second@example.com", "hash")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		upload := func(uploaderID int) (Media, bool) {
+			t.Helper()
+			media, created, err := db.CreateMedia(Media{UploaderID: uploaderID, SHA256: "same", ContentType: "image/png", ThumbnailContentType: "image/png"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			return media, created
+		}
+		mine, created := upload(first.ID)
+		if !created {
+			t.Fatal("first upload wasn't created")
+		}
+		theirs, created := upload(second.ID)
+		if !created || theirs.ID == mine.ID || theirs.UploaderID != second.ID {
+			t.Fatalf("second uploader got media %+v, created %v", theirs, created)
+		}
+		again, created := upload(second.ID)
+		if created || again.ID != theirs.ID {
+			t.Fatalf("repeated upload got media %+v, created %v", again, created)
+		}
+
+		deleted, err := db.DeleteUnreferencedMedia([]int{mine.ID})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(deleted) != 0 {
+			t.Fatalf("deleting shared media reported %+v for blob deletion", deleted)
+		}
+		deleted, err = db.DeleteUnreferencedMedia([]int{theirs.ID})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(deleted) != 1 || deleted[0].ID != theirs.ID {
+			t.Fatalf("deleting the last media got %+v, want media %d", deleted, theirs.ID)
+		}
+	})
+}
+
+// TestMediaOfOthers checks that nobody can attach someone else's media or
+// use it as their avatar, which would publish it.
+func TestMediaOfOthers(t *testing.T) {
+	forEachStore(t, func(t *testing.T, db Store) {
+		owner, err := db.CreateUser("owner@example.com", "hash")
+		if err != nil {
+			t.Fatal(err)
+		}
+		other, err := db.CreateUser("other@example.com", "hash")
+		if err != nil {
+			t.Fatal(err)
+		}
+		media, _, err := db.CreateMedia(Media{UploaderID: owner.ID, SHA256: "mine", ContentType: "image/png", ThumbnailContentType: "image/png"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = db.CreateChirp(Chirp{AuthorID: other.ID, Body: "stolen", MediaIDs: []int{media.ID}, Visibility: VisibilityPublic})
+		if !errors.Is(err, ErrMediaNotExist) {
+			t.Errorf("attaching to a chirp: got error %v, want %v", err, ErrMediaNotExist)
+		}
+		_, err = db.CreateChirpDraft(ChirpDraft{AuthorID: other.ID, Body: "stolen", MediaIDs: []int{media.ID}, Visibility: VisibilityPublic})
+		if !errors.Is(err, ErrMediaNotExist) {
+			t.Errorf("attaching to a draft: got error %v, want %v", err, ErrMediaNotExist)
+		}
+		_, err = db.UpdateUser(other.ID, UserUpdate{AvatarMediaID: &media.ID})
+		if !errors.Is(err, ErrMediaNotExist) {
+			t.Errorf("using as an avatar: got error %v, want %v", err, ErrMediaNotExist)
+		}
+
+		visible, err := db.CanViewMedia(media, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if visible {
+			t.Error("media became visible to everyone")
+		}
+
+		_, err = db.CreateChirp(Chirp{AuthorID: owner.ID, Body: "mine", MediaIDs: []int{media.ID}, Visibility: VisibilityPublic})
+		if err != nil {
+			t.Errorf("attaching own media: %v", err)
+		}
+		_, err = db.UpdateUser(owner.ID, UserUpdate{AvatarMediaID: &media.ID})
+		if err != nil {
+			t.Errorf("using own media as an avatar: %v", err)
+		}
+	})
+}
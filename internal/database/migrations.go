@@ -0,0 +1,312 @@
+package database
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Migrator reports on and applies schema migrations.
+type Migrator interface {
+	MigrationStatus() (MigrationStatus, error)
+	// Migrate applies every pending migration and returns their names. With
+	// dryRun set the migrations run but nothing is saved.
+	Migrate(dryRun bool) ([]string, error)
+}
+
+type MigrationStatus struct {
+	Version int
+	Latest  int
+	Pending []string
+}
+
+// migration upgrades DBStructure from version-1 to version.
+type migration struct {
+	version int
+	name    string
+	up      func(*DBStructure) error
+}
+
+// migrations are run in order by NewDB. Never edit or reorder an entry once it
+// has shipped; append a new one instead.
+var migrations = []migration{
+	{1, "add sequence counters", migrateSequences},
+	{2, "add chirp timestamps and revisions", migrateChirpRevisions},
+	{3, "add follows", migrateFollows},
+	{4, "add chirp tombstones", migrateChirpTombstones},
+	{5, "add likes and rechirps", migrateReactions},
+	{6, "extract hashtags and mentions", migrateChirpEntities},
+	{7, "add media", migrateMedia},
+	{8, "add chirp drafts", migrateChirpDrafts},
+	{9, "add blocks and mutes", migrateRestrictions},
+	{10, "add notifications", migrateNotifications},
+	{11, "add conversations and messages", migrateConversations},
+	{12, "add chirp visibility", migrateChirpVisibility},
+	{13, "add reports and the moderation log", migrateModeration},
+	{14, "add user roles", migrateUserRoles},
+	{15, "unresolve email mentions", migrateEmailMentions},
+}
+
+func latestSchemaVersion() int {
+	return len(migrations)
+}
+
+func (m migration) String() string {
+	return migrationName(m.version, m.name)
+}
+
+func migrationName(version int, name string) string {
+	return fmt.Sprintf("%04d %s", version, name)
+}
+
+func pendingMigrations(dbStructure *DBStructure) ([]migration, error) {
+	if dbStructure.Version > latestSchemaVersion() {
+		return nil, fmt.Errorf(
+			"database schema version %d is newer than the latest known version %d",
+			dbStructure.Version,
+			latestSchemaVersion(),
+		)
+	}
+	return migrations[dbStructure.Version:], nil
+}
+
+func runMigrations(dbStructure *DBStructure) ([]string, error) {
+	pending, err := pendingMigrations(dbStructure)
+	if err != nil {
+		return nil, err
+	}
+
+	applied := []string{}
+	for _, m := range pending {
+		err := m.up(dbStructure)
+		if err != nil {
+			return applied, fmt.Errorf("migration %s: %w", m, err)
+		}
+		dbStructure.Version = m.version
+		applied = append(applied, m.String())
+	}
+	if len(applied) > 0 {
+		dbStructure.buildIndexes()
+	}
+	return applied, nil
+}
+
+func (db *DB) MigrationStatus() (MigrationStatus, error) {
+	status := MigrationStatus{}
+	err := db.View(func(dbStructure *DBStructure) error {
+		pending, err := pendingMigrations(dbStructure)
+		if err != nil {
+			return err
+		}
+		status.Version = dbStructure.Version
+		status.Latest = latestSchemaVersion()
+		for _, m := range pending {
+			status.Pending = append(status.Pending, m.String())
+		}
+		return nil
+	})
+	return status, err
+}
+
+func (db *DB) Migrate(dryRun bool) ([]string, error) {
+	if dryRun {
+		db.mu.RLock()
+		defer db.mu.RUnlock()
+
+		dbStructure, _, err := db.loadDB()
+		if err != nil {
+			return nil, err
+		}
+		return runMigrations(&dbStructure)
+	}
+
+	applied := []string{}
+	err := db.Update(func(dbStructure *DBStructure) error {
+		var err error
+		applied, err = runMigrations(dbStructure)
+		return err
+	})
+	return applied, err
+}
+
+// migrateSequences seeds the sequence counters of files written before they
+// existed, so the next ID is past every ID already in use.
+func migrateSequences(dbStructure *DBStructure) error {
+	if dbStructure.Sequences == nil {
+		dbStructure.Sequences = map[string]int{}
+	}
+	for id := range dbStructure.Chirps {
+		dbStructure.Sequences[sequenceChirps] = max(dbStructure.Sequences[sequenceChirps], id)
+	}
+	for id := range dbStructure.Users {
+		dbStructure.Sequences[sequenceUsers] = max(dbStructure.Sequences[sequenceUsers], id)
+	}
+	return nil
+}
+
+// migrateChirpRevisions stamps existing chirps with the time of the migration,
+// since when they were really posted was never recorded, and starts each one's
+// history with its current body.
+func migrateChirpRevisions(dbStructure *DBStructure) error {
+	now := time.Now().UTC()
+	dbStructure.ChirpRevisions = map[int][]ChirpRevision{}
+	for id, chirp := range dbStructure.Chirps {
+		chirp.CreatedAt = now
+		chirp.UpdatedAt = now
+		dbStructure.Chirps[id] = chirp
+		dbStructure.ChirpRevisions[id] = []ChirpRevision{{
+			Version:   1,
+			Body:      chirp.Body,
+			CreatedAt: now,
+		}}
+	}
+	return nil
+}
+
+func migrateFollows(dbStructure *DBStructure) error {
+	if dbStructure.Follows == nil {
+		dbStructure.Follows = map[int]map[int]Follow{}
+	}
+	return nil
+}
+
+func migrateChirpTombstones(dbStructure *DBStructure) error {
+	if dbStructure.ChirpTombstones == nil {
+		dbStructure.ChirpTombstones = map[int]ChirpTombstone{}
+	}
+	return nil
+}
+
+func migrateReactions(dbStructure *DBStructure) error {
+	if dbStructure.Likes == nil {
+		dbStructure.Likes = map[int]map[int]Reaction{}
+	}
+	if dbStructure.Rechirps == nil {
+		dbStructure.Rechirps = map[int]map[int]Reaction{}
+	}
+	return nil
+}
+
+// backfillMentionResolver resolves mentions as they were when
+// migrateChirpEntities was written: by email address only. Migration 15
+// unresolves them again, like every other email mention.
+func (dbStructure *DBStructure) backfillMentionResolver() func(username string) (int, error) {
+	return func(username string) (int, error) {
+		if !strings.Contains(username, "@") {
+			return 0, nil
+		}
+		if user, ok := dbStructure.userByEmail(username); ok {
+			return user.ID, nil
+		}
+		return 0, nil
+	}
+}
+
+// migrateChirpEntities parses the hashtags and mentions out of the chirps
+// posted before they were extracted.
+func migrateChirpEntities(dbStructure *DBStructure) error {
+	// Resolving mentions needs the email index, which a dry run hasn't built.
+	dbStructure.buildIndexes()
+	for id, chirp := range dbStructure.Chirps {
+		hashtags, mentions, err := parseEntities(chirp.Body, dbStructure.backfillMentionResolver())
+		if err != nil {
+			return err
+		}
+		chirp.Hashtags = hashtags
+		chirp.Mentions = mentions
+		dbStructure.Chirps[id] = chirp
+	}
+	return nil
+}
+
+func migrateMedia(dbStructure *DBStructure) error {
+	if dbStructure.Media == nil {
+		dbStructure.Media = map[int]Media{}
+	}
+	return nil
+}
+
+func migrateChirpDrafts(dbStructure *DBStructure) error {
+	if dbStructure.ChirpDrafts == nil {
+		dbStructure.ChirpDrafts = map[int]ChirpDraft{}
+	}
+	return nil
+}
+
+func migrateRestrictions(dbStructure *DBStructure) error {
+	if dbStructure.Blocks == nil {
+		dbStructure.Blocks = map[int]map[int]Restriction{}
+	}
+	if dbStructure.Mutes == nil {
+		dbStructure.Mutes = map[int]map[int]Restriction{}
+	}
+	return nil
+}
+
+func migrateNotifications(dbStructure *DBStructure) error {
+	if dbStructure.Notifications == nil {
+		dbStructure.Notifications = map[int]Notification{}
+	}
+	return nil
+}
+
+func migrateConversations(dbStructure *DBStructure) error {
+	if dbStructure.Conversations == nil {
+		dbStructure.Conversations = map[int]Conversation{}
+	}
+	if dbStructure.Messages == nil {
+		dbStructure.Messages = map[int]Message{}
+	}
+	return nil
+}
+
+// migrateChirpVisibility makes the chirps and drafts saved before chirps had
+// a visibility public.
+func migrateChirpVisibility(dbStructure *DBStructure) error {
+	for id, chirp := range dbStructure.Chirps {
+		chirp.Visibility = chirp.Visibility.orPublic()
+		dbStructure.Chirps[id] = chirp
+	}
+	for id, draft := range dbStructure.ChirpDrafts {
+		draft.Visibility = draft.Visibility.orPublic()
+		dbStructure.ChirpDrafts[id] = draft
+	}
+	return nil
+}
+
+func migrateModeration(dbStructure *DBStructure) error {
+	if dbStructure.Reports == nil {
+		dbStructure.Reports = map[int]Report{}
+	}
+	if dbStructure.ModerationLog == nil {
+		dbStructure.ModerationLog = map[int]ModerationAction{}
+	}
+	return nil
+}
+
+func migrateUserRoles(dbStructure *DBStructure) error {
+	for id, user := range dbStructure.Users {
+		user.Role = user.Role.orUser()
+		dbStructure.Users[id] = user
+	}
+	return nil
+}
+
+// migrateEmailMentions unresolves the mentions that name users by email
+// address, as mentions are resolved by handle only, and deletes the mention
+// notifications they led to.
+func migrateEmailMentions(dbStructure *DBStructure) error {
+	for id, chirp := range dbStructure.Chirps {
+		var unmentioned []int
+		chirp.Mentions, unmentioned = withoutEmailMentions(chirp.Mentions)
+		dbStructure.Chirps[id] = chirp
+		for notificationID, notification := range dbStructure.Notifications {
+			if notification.Kind == NotificationMention && notification.ChirpID == id &&
+				slices.Contains(unmentioned, notification.UserID) {
+				delete(dbStructure.Notifications, notificationID)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package database
+
+import (
+	"slices"
+	"testing"
+)
+
+// TestMigrateEmailMentions checks that migrating unresolves the mentions
+// that named users by email, along with the notifications they led to, but
+// leaves those by handle alone.
+func TestMigrateEmailMentions(t *testing.T) {
+	dbStructure := &DBStructure{
+		Chirps: map[int]Chirp{
+			1: {ID: 1, AuthorID: 1, Body: "@b@example.com @c @c@example.com", Mentions: []Mention{
+				{Username: "b@example.com", UserID: 2, Start: 0, End: 14},
+				{Username: "c", UserID: 3, Start: 15, End: 17},
+				{Username: "c@example.com", UserID: 3, Start: 18, End: 32},
+			}},
+		},
+		Notifications: map[int]Notification{
+			1: {ID: 1, UserID: 2, Kind: NotificationMention, ChirpID: 1, ActorIDs: []int{1}},
+			2: {ID: 2, UserID: 3, Kind: NotificationMention, ChirpID: 1, ActorIDs: []int{1}},
+		},
+	}
+
+	err := migrateEmailMentions(dbStructure)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := []int{}
+	for _, mention := range dbStructure.Chirps[1].Mentions {
+		got = append(got, mention.UserID)
+	}
+	if !slices.Equal(got, []int{0, 3, 0}) {
+		t.Errorf("got mentioned users %v, want [0 3 0]", got)
+	}
+	if _, ok := dbStructure.Notifications[1]; ok {
+		t.Error("the email mention's notification is left")
+	}
+	if _, ok := dbStructure.Notifications[2]; !ok {
+		t.Error("the handle mention's notification is gone")
+	}
+}
@@ -0,0 +1,163 @@
+package database
+
+import (
+	"sort"
+	"time"
+)
+
+// ModerationKind is something a moderator did.
+type ModerationKind string
+
+const (
+	ModerationClaimReport   ModerationKind = "claim_report"
+	ModerationResolveReport ModerationKind = "resolve_report"
+	ModerationDismissReport ModerationKind = "dismiss_report"
+	ModerationHideChirp     ModerationKind = "hide_chirp"
+	ModerationUnhideChirp   ModerationKind = "unhide_chirp"
+	ModerationSuspendUser   ModerationKind = "suspend_user"
+	ModerationUnsuspendUser ModerationKind = "unsuspend_user"
+	ModerationDeleteChirp   ModerationKind = "delete_chirp"
+	ModerationSetRole       ModerationKind = "set_role"
+)
+
+// ModerationAction is an entry in the moderation log, the audit trail of
+// every moderator action. Entries are only ever added. Actions taken from
+// the command line have no moderator.
+type ModerationAction struct {
+	ID          int            `json:"id"`
+	ModeratorID int            `json:"moderator_id"`
+	Kind        ModerationKind `json:"kind"`
+	// ReportID, ChirpID and UserID are what the action was about, as far
+	// as they apply.
+	ReportID  int       `json:"report_id,omitempty"`
+	ChirpID   int       `json:"chirp_id,omitempty"`
+	UserID    int       `json:"user_id,omitempty"`
+	Reason    string    `json:"reason,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	// Role is the role a set_role action gave the user.
+	Role Role `json:"role,omitempty"`
+}
+
+// ModerationLogQuery selects a page of the moderation log, newest first.
+type ModerationLogQuery struct {
+	Limit int
+	// BeforeID, if set, returns the entries older than that entry.
+	BeforeID int
+}
+
+// ModerationLogPage is one page of a ModerationLogQuery.
+type ModerationLogPage struct {
+	Actions []ModerationAction
+	HasNext bool
+}
+
+// logModeration appends action to the moderation log.
+func (dbStructure *DBStructure) logModeration(action ModerationAction) {
+	action.ID = dbStructure.nextID(sequenceModerationLog)
+	dbStructure.ModerationLog[action.ID] = action
+}
+
+// HideChirp hides a chirp from everyone but its author, or shows it again,
+// on behalf of moderatorID, recording why in the moderation log. Hiding a
+// hidden chirp is not an error, but is logged all the same. moderatorID's
+// role must be above the author's, or ErrOutranked is returned.
+func (db *DB) HideChirp(chirpID, moderatorID int, hidden bool, reason string) (Chirp, error) {
+	chirp := Chirp{}
+	err := db.Update(func(dbStructure *DBStructure) error {
+		var ok bool
+		chirp, ok = dbStructure.Chirps[chirpID]
+		if !ok {
+			return ErrNotExist
+		}
+		err := dbStructure.checkOutranks(moderatorID, chirp.AuthorID)
+		if err != nil {
+			return err
+		}
+		chirp.Hidden = hidden
+		dbStructure.putChirp(chirp)
+
+		kind := ModerationHideChirp
+		if !hidden {
+			kind = ModerationUnhideChirp
+		}
+		dbStructure.logModeration(ModerationAction{
+			ModeratorID: moderatorID,
+			Kind:        kind,
+			ChirpID:     chirpID,
+			UserID:      chirp.AuthorID,
+			Reason:      reason,
+			CreatedAt:   time.Now().UTC(),
+		})
+		return nil
+	})
+	if err != nil {
+		return Chirp{}, err
+	}
+
+	return chirp, nil
+}
+
+// SuspendUser suspends a user, who can then no longer log in or use their
+// tokens, or lifts their suspension, on behalf of moderatorID, recording why
+// in the moderation log. moderatorID's role must be above the user's, or
+// ErrOutranked is returned.
+func (db *DB) SuspendUser(userID, moderatorID int, suspended bool, reason string) (User, error) {
+	user := User{}
+	err := db.Update(func(dbStructure *DBStructure) error {
+		var ok bool
+		user, ok = dbStructure.Users[userID]
+		if !ok {
+			return ErrNotExist
+		}
+		err := dbStructure.checkOutranks(moderatorID, userID)
+		if err != nil {
+			return err
+		}
+		user.Suspended = suspended
+		dbStructure.putUser(user)
+
+		kind := ModerationSuspendUser
+		if !suspended {
+			kind = ModerationUnsuspendUser
+		}
+		dbStructure.logModeration(ModerationAction{
+			ModeratorID: moderatorID,
+			Kind:        kind,
+			UserID:      userID,
+			Reason:      reason,
+			CreatedAt:   time.Now().UTC(),
+		})
+		return nil
+	})
+	if err != nil {
+		return User{}, err
+	}
+
+	return user, nil
+}
+
+// GetModerationLog returns a page of the moderation log, newest first.
+func (db *DB) GetModerationLog(q ModerationLogQuery) (ModerationLogPage, error) {
+	actions := []ModerationAction{}
+	err := db.View(func(dbStructure *DBStructure) error {
+		for id, action := range dbStructure.ModerationLog {
+			if q.BeforeID == 0 || id < q.BeforeID {
+				actions = append(actions, action)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return ModerationLogPage{}, err
+	}
+
+	sort.Slice(actions, func(i, j int) bool {
+		return actions[i].ID > actions[j].ID
+	})
+	page := ModerationLogPage{Actions: actions}
+	if q.Limit > 0 && len(actions) > q.Limit {
+		page.Actions = actions[:q.Limit]
+		page.HasNext = true
+	}
+	return page, nil
+}
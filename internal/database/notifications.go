@@ -0,0 +1,253 @@
+package database
+
+import (
+	"errors"
+	"sort"
+	"time"
+)
+
+// NotificationKind is something another user did that their target hears
+// about.
+type NotificationKind string
+
+const (
+	NotificationFollow  NotificationKind = "follow"
+	NotificationMention NotificationKind = "mention"
+	NotificationLike    NotificationKind = "like"
+	NotificationReply   NotificationKind = "reply"
+)
+
+// Notification groups the events of one kind about one chirp: the follows
+// of UserID, the likes of or replies to ChirpID, or the mentions of UserID
+// in ChirpID. Events join the group until it is read, after which the next
+// one starts a new group.
+type Notification struct {
+	ID     int              `json:"id"`
+	UserID int              `json:"user_id"`
+	Kind   NotificationKind `json:"kind"`
+	// ChirpID is the chirp liked or replied to, the chirp the mention is in,
+	// or 0 for follows.
+	ChirpID int `json:"chirp_id,omitempty"`
+	// ActorIDs are the users behind the events, most recent first.
+	ActorIDs  []int     `json:"actor_ids"`
+	Read      bool      `json:"read"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// NotificationCursor is a position in a user's notifications, which are
+// sorted by when they were last updated, newest first.
+type NotificationCursor struct {
+	UpdatedAt time.Time
+	ID        int
+}
+
+// NotificationQuery selects a page of a user's notifications.
+type NotificationQuery struct {
+	UserID     int
+	UnreadOnly bool
+	Limit      int
+	// After returns the notifications that follow the cursor.
+	After *NotificationCursor
+}
+
+// NotificationPage is one page of a NotificationQuery, along with how many
+// of the user's notifications are unread in all.
+type NotificationPage struct {
+	Notifications []Notification
+	HasNext       bool
+	Unread        int
+}
+
+// Cursor returns the position of the i'th notification of the page.
+func (p NotificationPage) Cursor(i int) NotificationCursor {
+	return cursorOfNotification(p.Notifications[i])
+}
+
+var ErrInvalidNotificationQuery = errors.New("invalid notification query")
+
+func (q NotificationQuery) validate() error {
+	if q.Limit < 0 {
+		return ErrInvalidNotificationQuery
+	}
+	return nil
+}
+
+// notificationKey identifies the group an event joins while it is unread.
+type notificationKey struct {
+	UserID  int
+	Kind    NotificationKind
+	ChirpID int
+}
+
+func (notification Notification) key() notificationKey {
+	return notificationKey{
+		UserID:  notification.UserID,
+		Kind:    notification.Kind,
+		ChirpID: notification.ChirpID,
+	}
+}
+
+// notify records that actorID did something of the given kind to userID.
+// Nobody hears about their own actions, or about users they blocked or
+// muted or who blocked them.
+func (dbStructure *DBStructure) notify(kind NotificationKind, userID, actorID, chirpID int, at time.Time) {
+	if userID == actorID || dbStructure.blocked(userID, actorID) {
+		return
+	}
+	if _, ok := dbStructure.Mutes[userID][actorID]; ok {
+		return
+	}
+
+	key := notificationKey{UserID: userID, Kind: kind, ChirpID: chirpID}
+	notification, ok := dbStructure.Notifications[dbStructure.openNotifications[key]]
+	if !ok {
+		notification = Notification{
+			ID:        dbStructure.nextID(sequenceNotifications),
+			UserID:    userID,
+			Kind:      kind,
+			ChirpID:   chirpID,
+			CreatedAt: at,
+		}
+	}
+	notification.ActorIDs = append([]int{actorID}, withoutID(notification.ActorIDs, actorID)...)
+	notification.UpdatedAt = at
+	dbStructure.putNotification(notification)
+}
+
+// retractNotification takes actorID back out of the unread group it joined,
+// for a like or follow that was undone. A group left empty is removed.
+func (dbStructure *DBStructure) retractNotification(kind NotificationKind, userID, actorID, chirpID int) {
+	key := notificationKey{UserID: userID, Kind: kind, ChirpID: chirpID}
+	notification, ok := dbStructure.Notifications[dbStructure.openNotifications[key]]
+	if !ok {
+		return
+	}
+	notification.ActorIDs = withoutID(notification.ActorIDs, actorID)
+	if len(notification.ActorIDs) == 0 {
+		dbStructure.removeNotification(notification.ID)
+		return
+	}
+	dbStructure.putNotification(notification)
+}
+
+// notifyChirp tells the author of the chirp being replied to and the users
+// mentioned about a new chirp, if they can see it.
+func (dbStructure *DBStructure) notifyChirp(chirp Chirp) {
+	parent, ok := dbStructure.Chirps[chirp.InReplyTo]
+	if ok && chirp.InReplyTo != 0 && dbStructure.canView(chirp, parent.AuthorID) {
+		dbStructure.notify(NotificationReply, parent.AuthorID, chirp.AuthorID, parent.ID, chirp.CreatedAt)
+	}
+	dbStructure.notifyMentions(chirp, nil)
+}
+
+// notifyMentions tells the users chirp mentions about it, except those in
+// skip, whom an edited chirp already mentioned, and those who can't see it.
+func (dbStructure *DBStructure) notifyMentions(chirp Chirp, skip []int) {
+	for _, userID := range mentionedUserIDs(chirp.Mentions) {
+		if !containsFunc(skip, func(id int) bool { return id == userID }) && dbStructure.canView(chirp, userID) {
+			dbStructure.notify(NotificationMention, userID, chirp.AuthorID, chirp.ID, chirp.UpdatedAt)
+		}
+	}
+}
+
+func withoutID(ids []int, id int) []int {
+	kept := []int{}
+	for _, other := range ids {
+		if other != id {
+			kept = append(kept, other)
+		}
+	}
+	return kept
+}
+
+// GetNotifications returns a page of a user's notifications, most recently
+// updated first.
+func (db *DB) GetNotifications(q NotificationQuery) (NotificationPage, error) {
+	err := q.validate()
+	if err != nil {
+		return NotificationPage{}, err
+	}
+
+	notifications := []Notification{}
+	unread := 0
+	err = db.View(func(dbStructure *DBStructure) error {
+		for id := range dbStructure.notificationsByUser[q.UserID] {
+			notification := dbStructure.Notifications[id]
+			if !notification.Read {
+				unread++
+			}
+			if q.UnreadOnly && notification.Read {
+				continue
+			}
+			if q.After != nil && !notificationBefore(*q.After, cursorOfNotification(notification)) {
+				continue
+			}
+			notifications = append(notifications, notification)
+		}
+		return nil
+	})
+	if err != nil {
+		return NotificationPage{}, err
+	}
+
+	sort.Slice(notifications, func(i, j int) bool {
+		return notificationBefore(cursorOfNotification(notifications[i]), cursorOfNotification(notifications[j]))
+	})
+	page := NotificationPage{
+		Notifications: notifications,
+		Unread:        unread,
+	}
+	if q.Limit > 0 && len(notifications) > q.Limit {
+		page.Notifications = notifications[:q.Limit]
+		page.HasNext = true
+	}
+	return page, nil
+}
+
+// MarkNotificationsRead marks the given notifications of userID read, or
+// all of them if ids is nil, and returns how many are still unread. IDs of
+// other users' notifications are ignored.
+func (db *DB) MarkNotificationsRead(userID int, ids []int) (int, error) {
+	unread := 0
+	err := db.Update(func(dbStructure *DBStructure) error {
+		selected := map[int]bool{}
+		for _, id := range ids {
+			selected[id] = true
+		}
+		marked := []Notification{}
+		for id := range dbStructure.notificationsByUser[userID] {
+			notification := dbStructure.Notifications[id]
+			if notification.Read {
+				continue
+			}
+			if ids != nil && !selected[id] {
+				unread++
+				continue
+			}
+			notification.Read = true
+			marked = append(marked, notification)
+		}
+		for _, notification := range marked {
+			dbStructure.putNotification(notification)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return unread, nil
+}
+
+func cursorOfNotification(notification Notification) NotificationCursor {
+	return NotificationCursor{UpdatedAt: notification.UpdatedAt, ID: notification.ID}
+}
+
+// notificationBefore reports whether a comes before b, newest first.
+func notificationBefore(a, b NotificationCursor) bool {
+	if !a.UpdatedAt.Equal(b.UpdatedAt) {
+		return a.UpdatedAt.After(b.UpdatedAt)
+	}
+	return a.ID > b.ID
+}
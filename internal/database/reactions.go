@@ -0,0 +1,132 @@
+package database
+
+import (
+	"errors"
+	"time"
+)
+
+// ReactionKind is something a user can do to someone else's chirp, at most
+// once per chirp.
+type ReactionKind string
+
+const (
+	ReactionLike    ReactionKind = "like"
+	ReactionRechirp ReactionKind = "rechirp"
+)
+
+var ErrInvalidReaction = errors.New("invalid reaction kind")
+
+type Reaction struct {
+	ChirpID   int       `json:"chirp_id"`
+	UserID    int       `json:"user_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ChirpStats counts the reactions to a chirp and says which of them came from
+// the viewer they were requested for.
+type ChirpStats struct {
+	Likes     int
+	Rechirps  int
+	Liked     bool
+	Rechirped bool
+}
+
+func (kind ReactionKind) validate() error {
+	if kind != ReactionLike && kind != ReactionRechirp {
+		return ErrInvalidReaction
+	}
+	return nil
+}
+
+// reactions returns the collection holding reactions of the given kind,
+// keyed by chirp ID and then user ID.
+func (dbStructure *DBStructure) reactions(kind ReactionKind) map[int]map[int]Reaction {
+	if kind == ReactionRechirp {
+		return dbStructure.Rechirps
+	}
+	return dbStructure.Likes
+}
+
+// AddReaction records a reaction to a chirp, notifying its author of likes.
+// Reacting twice is not an error; the original reaction is returned.
+func (db *DB) AddReaction(kind ReactionKind, chirpID, userID int) (Reaction, error) {
+	err := kind.validate()
+	if err != nil {
+		return Reaction{}, err
+	}
+
+	reaction := Reaction{}
+	err = db.Update(func(dbStructure *DBStructure) error {
+		chirp, ok := dbStructure.Chirps[chirpID]
+		if !ok {
+			return ErrNotExist
+		}
+		existing, ok := dbStructure.reactions(kind)[chirpID][userID]
+		if ok {
+			reaction = existing
+			return nil
+		}
+		reaction = Reaction{
+			ChirpID:   chirpID,
+			UserID:    userID,
+			CreatedAt: time.Now().UTC(),
+		}
+		dbStructure.putReaction(kind, reaction)
+		if kind == ReactionLike {
+			dbStructure.notify(NotificationLike, chirp.AuthorID, userID, chirpID, reaction.CreatedAt)
+		}
+		return nil
+	})
+	if err != nil {
+		return Reaction{}, err
+	}
+
+	return reaction, nil
+}
+
+// RemoveReaction undoes a reaction. Removing one that was never made is not
+// an error.
+func (db *DB) RemoveReaction(kind ReactionKind, chirpID, userID int) error {
+	err := kind.validate()
+	if err != nil {
+		return err
+	}
+
+	return db.Update(func(dbStructure *DBStructure) error {
+		chirp, ok := dbStructure.Chirps[chirpID]
+		if !ok {
+			return ErrNotExist
+		}
+		if _, ok := dbStructure.reactions(kind)[chirpID][userID]; ok && kind == ReactionLike {
+			dbStructure.retractNotification(NotificationLike, chirp.AuthorID, userID, chirpID)
+		}
+		dbStructure.removeReaction(kind, chirpID, userID)
+		return nil
+	})
+}
+
+// GetChirpStats returns the stats of each of chirpIDs as seen by viewerID,
+// which may be 0 for an anonymous viewer.
+func (db *DB) GetChirpStats(chirpIDs []int, viewerID int) (map[int]ChirpStats, error) {
+	stats := make(map[int]ChirpStats, len(chirpIDs))
+	err := db.View(func(dbStructure *DBStructure) error {
+		for _, id := range chirpIDs {
+			likes := dbStructure.Likes[id]
+			rechirps := dbStructure.Rechirps[id]
+			_, liked := likes[viewerID]
+			_, rechirped := rechirps[viewerID]
+			stats[id] = ChirpStats{
+				Likes:     len(likes),
+				Rechirps:  len(rechirps),
+				Liked:     liked,
+				Rechirped: rechirped,
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return stats, nil
+}
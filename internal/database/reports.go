@@ -0,0 +1,253 @@
+package database
+
+import (
+	"errors"
+	"sort"
+	"time"
+)
+
+// ReportStatus is where a report is in the moderators' queue. Open and
+// claimed reports are waiting for a decision; resolved and dismissed ones
+// are closed.
+type ReportStatus string
+
+const (
+	ReportOpen      ReportStatus = "open"
+	ReportClaimed   ReportStatus = "claimed"
+	ReportResolved  ReportStatus = "resolved"
+	ReportDismissed ReportStatus = "dismissed"
+)
+
+var ErrInvalidReportStatus = errors.New("invalid report status")
+
+// ErrReportClaimed is returned for an action on a report another moderator
+// has claimed.
+var ErrReportClaimed = errors.New("report claimed by another moderator")
+
+// ErrReportClosed is returned for an action on a report that has already
+// been resolved or dismissed.
+var ErrReportClosed = errors.New("report already closed")
+
+// Report flags a chirp or a user as abusive for the moderators to review.
+// A report about a chirp records the chirp's author as UserID too.
+type Report struct {
+	ID         int          `json:"id"`
+	ReporterID int          `json:"reporter_id"`
+	ChirpID    int          `json:"chirp_id,omitempty"`
+	UserID     int          `json:"user_id"`
+	Reason     string       `json:"reason"`
+	Status     ReportStatus `json:"status"`
+	// ModeratorID is who claimed or closed the report, and Note what they
+	// wrote when closing it.
+	ModeratorID int       `json:"moderator_id,omitempty"`
+	Note        string    `json:"note,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// ReportQuery selects a page of reports, oldest first.
+type ReportQuery struct {
+	// Statuses, if set, selects the reports in any of them.
+	Statuses []ReportStatus
+	Limit    int
+	// AfterID, if set, returns the reports newer than that report.
+	AfterID int
+}
+
+// ReportPage is one page of a ReportQuery.
+type ReportPage struct {
+	Reports []Report
+	HasNext bool
+}
+
+func (status ReportStatus) validate() error {
+	switch status {
+	case ReportOpen, ReportClaimed, ReportResolved, ReportDismissed:
+		return nil
+	}
+	return ErrInvalidReportStatus
+}
+
+func (q ReportQuery) validate() error {
+	for _, status := range q.Statuses {
+		err := status.validate()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// selects reports whether the query asks for report.
+func (q ReportQuery) selects(report Report) bool {
+	if q.AfterID != 0 && report.ID <= q.AfterID {
+		return false
+	}
+	return len(q.Statuses) == 0 || containsFunc(q.Statuses, func(status ReportStatus) bool { return status == report.Status })
+}
+
+// Closed reports whether the report has been resolved or dismissed.
+func (report Report) Closed() bool {
+	return report.Status == ReportResolved || report.Status == ReportDismissed
+}
+
+// moderate moves the report to status on behalf of moderatorID. Claiming
+// keeps other moderators off the report; the moderator who claimed it, or
+// anyone if nobody has, may then close it. Claiming a report twice is not an
+// error.
+func (report Report) moderate(moderatorID int, status ReportStatus, note string, at time.Time) (Report, error) {
+	if status == ReportOpen {
+		return Report{}, ErrInvalidReportStatus
+	}
+	err := status.validate()
+	if err != nil {
+		return Report{}, err
+	}
+	if report.Closed() {
+		return Report{}, ErrReportClosed
+	}
+	if report.Status == ReportClaimed && report.ModeratorID != moderatorID {
+		return Report{}, ErrReportClaimed
+	}
+
+	report.Status = status
+	report.ModeratorID = moderatorID
+	if report.Closed() {
+		report.Note = note
+	}
+	report.UpdatedAt = at
+	return report, nil
+}
+
+// moderationKind is the audit log entry for moving a report to status.
+func (status ReportStatus) moderationKind() ModerationKind {
+	switch status {
+	case ReportClaimed:
+		return ModerationClaimReport
+	case ReportResolved:
+		return ModerationResolveReport
+	}
+	return ModerationDismissReport
+}
+
+// CreateReport files an open report from the reporter, chirp or user and
+// reason of params. A reported chirp or user must exist, or ErrNotExist is
+// returned.
+func (db *DB) CreateReport(params Report) (Report, error) {
+	report := Report{}
+	err := db.Update(func(dbStructure *DBStructure) error {
+		userID := params.UserID
+		if params.ChirpID != 0 {
+			chirp, ok := dbStructure.Chirps[params.ChirpID]
+			if !ok {
+				return ErrNotExist
+			}
+			userID = chirp.AuthorID
+		}
+		if _, ok := dbStructure.Users[userID]; !ok {
+			return ErrNotExist
+		}
+
+		now := time.Now().UTC()
+		report = Report{
+			ID:         dbStructure.nextID(sequenceReports),
+			ReporterID: params.ReporterID,
+			ChirpID:    params.ChirpID,
+			UserID:     userID,
+			Reason:     params.Reason,
+			Status:     ReportOpen,
+			CreatedAt:  now,
+			UpdatedAt:  now,
+		}
+		dbStructure.Reports[report.ID] = report
+		return nil
+	})
+	if err != nil {
+		return Report{}, err
+	}
+
+	return report, nil
+}
+
+func (db *DB) GetReport(id int) (Report, error) {
+	report := Report{}
+	err := db.View(func(dbStructure *DBStructure) error {
+		var ok bool
+		report, ok = dbStructure.Reports[id]
+		if !ok {
+			return ErrNotExist
+		}
+		return nil
+	})
+	if err != nil {
+		return Report{}, err
+	}
+
+	return report, nil
+}
+
+// GetReports returns a page of reports, oldest first.
+func (db *DB) GetReports(q ReportQuery) (ReportPage, error) {
+	err := q.validate()
+	if err != nil {
+		return ReportPage{}, err
+	}
+
+	reports := []Report{}
+	err = db.View(func(dbStructure *DBStructure) error {
+		for _, report := range dbStructure.Reports {
+			if q.selects(report) {
+				reports = append(reports, report)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return ReportPage{}, err
+	}
+
+	sort.Slice(reports, func(i, j int) bool {
+		return reports[i].ID < reports[j].ID
+	})
+	page := ReportPage{Reports: reports}
+	if q.Limit > 0 && len(reports) > q.Limit {
+		page.Reports = reports[:q.Limit]
+		page.HasNext = true
+	}
+	return page, nil
+}
+
+// ModerateReport claims, resolves or dismisses a report on behalf of
+// moderatorID and records the action in the moderation log. A report claimed
+// by another moderator returns ErrReportClaimed, and one already closed
+// ErrReportClosed.
+func (db *DB) ModerateReport(id, moderatorID int, status ReportStatus, note string) (Report, error) {
+	report := Report{}
+	err := db.Update(func(dbStructure *DBStructure) error {
+		existing, ok := dbStructure.Reports[id]
+		if !ok {
+			return ErrNotExist
+		}
+		var err error
+		report, err = existing.moderate(moderatorID, status, note, time.Now().UTC())
+		if err != nil {
+			return err
+		}
+		dbStructure.Reports[id] = report
+		dbStructure.logModeration(ModerationAction{
+			ModeratorID: moderatorID,
+			Kind:        status.moderationKind(),
+			ReportID:    id,
+			ChirpID:     report.ChirpID,
+			UserID:      report.UserID,
+			Reason:      note,
+			CreatedAt:   report.UpdatedAt,
+		})
+		return nil
+	})
+	if err != nil {
+		return Report{}, err
+	}
+
+	return report, nil
+}
@@ -0,0 +1,179 @@
+package database
+
+import (
+	"errors"
+	"sort"
+	"time"
+)
+
+// RestrictionKind is a way one user can cut another off. A block works both
+// ways: neither user sees the other's chirps, and neither can follow, reply
+// to or mention the other. A mute only keeps the muted user's chirps out of
+// the muter's feeds and searches.
+type RestrictionKind string
+
+const (
+	RestrictionBlock RestrictionKind = "block"
+	RestrictionMute  RestrictionKind = "mute"
+)
+
+var ErrInvalidRestriction = errors.New("invalid restriction kind")
+
+// ErrBlocked is returned for a follow, reply or reaction between two users
+// one of whom has blocked the other.
+var ErrBlocked = errors.New("blocked")
+
+// Restriction records that UserID blocked or muted TargetID.
+type Restriction struct {
+	UserID    int       `json:"user_id"`
+	TargetID  int       `json:"target_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (kind RestrictionKind) validate() error {
+	if kind != RestrictionBlock && kind != RestrictionMute {
+		return ErrInvalidRestriction
+	}
+	return nil
+}
+
+// restrictions returns the collection holding restrictions of the given
+// kind, keyed by user ID and then target ID.
+func (dbStructure *DBStructure) restrictions(kind RestrictionKind) map[int]map[int]Restriction {
+	if kind == RestrictionMute {
+		return dbStructure.Mutes
+	}
+	return dbStructure.Blocks
+}
+
+// AddRestriction makes userID block or mute targetID. Blocking someone also
+// removes any follows between the two. Restricting someone twice is not an
+// error; the original restriction is returned.
+func (db *DB) AddRestriction(kind RestrictionKind, userID, targetID int) (Restriction, error) {
+	err := kind.validate()
+	if err != nil {
+		return Restriction{}, err
+	}
+
+	restriction := Restriction{}
+	err = db.Update(func(dbStructure *DBStructure) error {
+		if _, ok := dbStructure.Users[targetID]; !ok {
+			return ErrNotExist
+		}
+		if kind == RestrictionBlock {
+			dbStructure.removeFollow(userID, targetID)
+			dbStructure.removeFollow(targetID, userID)
+		}
+		existing, ok := dbStructure.restrictions(kind)[userID][targetID]
+		if ok {
+			restriction = existing
+			return nil
+		}
+		restriction = Restriction{
+			UserID:    userID,
+			TargetID:  targetID,
+			CreatedAt: time.Now().UTC(),
+		}
+		dbStructure.putRestriction(kind, restriction)
+		return nil
+	})
+	if err != nil {
+		return Restriction{}, err
+	}
+
+	return restriction, nil
+}
+
+// RemoveRestriction undoes a block or mute. Removing one that was never made
+// is not an error.
+func (db *DB) RemoveRestriction(kind RestrictionKind, userID, targetID int) error {
+	err := kind.validate()
+	if err != nil {
+		return err
+	}
+
+	return db.Update(func(dbStructure *DBStructure) error {
+		if _, ok := dbStructure.Users[targetID]; !ok {
+			return ErrNotExist
+		}
+		dbStructure.removeRestriction(kind, userID, targetID)
+		return nil
+	})
+}
+
+// GetRestrictions lists the users userID has blocked or muted, most recent
+// first.
+func (db *DB) GetRestrictions(kind RestrictionKind, userID int) ([]Restriction, error) {
+	err := kind.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	restrictions := []Restriction{}
+	err = db.View(func(dbStructure *DBStructure) error {
+		for _, restriction := range dbStructure.restrictions(kind)[userID] {
+			restrictions = append(restrictions, restriction)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sortRestrictions(restrictions)
+	return restrictions, nil
+}
+
+// IsBlocked reports whether either of two users has blocked the other.
+func (db *DB) IsBlocked(userID, otherID int) (bool, error) {
+	blocked := false
+	err := db.View(func(dbStructure *DBStructure) error {
+		blocked = dbStructure.blocked(userID, otherID)
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return blocked, nil
+}
+
+func (dbStructure *DBStructure) blocked(userID, otherID int) bool {
+	_, ok := dbStructure.Blocks[userID][otherID]
+	if ok {
+		return true
+	}
+	_, ok = dbStructure.Blocks[otherID][userID]
+	return ok
+}
+
+// hiddenFrom returns the users whose chirps viewerID doesn't see: those
+// blocked either way and, if muted is set, those viewerID muted. An
+// anonymous viewer sees everyone.
+func (dbStructure *DBStructure) hiddenFrom(viewerID int, muted bool) map[int]struct{} {
+	hidden := map[int]struct{}{}
+	if viewerID == 0 {
+		return hidden
+	}
+	for targetID := range dbStructure.Blocks[viewerID] {
+		hidden[targetID] = struct{}{}
+	}
+	for blockerID := range dbStructure.blockedBy[viewerID] {
+		hidden[blockerID] = struct{}{}
+	}
+	if muted {
+		for targetID := range dbStructure.Mutes[viewerID] {
+			hidden[targetID] = struct{}{}
+		}
+	}
+	return hidden
+}
+
+func sortRestrictions(restrictions []Restriction) {
+	sort.Slice(restrictions, func(i, j int) bool {
+		if !restrictions[i].CreatedAt.Equal(restrictions[j].CreatedAt) {
+			return restrictions[i].CreatedAt.After(restrictions[j].CreatedAt)
+		}
+		return restrictions[i].TargetID < restrictions[j].TargetID
+	})
+}
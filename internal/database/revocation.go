@@ -10,39 +10,25 @@ type Revocation struct {
 }
 
 func (db *DB) RevokeToken(token string) error {
-	dbStructure, err := db.loadDB()
-	if err != nil {
-		return err
-	}
-
-	revocation := Revocation{
-		Token:     token,
-		RevokedAt: time.Now().UTC(),
-	}
-	dbStructure.Revocations[token] = revocation
-
-	err = db.writeDB(dbStructure)
-	if err != nil {
-		return err
-	}
-
-	return nil
+	return db.Update(func(dbStructure *DBStructure) error {
+		dbStructure.Revocations[token] = Revocation{
+			Token:     token,
+			RevokedAt: time.Now().UTC(),
+		}
+		return nil
+	})
 }
 
 func (db *DB) IsTokenRevoked(token string) (bool, error) {
-	dbStructure, err := db.loadDB()
+	isRevoked := false
+	err := db.View(func(dbStructure *DBStructure) error {
+		revocation, ok := dbStructure.Revocations[token]
+		isRevoked = ok && !revocation.RevokedAt.IsZero()
+		return nil
+	})
 	if err != nil {
 		return false, err
 	}
 
-	revocation, ok := dbStructure.Revocations[token]
-	if !ok {
-		return false, nil
-	}
-
-	if revocation.RevokedAt.IsZero() {
-		return false, nil
-	}
-
-	return true, nil
+	return isRevoked, nil
 }
@@ -0,0 +1,153 @@
+package database
+
+import (
+	"errors"
+	"time"
+)
+
+// Role is what a user may do beyond using Chirpy. Each role can do
+// everything the roles below it can.
+type Role string
+
+const (
+	RoleUser Role = "user"
+	// RoleModerator users work the report queue, hide chirps, suspend
+	// users and delete anyone's chirps.
+	RoleModerator Role = "moderator"
+	// RoleAdmin users also see the metrics and assign roles.
+	RoleAdmin Role = "admin"
+)
+
+var ErrInvalidRole = errors.New("invalid role")
+
+// ErrOutranked is returned when a moderator acts on a user, or a chirp by a
+// user, whose role isn't below their own.
+var ErrOutranked = errors.New("user's role isn't below the moderator's")
+
+// ErrAdminExists is returned when bootstrapping an admin for a database that
+// already has one.
+var ErrAdminExists = errors.New("an admin already exists")
+
+func (role Role) validate() error {
+	switch role {
+	case RoleUser, RoleModerator, RoleAdmin:
+		return nil
+	}
+	return ErrInvalidRole
+}
+
+func (role Role) rank() int {
+	switch role {
+	case RoleModerator:
+		return 1
+	case RoleAdmin:
+		return 2
+	}
+	return 0
+}
+
+// Includes reports whether role can do everything other can.
+func (role Role) Includes(other Role) bool {
+	return role.rank() >= other.rank()
+}
+
+func (role Role) outranks(other Role) bool {
+	return role.rank() > other.rank()
+}
+
+// checkOutranks makes sure moderatorID's role is above userID's, returning
+// ErrOutranked if it isn't, so moderators can't act on each other or on
+// admins, and admins can't act on each other. It is checked in the same
+// transaction as the action, so a role changed meanwhile can't slip by.
+func (dbStructure *DBStructure) checkOutranks(moderatorID, userID int) error {
+	user, ok := dbStructure.Users[userID]
+	if !ok {
+		return ErrNotExist
+	}
+	if !dbStructure.Users[moderatorID].Role.outranks(user.Role) {
+		return ErrOutranked
+	}
+	return nil
+}
+
+// orUser returns role, or user if it is unset.
+func (role Role) orUser() Role {
+	if role == "" {
+		return RoleUser
+	}
+	return role
+}
+
+// setRole gives user role on behalf of moderatorID, recording it in the
+// moderation log. The user's sessions are revoked, so no token carries a
+// role they no longer have.
+func (dbStructure *DBStructure) setRole(user User, moderatorID int, role Role) User {
+	now := time.Now().UTC()
+	user.Role = role
+	user.SessionsValidAfter = now
+	dbStructure.putUser(user)
+
+	dbStructure.logModeration(ModerationAction{
+		ModeratorID: moderatorID,
+		Kind:        ModerationSetRole,
+		UserID:      user.ID,
+		Role:        role,
+		CreatedAt:   now,
+	})
+	return user
+}
+
+// SetUserRole gives a user role on behalf of the admin adminID, whose role
+// must be above the user's, or ErrOutranked is returned.
+func (db *DB) SetUserRole(userID, adminID int, role Role) (User, error) {
+	err := role.validate()
+	if err != nil {
+		return User{}, err
+	}
+
+	user := User{}
+	err = db.Update(func(dbStructure *DBStructure) error {
+		var ok bool
+		user, ok = dbStructure.Users[userID]
+		if !ok {
+			return ErrNotExist
+		}
+		err := dbStructure.checkOutranks(adminID, userID)
+		if err != nil {
+			return err
+		}
+		user = dbStructure.setRole(user, adminID, role)
+		return nil
+	})
+	if err != nil {
+		return User{}, err
+	}
+
+	return user, nil
+}
+
+// BootstrapAdmin makes the user with email the first admin, who can then
+// assign roles to everyone else. It returns ErrAdminExists if there already
+// is an admin. The moderation log records it as done by moderator 0.
+func (db *DB) BootstrapAdmin(email string) (User, error) {
+	user := User{}
+	err := db.Update(func(dbStructure *DBStructure) error {
+		for _, other := range dbStructure.Users {
+			if other.Role == RoleAdmin {
+				return ErrAdminExists
+			}
+		}
+		var ok bool
+		user, ok = dbStructure.userByEmail(email)
+		if !ok {
+			return ErrNotExist
+		}
+		user = dbStructure.setRole(user, 0, RoleAdmin)
+		return nil
+	})
+	if err != nil {
+		return User{}, err
+	}
+
+	return user, nil
+}
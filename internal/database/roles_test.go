@@ -0,0 +1,97 @@
+package database
+
+import (
+	"errors"
+	"testing"
+)
+
+// TestModerationNeedsHigherRole checks that moderators can only act on users
+// with a lower role than theirs, or on their chirps.
+func TestModerationNeedsHigherRole(t *testing.T) {
+	forEachStore(t, func(t *testing.T, db Store) {
+		users := map[Role][]User{}
+		for _, email := range []string{"admin@example.com", "admin2@example.com", "mod@example.com", "mod2@example.com", "user@example.com"} {
+			_, err := db.CreateUser(email, "hash")
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		admin, err := db.BootstrapAdmin("admin@example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		users[RoleAdmin] = append(users[RoleAdmin], admin)
+		for id, role := range map[int]Role{2: RoleAdmin, 3: RoleModerator, 4: RoleModerator, 5: RoleUser} {
+			user, err := db.SetUserRole(id, admin.ID, role)
+			if err != nil {
+				t.Fatal(err)
+			}
+			users[role] = append(users[role], user)
+		}
+		moderator, otherModerator, otherAdmin, user := users[RoleModerator][0], users[RoleModerator][1], users[RoleAdmin][1], users[RoleUser][0]
+
+		chirps := map[int]Chirp{}
+		for _, author := range []User{otherAdmin, otherModerator, user} {
+			chirp, err := db.CreateChirp(Chirp{AuthorID: author.ID, Body: "hi", Visibility: VisibilityPublic})
+			if err != nil {
+				t.Fatal(err)
+			}
+			chirps[author.ID] = chirp
+		}
+
+		tests := []struct {
+			name    string
+			act     func() error
+			wantErr error
+		}{
+			{"moderator suspends admin", func() error {
+				_, err := db.SuspendUser(otherAdmin.ID, moderator.ID, true, "x")
+				return err
+			}, ErrOutranked},
+			{"moderator suspends moderator", func() error {
+				_, err := db.SuspendUser(otherModerator.ID, moderator.ID, true, "x")
+				return err
+			}, ErrOutranked},
+			{"moderator hides admin's chirp", func() error {
+				_, err := db.HideChirp(chirps[otherAdmin.ID].ID, moderator.ID, true, "x")
+				return err
+			}, ErrOutranked},
+			{"moderator deletes moderator's chirp", func() error {
+				return db.DeleteChirpAsModerator(chirps[otherModerator.ID].ID, moderator.ID, "x")
+			}, ErrOutranked},
+			{"admin demotes admin", func() error {
+				_, err := db.SetUserRole(otherAdmin.ID, admin.ID, RoleUser)
+				return err
+			}, ErrOutranked},
+			{"moderator suspends user", func() error {
+				_, err := db.SuspendUser(user.ID, moderator.ID, true, "x")
+				return err
+			}, nil},
+			{"moderator hides user's chirp", func() error {
+				_, err := db.HideChirp(chirps[user.ID].ID, moderator.ID, true, "x")
+				return err
+			}, nil},
+			{"admin deletes moderator's chirp", func() error {
+				return db.DeleteChirpAsModerator(chirps[otherModerator.ID].ID, admin.ID, "x")
+			}, nil},
+			{"admin demotes moderator", func() error {
+				_, err := db.SetUserRole(otherModerator.ID, admin.ID, RoleUser)
+				return err
+			}, nil},
+		}
+		for _, tt := range tests {
+			err := tt.act()
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("%s: got error %v, want %v", tt.name, err, tt.wantErr)
+			}
+		}
+
+		got, err := db.GetUser(otherModerator.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Suspended {
+			t.Error("a refused suspension was applied")
+		}
+	})
+}
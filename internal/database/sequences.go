@@ -0,0 +1,21 @@
+package database
+
+const (
+	sequenceChirps = "chirps"
+	sequenceUsers  = "users"
+	sequenceMedia  = "media"
+	sequenceDrafts = "drafts"
+
+	sequenceNotifications = "notifications"
+	sequenceConversations = "conversations"
+	sequenceMessages      = "messages"
+	sequenceReports       = "reports"
+	sequenceModerationLog = "moderation_log"
+)
+
+// nextID advances and returns the sequence for a collection. IDs handed out
+// this way are never reused, even after the record they named is deleted.
+func (dbStructure *DBStructure) nextID(sequence string) int {
+	dbStructure.Sequences[sequence]++
+	return dbStructure.Sequences[sequence]
+}
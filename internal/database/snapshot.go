@@ -0,0 +1,92 @@
+package database
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// writeSnapshot atomically replaces the database file: the new contents are
+// written and fsynced to a temp file in the same directory, the current file
+// is kept as the backup snapshot, and the temp file is renamed into place.
+func (db *DB) writeSnapshot(dat []byte) error {
+	dir := filepath.Dir(db.path)
+	tmp, err := os.CreateTemp(dir, filepath.Base(db.path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath)
+
+	_, err = tmp.Write(dat)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if err == nil {
+		err = tmp.Chmod(0600)
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	err = os.Rename(db.path, db.backupPath())
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	err = os.Rename(tmpPath, db.path)
+	if err != nil {
+		return err
+	}
+	return syncDir(dir)
+}
+
+// recoverSnapshot makes sure db.path holds a readable snapshot. If the file is
+// missing or corrupt but the backup is intact, the backup is restored.
+func (db *DB) recoverSnapshot() error {
+	dat, err := os.ReadFile(db.path)
+	if err == nil && json.Valid(dat) {
+		return nil
+	}
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	missing := errors.Is(err, os.ErrNotExist)
+
+	backup, backupErr := os.ReadFile(db.backupPath())
+	if backupErr != nil || !json.Valid(backup) {
+		if missing {
+			return os.ErrNotExist
+		}
+		return fmt.Errorf("%s is corrupt and no usable backup exists", db.path)
+	}
+
+	if missing {
+		log.Printf("%s is missing, restoring last good snapshot from %s", db.path, db.backupPath())
+	} else {
+		log.Printf("%s is corrupt, restoring last good snapshot from %s", db.path, db.backupPath())
+		err = os.Rename(db.path, db.path+".corrupt")
+		if err != nil {
+			return err
+		}
+	}
+	return db.writeSnapshot(backup)
+}
+
+func (db *DB) backupPath() string {
+	return db.path + ".bak"
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
@@ -0,0 +1,132 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/brookwarren/chirpy/internal/search"
+	"github.com/mattn/go-sqlite3"
+)
+
+// SQLiteDB is a Store backed by an embedded SQLite database.
+type SQLiteDB struct {
+	path        string
+	conn        *sql.DB
+	searchIndex *search.Index
+}
+
+func NewSQLiteDB(path string) (*SQLiteDB, error) {
+	return NewSQLiteDBWithOptions(path, Options{})
+}
+
+func NewSQLiteDBWithOptions(path string, opts Options) (*SQLiteDB, error) {
+	dsn := fmt.Sprintf("file:%s?_busy_timeout=5000&_journal_mode=WAL&_txlock=immediate", path)
+	conn, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	db := &SQLiteDB{
+		path:        path,
+		conn:        conn,
+		searchIndex: search.NewIndex(),
+	}
+	if opts.SkipMigrations {
+		return db, nil
+	}
+	_, err = db.Migrate(false)
+	if err == nil {
+		err = db.checkConsistency()
+	}
+	if err == nil {
+		err = db.buildSearchIndex()
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+func (db *SQLiteDB) Close() error {
+	return db.conn.Close()
+}
+
+// checkConsistency runs SQLite's own integrity check; constraints such as
+// unique emails are enforced by the schema itself.
+func (db *SQLiteDB) checkConsistency() error {
+	var result string
+	err := db.conn.QueryRow("PRAGMA quick_check").Scan(&result)
+	if err != nil {
+		return err
+	}
+	if result != "ok" {
+		return fmt.Errorf("database is inconsistent: %s", result)
+	}
+	return nil
+}
+
+// ResetDB deletes every row but keeps the schema in place.
+func (db *SQLiteDB) ResetDB() error {
+	rows, err := db.conn.Query(`SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%'`)
+	if err != nil {
+		return err
+	}
+	tables := []string{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return err
+		}
+		tables = append(tables, name)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, table := range tables {
+		_, err = tx.Exec(fmt.Sprintf(`DELETE FROM "%s"`, table))
+		if err != nil {
+			return err
+		}
+	}
+	_, err = tx.Exec(`DELETE FROM sqlite_sequence`)
+	if err != nil {
+		return err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	// Searches may be running, so the index is emptied in place rather
+	// than replaced.
+	db.searchIndex.Reset()
+	return nil
+}
+
+func sqliteWhere(filters []string) string {
+	if len(filters) == 0 {
+		return ""
+	}
+	return ` WHERE ` + strings.Join(filters, ` AND `)
+}
+
+func sqlitePlaceholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+func isUniqueViolation(err error) bool {
+	var sqliteErr sqlite3.Error
+	return errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique
+}
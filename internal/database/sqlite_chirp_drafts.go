@@ -0,0 +1,209 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+const sqliteDraftColumns = `id, author_id, body, in_reply_to, media_ids, publish_at, error, created_at, updated_at, visibility`
+
+func (db *SQLiteDB) CreateChirpDraft(params ChirpDraft) (ChirpDraft, error) {
+	visibility := params.Visibility.orPublic()
+	err := visibility.validate()
+	if err != nil {
+		return ChirpDraft{}, err
+	}
+
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return ChirpDraft{}, err
+	}
+	defer tx.Rollback()
+
+	err = sqliteCheckReferences(tx, params.AuthorID, params.InReplyTo, params.MediaIDs)
+	if err != nil {
+		return ChirpDraft{}, err
+	}
+	mediaIDs, err := json.Marshal(params.MediaIDs)
+	if err != nil {
+		return ChirpDraft{}, err
+	}
+
+	now := time.Now().UTC()
+	draft, err := scanDraft(tx.QueryRow(
+		`INSERT INTO chirp_drafts (author_id, body, in_reply_to, media_ids, publish_at, created_at, updated_at, visibility)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		RETURNING `+sqliteDraftColumns,
+		params.AuthorID, params.Body, params.InReplyTo, string(mediaIDs), sqlitePublishAt(params), now, now, visibility,
+	))
+	if err != nil {
+		return ChirpDraft{}, err
+	}
+
+	return draft, tx.Commit()
+}
+
+func (db *SQLiteDB) GetChirpDraft(id int) (ChirpDraft, error) {
+	return scanDraft(db.conn.QueryRow(`SELECT `+sqliteDraftColumns+` FROM chirp_drafts WHERE id = ?`, id))
+}
+
+func (db *SQLiteDB) GetChirpDrafts(authorID int) ([]ChirpDraft, error) {
+	return db.queryDrafts(
+		`SELECT `+sqliteDraftColumns+` FROM chirp_drafts WHERE author_id = ? ORDER BY id`,
+		authorID,
+	)
+}
+
+func (db *SQLiteDB) GetDueChirpDrafts(now time.Time) ([]ChirpDraft, error) {
+	return db.queryDrafts(
+		`SELECT `+sqliteDraftColumns+` FROM chirp_drafts
+		WHERE publish_at IS NOT NULL AND publish_at <= ?
+		ORDER BY publish_at, id`,
+		now.UTC(),
+	)
+}
+
+func (db *SQLiteDB) UpdateChirpDraft(params ChirpDraft) (ChirpDraft, error) {
+	visibility := params.Visibility.orPublic()
+	err := visibility.validate()
+	if err != nil {
+		return ChirpDraft{}, err
+	}
+
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return ChirpDraft{}, err
+	}
+	defer tx.Rollback()
+
+	existing, err := scanDraft(tx.QueryRow(`SELECT `+sqliteDraftColumns+` FROM chirp_drafts WHERE id = ?`, params.ID))
+	if err != nil {
+		return ChirpDraft{}, err
+	}
+	err = sqliteCheckReferences(tx, existing.AuthorID, params.InReplyTo, params.MediaIDs)
+	if err != nil {
+		return ChirpDraft{}, err
+	}
+	mediaIDs, err := json.Marshal(params.MediaIDs)
+	if err != nil {
+		return ChirpDraft{}, err
+	}
+
+	draft, err := scanDraft(tx.QueryRow(
+		`UPDATE chirp_drafts SET body = ?, in_reply_to = ?, media_ids = ?, publish_at = ?, error = ?, updated_at = ?,
+			visibility = ?
+		WHERE id = ?
+		RETURNING `+sqliteDraftColumns,
+		params.Body, params.InReplyTo, string(mediaIDs), sqlitePublishAt(params), params.Error, time.Now().UTC(),
+		visibility, params.ID,
+	))
+	if err != nil {
+		return ChirpDraft{}, err
+	}
+
+	return draft, tx.Commit()
+}
+
+func (db *SQLiteDB) UnscheduleChirpDraft(id int, reason string) error {
+	res, err := db.conn.Exec(
+		`UPDATE chirp_drafts SET publish_at = NULL, error = ?, updated_at = ? WHERE id = ?`,
+		reason, time.Now().UTC(), id,
+	)
+	if err != nil {
+		return err
+	}
+	updated, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if updated == 0 {
+		return ErrNotExist
+	}
+	return nil
+}
+
+func (db *SQLiteDB) DeleteChirpDraft(id int) error {
+	_, err := db.conn.Exec(`DELETE FROM chirp_drafts WHERE id = ?`, id)
+	return err
+}
+
+func (db *SQLiteDB) PublishChirpDraft(id int, body string) (Chirp, error) {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return Chirp{}, err
+	}
+	defer tx.Rollback()
+
+	draft, err := scanDraft(tx.QueryRow(
+		`DELETE FROM chirp_drafts WHERE id = ? RETURNING `+sqliteDraftColumns,
+		id,
+	))
+	if err != nil {
+		return Chirp{}, err
+	}
+	chirp, err := sqliteInsertChirp(tx, Chirp{
+		AuthorID:   draft.AuthorID,
+		Body:       body,
+		InReplyTo:  draft.InReplyTo,
+		MediaIDs:   draft.MediaIDs,
+		Visibility: draft.Visibility,
+	})
+	if err != nil {
+		return Chirp{}, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return Chirp{}, err
+	}
+	db.searchIndex.Add(chirp.ID, chirp.Body)
+
+	return chirp, nil
+}
+
+// sqlitePublishAt stores an unscheduled draft's publish time as NULL, so
+// only scheduled drafts are in the publish_at index.
+func sqlitePublishAt(draft ChirpDraft) any {
+	if !draft.Scheduled() {
+		return nil
+	}
+	return draft.PublishAt.UTC()
+}
+
+func (db *SQLiteDB) queryDrafts(query string, args ...any) ([]ChirpDraft, error) {
+	rows, err := db.conn.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	drafts := []ChirpDraft{}
+	for rows.Next() {
+		draft, err := scanDraft(rows)
+		if err != nil {
+			return nil, err
+		}
+		drafts = append(drafts, draft)
+	}
+	return drafts, rows.Err()
+}
+
+func scanDraft(row rowScanner) (ChirpDraft, error) {
+	draft := ChirpDraft{}
+	var mediaIDs string
+	var publishAt sql.NullTime
+	err := row.Scan(
+		&draft.ID, &draft.AuthorID, &draft.Body, &draft.InReplyTo, &mediaIDs,
+		&publishAt, &draft.Error, &draft.CreatedAt, &draft.UpdatedAt, &draft.Visibility,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ChirpDraft{}, ErrNotExist
+	}
+	if err != nil {
+		return ChirpDraft{}, err
+	}
+	draft.PublishAt = publishAt.Time
+	return draft, json.Unmarshal([]byte(mediaIDs), &draft.MediaIDs)
+}
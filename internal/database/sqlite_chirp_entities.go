@@ -0,0 +1,224 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+// sqliteMentionResolver is DBStructure.mentionResolver for SQLite. An
+// authorID of 0 skips the block check.
+func sqliteMentionResolver(q sqliteQueryer, authorID int) func(username string) (int, error) {
+	return func(username string) (int, error) {
+		var id int
+		err := q.QueryRow(`SELECT id FROM users WHERE handle = ? COLLATE NOCASE`, username).Scan(&id)
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, nil
+		}
+		if err != nil || authorID == 0 {
+			return id, err
+		}
+		err = sqliteCheckBlocked(q, authorID, id)
+		if errors.Is(err, ErrBlocked) {
+			return 0, nil
+		}
+		return id, err
+	}
+}
+
+// sqliteIndexEntities replaces the hashtag and mention index rows of chirp.
+func sqliteIndexEntities(tx *sql.Tx, chirp Chirp) error {
+	_, err := tx.Exec(`DELETE FROM chirp_hashtags WHERE chirp_id = ?`, chirp.ID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`DELETE FROM chirp_mentions WHERE chirp_id = ?`, chirp.ID)
+	if err != nil {
+		return err
+	}
+	for _, tag := range tags(chirp.Hashtags) {
+		_, err = tx.Exec(
+			`INSERT INTO chirp_hashtags (tag, chirp_id, created_at) VALUES (?, ?, ?)`,
+			tag, chirp.ID, chirp.CreatedAt,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	for _, userID := range mentionedUserIDs(chirp.Mentions) {
+		_, err = tx.Exec(`INSERT INTO chirp_mentions (user_id, chirp_id) VALUES (?, ?)`, userID, chirp.ID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sqliteEntityColumns encodes the hashtags and mentions of a chirp for the
+// chirps table.
+func sqliteEntityColumns(chirp Chirp) (string, string, error) {
+	hashtags, err := json.Marshal(chirp.Hashtags)
+	if err != nil {
+		return "", "", err
+	}
+	mentions, err := json.Marshal(chirp.Mentions)
+	if err != nil {
+		return "", "", err
+	}
+	return string(hashtags), string(mentions), nil
+}
+
+func (db *SQLiteDB) TrendingHashtags(window, halfLife time.Duration, limit int) ([]TrendingHashtag, error) {
+	now := time.Now().UTC()
+	rows, err := db.conn.Query(
+		`SELECT tag, created_at FROM chirp_hashtags
+		WHERE created_at >= ? AND chirp_id IN (SELECT id FROM chirps WHERE visibility = 'public' AND NOT hidden)`,
+		now.Add(-window),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	uses := []hashtagUse{}
+	for rows.Next() {
+		use := hashtagUse{}
+		err := rows.Scan(&use.Tag, &use.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		uses = append(uses, use)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return rankHashtags(uses, now, halfLife, limit), nil
+}
+
+// sqliteBackfillMentionResolver resolves mentions as they were when
+// backfillChirpEntities was written: by email address only. It must only
+// rely on the schema as of that migration, which has neither handles nor
+// blocks. Migration 20 unresolves them again, like every other email
+// mention.
+func sqliteBackfillMentionResolver(tx *sql.Tx) func(username string) (int, error) {
+	return func(username string) (int, error) {
+		if !strings.Contains(username, "@") {
+			return 0, nil
+		}
+		var id int
+		err := tx.QueryRow(`SELECT id FROM users WHERE email = ?`, username).Scan(&id)
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, nil
+		}
+		return id, err
+	}
+}
+
+// backfillChirpEntities parses the hashtags and mentions out of the chirps
+// posted before they were extracted.
+func backfillChirpEntities(tx *sql.Tx) error {
+	rows, err := tx.Query(`SELECT id, body, created_at FROM chirps`)
+	if err != nil {
+		return err
+	}
+	chirps := []Chirp{}
+	for rows.Next() {
+		chirp := Chirp{}
+		err := rows.Scan(&chirp.ID, &chirp.Body, &chirp.CreatedAt)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		chirps = append(chirps, chirp)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, chirp := range chirps {
+		chirp.Hashtags, chirp.Mentions, err = parseEntities(chirp.Body, sqliteBackfillMentionResolver(tx))
+		if err != nil {
+			return err
+		}
+		hashtags, mentions, err := sqliteEntityColumns(chirp)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(`UPDATE chirps SET hashtags = ?, mentions = ? WHERE id = ?`, hashtags, mentions, chirp.ID)
+		if err != nil {
+			return err
+		}
+		err = sqliteIndexEntities(tx, chirp)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// unresolveEmailMentions is migrateEmailMentions for SQLite.
+func unresolveEmailMentions(tx *sql.Tx) error {
+	rows, err := tx.Query(`SELECT id, mentions FROM chirps WHERE mentions != '[]'`)
+	if err != nil {
+		return err
+	}
+	chirps := []Chirp{}
+	for rows.Next() {
+		chirp := Chirp{}
+		var mentions string
+		err := rows.Scan(&chirp.ID, &mentions)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		err = json.Unmarshal([]byte(mentions), &chirp.Mentions)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		chirps = append(chirps, chirp)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, chirp := range chirps {
+		var unmentioned []int
+		chirp.Mentions, unmentioned = withoutEmailMentions(chirp.Mentions)
+		mentions, err := json.Marshal(chirp.Mentions)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(`UPDATE chirps SET mentions = ? WHERE id = ?`, string(mentions), chirp.ID)
+		if err != nil {
+			return err
+		}
+		for _, userID := range unmentioned {
+			_, err = tx.Exec(`DELETE FROM chirp_mentions WHERE user_id = ? AND chirp_id = ?`, userID, chirp.ID)
+			if err != nil {
+				return err
+			}
+			_, err = tx.Exec(
+				`DELETE FROM notification_actors WHERE notification_id IN
+					(SELECT id FROM notifications WHERE user_id = ? AND kind = ? AND chirp_id = ?)`,
+				userID, NotificationMention, chirp.ID,
+			)
+			if err != nil {
+				return err
+			}
+			_, err = tx.Exec(
+				`DELETE FROM notifications WHERE user_id = ? AND kind = ? AND chirp_id = ?`,
+				userID, NotificationMention, chirp.ID,
+			)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package database
+
+import (
+	"encoding/json"
+
+	"github.com/brookwarren/chirpy/internal/search"
+)
+
+// buildSearchIndex indexes every stored chirp. The index lives in memory and
+// is rebuilt each time the database is opened.
+func (db *SQLiteDB) buildSearchIndex() error {
+	rows, err := db.conn.Query(`SELECT id, body FROM chirps`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	index := search.NewIndex()
+	for rows.Next() {
+		var id int
+		var body string
+		err := rows.Scan(&id, &body)
+		if err != nil {
+			return err
+		}
+		index.Add(id, body)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	db.searchIndex = index
+	return nil
+}
+
+func (db *SQLiteDB) SearchChirps(s ChirpSearch) ([]Chirp, error) {
+	q, err := search.ParseQuery(s.Query)
+	if err != nil {
+		return nil, err
+	}
+	matches := db.searchIndex.Search(q)
+	if len(matches) == 0 {
+		return []Chirp{}, nil
+	}
+
+	ids := make([]int, 0, len(matches))
+	for _, match := range matches {
+		ids = append(ids, match.ID)
+	}
+	idsJSON, err := json.Marshal(ids)
+	if err != nil {
+		return nil, err
+	}
+	chirps, err := db.queryChirps(
+		`SELECT `+sqliteChirpColumns+` FROM chirps WHERE id IN (SELECT value FROM json_each(?))`,
+		string(idsJSON),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	hidden, err := db.hiddenFrom(s.ViewerID, s.HideMuted)
+	if err != nil {
+		return nil, err
+	}
+	following, err := db.following(s.ViewerID)
+	if err != nil {
+		return nil, err
+	}
+
+	byID := make(map[int]Chirp, len(chirps))
+	for _, chirp := range chirps {
+		byID[chirp.ID] = chirp
+	}
+	return s.rank(matches, func(id int) (Chirp, bool) {
+		chirp, ok := byID[id]
+		return chirp, ok
+	}, hidden, following), nil
+}
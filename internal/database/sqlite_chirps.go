@@ -0,0 +1,669 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+const sqliteChirpColumns = `id, author_id, body, in_reply_to, hashtags, mentions, media_ids, created_at, updated_at, visibility, hidden`
+
+func (db *SQLiteDB) CreateChirp(params Chirp) (Chirp, error) {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return Chirp{}, err
+	}
+	defer tx.Rollback()
+
+	chirp, err := sqliteInsertChirp(tx, params)
+	if err != nil {
+		return Chirp{}, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return Chirp{}, err
+	}
+	db.searchIndex.Add(chirp.ID, chirp.Body)
+
+	return chirp, nil
+}
+
+// sqliteInsertChirp is CreateChirp within tx. The caller adds the chirp to the
+// search index once tx commits.
+func sqliteInsertChirp(tx *sql.Tx, params Chirp) (Chirp, error) {
+	visibility := params.Visibility.orPublic()
+	err := visibility.validate()
+	if err != nil {
+		return Chirp{}, err
+	}
+	err = sqliteCheckReferences(tx, params.AuthorID, params.InReplyTo, params.MediaIDs)
+	if err != nil {
+		return Chirp{}, err
+	}
+
+	now := time.Now().UTC()
+	chirp := Chirp{
+		AuthorID:   params.AuthorID,
+		Body:       params.Body,
+		InReplyTo:  params.InReplyTo,
+		MediaIDs:   params.MediaIDs,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+		Visibility: visibility,
+	}
+	chirp.Hashtags, chirp.Mentions, err = parseEntities(chirp.Body, sqliteMentionResolver(tx, chirp.AuthorID))
+	if err != nil {
+		return Chirp{}, err
+	}
+	hashtags, mentions, err := sqliteEntityColumns(chirp)
+	if err != nil {
+		return Chirp{}, err
+	}
+	mediaIDs, err := json.Marshal(chirp.MediaIDs)
+	if err != nil {
+		return Chirp{}, err
+	}
+
+	res, err := tx.Exec(
+		`INSERT INTO chirps (author_id, body, in_reply_to, hashtags, mentions, media_ids, created_at, updated_at, visibility)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		chirp.AuthorID, chirp.Body, chirp.InReplyTo, hashtags, mentions, string(mediaIDs), now, now, chirp.Visibility,
+	)
+	if err != nil {
+		return Chirp{}, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return Chirp{}, err
+	}
+	chirp.ID = int(id)
+	_, err = tx.Exec(
+		`INSERT INTO chirp_revisions (chirp_id, version, body, created_at) VALUES (?, 1, ?, ?)`,
+		chirp.ID, chirp.Body, now,
+	)
+	if err != nil {
+		return Chirp{}, err
+	}
+	err = sqliteIndexEntities(tx, chirp)
+	if err != nil {
+		return Chirp{}, err
+	}
+	for _, mediaID := range chirp.MediaIDs {
+		_, err = tx.Exec(`INSERT INTO chirp_media (media_id, chirp_id) VALUES (?, ?)`, mediaID, chirp.ID)
+		if err != nil {
+			return Chirp{}, err
+		}
+	}
+	err = sqliteNotifyChirp(tx, chirp)
+	if err != nil {
+		return Chirp{}, err
+	}
+	return chirp, nil
+}
+
+// sqliteCheckReferences makes sure the chirp a new chirp by authorID
+// replies to exists and is visible to them, that the media it attaches are
+// theirs, and that the author of the parent and authorID haven't blocked each
+// other.
+func sqliteCheckReferences(q sqliteQueryer, authorID, inReplyTo int, mediaIDs []int) error {
+	if inReplyTo != 0 {
+		parent, err := scanChirp(q.QueryRow(`SELECT `+sqliteChirpColumns+` FROM chirps WHERE id = ?`, inReplyTo))
+		if errors.Is(err, ErrNotExist) {
+			return ErrParentNotExist
+		}
+		if err != nil {
+			return err
+		}
+		visible, err := sqliteVisibleTo(q, parent, authorID)
+		if err != nil {
+			return err
+		}
+		if !visible {
+			return ErrParentNotExist
+		}
+		err = sqliteCheckBlocked(q, authorID, parent.AuthorID)
+		if err != nil {
+			return err
+		}
+	}
+	return sqliteCheckMediaIDs(q, authorID, mediaIDs)
+}
+
+func (db *SQLiteDB) GetChirps() ([]Chirp, error) {
+	return db.queryChirps(`SELECT ` + sqliteChirpColumns + ` FROM chirps`)
+}
+
+func (db *SQLiteDB) GetChirp(id int) (Chirp, error) {
+	row := db.conn.QueryRow(`SELECT `+sqliteChirpColumns+` FROM chirps WHERE id = ?`, id)
+	return scanChirp(row)
+}
+
+func (db *SQLiteDB) UpdateChirp(id int, body string) (Chirp, error) {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return Chirp{}, err
+	}
+	defer tx.Rollback()
+
+	old, err := scanChirp(tx.QueryRow(`SELECT `+sqliteChirpColumns+` FROM chirps WHERE id = ?`, id))
+	if err != nil {
+		return Chirp{}, err
+	}
+
+	update := Chirp{Body: body}
+	update.Hashtags, update.Mentions, err = parseEntities(body, sqliteMentionResolver(tx, old.AuthorID))
+	if err != nil {
+		return Chirp{}, err
+	}
+	hashtags, mentions, err := sqliteEntityColumns(update)
+	if err != nil {
+		return Chirp{}, err
+	}
+
+	now := time.Now().UTC()
+	row := tx.QueryRow(
+		`UPDATE chirps SET body = ?, hashtags = ?, mentions = ?, updated_at = ? WHERE id = ? RETURNING `+sqliteChirpColumns,
+		body, hashtags, mentions, now, id,
+	)
+	chirp, err := scanChirp(row)
+	if err != nil {
+		return Chirp{}, err
+	}
+	err = sqliteIndexEntities(tx, chirp)
+	if err != nil {
+		return Chirp{}, err
+	}
+	err = sqliteNotifyMentions(tx, chirp, mentionedUserIDs(old.Mentions))
+	if err != nil {
+		return Chirp{}, err
+	}
+	_, err = tx.Exec(
+		`INSERT INTO chirp_revisions (chirp_id, version, body, created_at)
+		SELECT ?, COALESCE(MAX(version), 0) + 1, ?, ? FROM chirp_revisions WHERE chirp_id = ?`,
+		id, body, now, id,
+	)
+	if err != nil {
+		return Chirp{}, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return Chirp{}, err
+	}
+	db.searchIndex.Add(id, body)
+
+	return chirp, nil
+}
+
+func (db *SQLiteDB) GetChirpHistory(id int) ([]ChirpRevision, error) {
+	_, err := db.GetChirp(id)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.conn.Query(
+		`SELECT version, body, created_at FROM chirp_revisions WHERE chirp_id = ? ORDER BY version`,
+		id,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revisions := []ChirpRevision{}
+	for rows.Next() {
+		revision := ChirpRevision{}
+		err := rows.Scan(&revision.Version, &revision.Body, &revision.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, revision)
+	}
+	return revisions, rows.Err()
+}
+
+func (db *SQLiteDB) DeleteChirp(id int) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = sqliteDeleteChirp(tx, id)
+	if errors.Is(err, ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+	db.searchIndex.Remove(id)
+
+	return nil
+}
+
+func (db *SQLiteDB) DeleteChirpAsModerator(id, moderatorID int, reason string) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	authorID, err := sqliteChirpAuthor(tx, id)
+	if err != nil {
+		return err
+	}
+	err = sqliteCheckOutranks(tx, moderatorID, authorID)
+	if err != nil {
+		return err
+	}
+	_, err = sqliteDeleteChirp(tx, id)
+	if err != nil {
+		return err
+	}
+	err = sqliteLogModeration(tx, ModerationAction{
+		ModeratorID: moderatorID,
+		Kind:        ModerationDeleteChirp,
+		ChirpID:     id,
+		UserID:      authorID,
+		Reason:      reason,
+		CreatedAt:   time.Now().UTC(),
+	})
+	if err != nil {
+		return err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+	db.searchIndex.Remove(id)
+
+	return nil
+}
+
+// sqliteDeleteChirp is DBStructure.deleteChirp within tx. It returns the
+// chirp's author.
+func sqliteDeleteChirp(tx *sql.Tx, id int) (int, error) {
+	var inReplyTo, authorID int
+	err := tx.QueryRow(`DELETE FROM chirps WHERE id = ? RETURNING in_reply_to, author_id`, id).Scan(&inReplyTo, &authorID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrNotExist
+	}
+	if err != nil {
+		return 0, err
+	}
+	_, err = tx.Exec(`DELETE FROM chirp_revisions WHERE chirp_id = ?`, id)
+	if err != nil {
+		return 0, err
+	}
+	for _, table := range []string{`reactions`, `chirp_hashtags`, `chirp_mentions`, `chirp_media`} {
+		_, err = tx.Exec(`DELETE FROM `+table+` WHERE chirp_id = ?`, id)
+		if err != nil {
+			return 0, err
+		}
+	}
+	err = sqliteDeleteChirpNotifications(tx, id)
+	if err != nil {
+		return 0, err
+	}
+	_, err = tx.Exec(
+		`INSERT INTO chirp_tombstones (id, in_reply_to, deleted_at)
+		SELECT ?, ?, ? WHERE EXISTS (SELECT 1 FROM chirps WHERE in_reply_to = ?)
+			OR EXISTS (SELECT 1 FROM chirp_tombstones WHERE in_reply_to = ?)`,
+		id, inReplyTo, time.Now().UTC(), id, id,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return authorID, nil
+}
+
+func (db *SQLiteDB) QueryChirps(q ChirpQuery) (ChirpPage, error) {
+	err := q.validate()
+	if err != nil {
+		return ChirpPage{}, err
+	}
+	hidden, err := db.hiddenFrom(q.ViewerID, q.HideMuted)
+	if err != nil {
+		return ChirpPage{}, err
+	}
+	q, ok := q.hide(hidden)
+	if !ok {
+		return ChirpPage{Chirps: []Chirp{}, Rechirps: map[int]Reaction{}}, nil
+	}
+
+	source, sourceArgs := q.sqliteSource()
+	filters, args := q.sqliteFilters()
+	args = append(sourceArgs, args...)
+
+	// Walking backwards from a cursor fetches in reverse sort order and flips
+	// the page afterwards.
+	cursor, backward := q.After, false
+	if q.Before != nil {
+		cursor, backward = q.Before, true
+	}
+	descending := q.Descending != backward
+
+	pageFilters, pageArgs := filters, args
+	if cursor != nil {
+		cond, condArgs := q.sqliteAfterCursor(*cursor, descending)
+		pageFilters = append(append([]string{}, filters...), cond)
+		pageArgs = append(append([]any{}, args...), condArgs...)
+	}
+	query := `SELECT ` + sqliteChirpColumns + ` FROM ` + source + sqliteWhere(pageFilters) + ` ORDER BY ` + q.sqliteOrder(descending)
+	if q.Limit > 0 {
+		query += ` LIMIT ?`
+		pageArgs = append(pageArgs, q.Limit+1)
+	}
+
+	chirps, err := db.queryChirps(query, pageArgs...)
+	if err != nil {
+		return ChirpPage{}, err
+	}
+	more := false
+	if q.Limit > 0 && len(chirps) > q.Limit {
+		chirps = chirps[:q.Limit]
+		more = true
+	}
+
+	behind := false
+	if cursor != nil {
+		cond, condArgs := q.sqliteAfterCursor(*cursor, descending)
+		existsFilters := append(append([]string{}, filters...), `NOT `+cond)
+		existsArgs := append(append([]any{}, args...), condArgs...)
+		err = db.conn.QueryRow(
+			`SELECT EXISTS (SELECT 1 FROM `+source+sqliteWhere(existsFilters)+`)`,
+			existsArgs...,
+		).Scan(&behind)
+		if err != nil {
+			return ChirpPage{}, err
+		}
+	}
+
+	rechirps, err := db.feedRechirps(q, chirps)
+	if err != nil {
+		return ChirpPage{}, err
+	}
+
+	if backward {
+		for i, j := 0, len(chirps)-1; i < j; i, j = i+1, j-1 {
+			chirps[i], chirps[j] = chirps[j], chirps[i]
+		}
+		return ChirpPage{Chirps: chirps, HasPrev: more, HasNext: behind, Rechirps: rechirps}, nil
+	}
+	return ChirpPage{Chirps: chirps, HasPrev: behind, HasNext: more, Rechirps: rechirps}, nil
+}
+
+func (q ChirpQuery) sqliteFeed() bool {
+	return q.IncludeRechirps && len(q.AuthorIDs) > 0
+}
+
+// sqliteSource is what a query selects chirps from. For a feed that includes
+// rechirps it is a subquery adding feed_at, the time each chirp is placed at.
+func (q ChirpQuery) sqliteSource() (string, []any) {
+	if !q.sqliteFeed() {
+		return `chirps`, nil
+	}
+
+	authors := sqlitePlaceholders(len(q.AuthorIDs))
+	args := []any{}
+	for i := 0; i < 2; i++ {
+		for _, authorID := range q.AuthorIDs {
+			args = append(args, authorID)
+		}
+	}
+	return `(
+		SELECT chirps.id, chirps.author_id, chirps.body, chirps.in_reply_to, chirps.hashtags,
+			chirps.mentions, chirps.media_ids, chirps.created_at, chirps.updated_at, chirps.visibility,
+			chirps.hidden, feed.at AS feed_at
+		FROM chirps JOIN (
+			SELECT chirp_id, MAX(at) AS at FROM (
+				SELECT id AS chirp_id, created_at AS at FROM chirps WHERE author_id IN (` + authors + `)
+				UNION ALL
+				SELECT chirp_id, created_at FROM reactions WHERE kind = 'rechirp' AND user_id IN (` + authors + `)
+			) GROUP BY chirp_id
+		) AS feed ON feed.chirp_id = chirps.id
+	) AS chirps`, args
+}
+
+// sqliteTimeColumn is the column chirps are placed by in time.
+func (q ChirpQuery) sqliteTimeColumn() string {
+	if q.sqliteFeed() {
+		return `feed_at`
+	}
+	return `created_at`
+}
+
+func (q ChirpQuery) sqliteFilters() ([]string, []any) {
+	filters := []string{}
+	args := []any{}
+	if len(q.AuthorIDs) > 0 && !q.sqliteFeed() {
+		filters = append(filters, `author_id IN (`+sqlitePlaceholders(len(q.AuthorIDs))+`)`)
+		for _, authorID := range q.AuthorIDs {
+			args = append(args, authorID)
+		}
+	}
+	if len(q.hidden) > 0 {
+		filters = append(filters, `author_id NOT IN (`+sqlitePlaceholders(len(q.hidden))+`)`)
+		for _, userID := range sortedKeys(q.hidden) {
+			args = append(args, userID)
+		}
+	}
+	visibility, visibilityArgs := q.sqliteVisibility()
+	filters = append(filters, visibility)
+	args = append(args, visibilityArgs...)
+	if q.Hashtag != "" {
+		filters = append(filters, `id IN (SELECT chirp_id FROM chirp_hashtags WHERE tag = ?)`)
+		args = append(args, q.Hashtag)
+	}
+	if q.MentionedUserID != 0 {
+		filters = append(filters, `id IN (SELECT chirp_id FROM chirp_mentions WHERE user_id = ?)`)
+		args = append(args, q.MentionedUserID)
+	}
+	if !q.Since.IsZero() {
+		filters = append(filters, q.sqliteTimeColumn()+` >= ?`)
+		args = append(args, q.Since.UTC())
+	}
+	if !q.Until.IsZero() {
+		filters = append(filters, q.sqliteTimeColumn()+` < ?`)
+		args = append(args, q.Until.UTC())
+	}
+	return filters, args
+}
+
+// sqliteVisibility matches the chirps listed for the viewer, as
+// Chirp.listedFor does.
+func (q ChirpQuery) sqliteVisibility() (string, []any) {
+	cond := `visibility = 'public'`
+	if q.scoped() {
+		cond += ` OR visibility = 'unlisted'`
+	}
+	if q.ViewerID == 0 {
+		return `(NOT hidden AND (` + cond + `))`, nil
+	}
+	cond += ` OR (visibility = 'followers'
+		AND author_id IN (SELECT followee_id FROM follows WHERE follower_id = ?))`
+	return `(author_id = ? OR (NOT hidden AND (` + cond + `)))`, []any{q.ViewerID, q.ViewerID}
+}
+
+// sqliteAfterCursor matches the rows that come after cursor when sorting in
+// the given direction.
+func (q ChirpQuery) sqliteAfterCursor(cursor ChirpCursor, descending bool) (string, []any) {
+	op := ">"
+	if descending {
+		op = "<"
+	}
+	if q.SortBy == ChirpSortCreatedAt {
+		column := q.sqliteTimeColumn()
+		createdAt := cursor.CreatedAt.UTC()
+		return `(` + column + ` ` + op + ` ? OR (` + column + ` = ? AND id ` + op + ` ?))`, []any{createdAt, createdAt, cursor.ID}
+	}
+	return `id ` + op + ` ?`, []any{cursor.ID}
+}
+
+func (q ChirpQuery) sqliteOrder(descending bool) string {
+	direction := "ASC"
+	if descending {
+		direction = "DESC"
+	}
+	if q.SortBy == ChirpSortCreatedAt {
+		return q.sqliteTimeColumn() + ` ` + direction + `, id ` + direction
+	}
+	return `id ` + direction
+}
+
+// feedRechirps finds the rechirps that placed chirps in a feed.
+func (db *SQLiteDB) feedRechirps(q ChirpQuery, chirps []Chirp) (map[int]Reaction, error) {
+	feed := map[int]Reaction{}
+	if !q.sqliteFeed() || len(chirps) == 0 {
+		return feed, nil
+	}
+
+	args := []any{}
+	for _, chirp := range chirps {
+		args = append(args, chirp.ID)
+	}
+	for _, authorID := range q.AuthorIDs {
+		args = append(args, authorID)
+	}
+	rows, err := db.conn.Query(
+		`SELECT `+sqliteReactionColumns+` FROM reactions
+		WHERE kind = 'rechirp' AND chirp_id IN (`+sqlitePlaceholders(len(chirps))+`)
+			AND user_id IN (`+sqlitePlaceholders(len(q.AuthorIDs))+`)`,
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	byChirp := map[int][]Reaction{}
+	for rows.Next() {
+		rechirp, err := scanReaction(rows)
+		if err != nil {
+			return nil, err
+		}
+		byChirp[rechirp.ChirpID] = append(byChirp[rechirp.ChirpID], rechirp)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	authors := map[int]struct{}{}
+	for _, authorID := range q.AuthorIDs {
+		authors[authorID] = struct{}{}
+	}
+	for _, chirp := range chirps {
+		if rechirp, ok := feedRechirp(chirp, authors, byChirp[chirp.ID]); ok {
+			feed[chirp.ID] = rechirp
+		}
+	}
+	return feed, nil
+}
+
+func (db *SQLiteDB) queryChirps(query string, args ...any) ([]Chirp, error) {
+	rows, err := db.conn.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	chirps := []Chirp{}
+	for rows.Next() {
+		chirp, err := scanChirp(rows)
+		if err != nil {
+			return nil, err
+		}
+		chirps = append(chirps, chirp)
+	}
+	return chirps, rows.Err()
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanChirp(row rowScanner) (Chirp, error) {
+	chirp := Chirp{}
+	var hashtags, mentions, mediaIDs string
+	err := row.Scan(
+		&chirp.ID, &chirp.AuthorID, &chirp.Body, &chirp.InReplyTo,
+		&hashtags, &mentions, &mediaIDs, &chirp.CreatedAt, &chirp.UpdatedAt, &chirp.Visibility,
+		&chirp.Hidden,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Chirp{}, ErrNotExist
+	}
+	if err != nil {
+		return Chirp{}, err
+	}
+	return chirp, decodeChirpEntities(&chirp, hashtags, mentions, mediaIDs)
+}
+
+// decodeChirpEntities fills in chirp's hashtags, mentions and media from
+// their encoding in the chirps table.
+func decodeChirpEntities(chirp *Chirp, hashtags, mentions, mediaIDs string) error {
+	err := json.Unmarshal([]byte(hashtags), &chirp.Hashtags)
+	if err != nil {
+		return err
+	}
+	err = json.Unmarshal([]byte(mentions), &chirp.Mentions)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal([]byte(mediaIDs), &chirp.MediaIDs)
+}
+
+// sqliteChirpAuthor returns who wrote a chirp, or ErrNotExist if there is
+// no such chirp.
+func sqliteChirpAuthor(q sqliteQueryer, id int) (int, error) {
+	var authorID int
+	err := q.QueryRow(`SELECT author_id FROM chirps WHERE id = ?`, id).Scan(&authorID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrNotExist
+	}
+	return authorID, err
+}
+
+func (db *SQLiteDB) CanViewChirp(chirp Chirp, viewerID int) (bool, error) {
+	return sqliteCanView(db.conn, chirp, viewerID)
+}
+
+// sqliteCanView is DBStructure.canView.
+func sqliteCanView(q sqliteQueryer, chirp Chirp, viewerID int) (bool, error) {
+	if viewerID != 0 && viewerID != chirp.AuthorID {
+		err := sqliteCheckBlocked(q, viewerID, chirp.AuthorID)
+		if errors.Is(err, ErrBlocked) {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+	}
+	return sqliteVisibleTo(q, chirp, viewerID)
+}
+
+// sqliteVisibleTo is Chirp.visibleTo, looking up whether viewerID follows
+// the author of a followers-only chirp.
+func sqliteVisibleTo(q sqliteQueryer, chirp Chirp, viewerID int) (bool, error) {
+	following := map[int]struct{}{}
+	if chirp.Visibility == VisibilityFollowers && viewerID != 0 {
+		var follows bool
+		err := q.QueryRow(
+			`SELECT EXISTS (SELECT 1 FROM follows WHERE follower_id = ? AND followee_id = ?)`,
+			viewerID, chirp.AuthorID,
+		).Scan(&follows)
+		if err != nil {
+			return false, err
+		}
+		if follows {
+			following[chirp.AuthorID] = struct{}{}
+		}
+	}
+	return chirp.visibleTo(viewerID, following), nil
+}
@@ -0,0 +1,213 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	sqliteConversationColumns = `id, creator_id, member_ids, created_at, updated_at`
+	sqliteMessageColumns      = `id, conversation_id, sender_id, body, created_at`
+)
+
+func (db *SQLiteDB) CreateConversation(creatorID int, memberIDs []int) (Conversation, bool, error) {
+	members := conversationMembers(creatorID, memberIDs)
+
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return Conversation{}, false, err
+	}
+	defer tx.Rollback()
+
+	for _, id := range members {
+		err = sqliteUserExists(tx, id)
+		if err != nil {
+			return Conversation{}, false, err
+		}
+		err = sqliteCheckBlocked(tx, creatorID, id)
+		if err != nil {
+			return Conversation{}, false, err
+		}
+	}
+
+	// direct_key is only set for direct conversations, where its unique
+	// index keeps one conversation per pair.
+	var key any
+	if len(members) == 2 {
+		key = fmt.Sprintf("%d:%d", members[0], members[1])
+		conversation, err := scanConversation(tx.QueryRow(
+			`SELECT `+sqliteConversationColumns+` FROM conversations WHERE direct_key = ?`,
+			key,
+		))
+		if err == nil {
+			return conversation, false, tx.Commit()
+		}
+		if !errors.Is(err, ErrNotExist) {
+			return Conversation{}, false, err
+		}
+	}
+	membersJSON, err := json.Marshal(members)
+	if err != nil {
+		return Conversation{}, false, err
+	}
+
+	now := time.Now().UTC()
+	conversation, err := scanConversation(tx.QueryRow(
+		`INSERT INTO conversations (creator_id, member_ids, direct_key, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?)
+		RETURNING `+sqliteConversationColumns,
+		creatorID, string(membersJSON), key, now, now,
+	))
+	if err != nil {
+		return Conversation{}, false, err
+	}
+	for _, id := range members {
+		_, err = tx.Exec(
+			`INSERT INTO conversation_members (conversation_id, user_id) VALUES (?, ?)`,
+			conversation.ID, id,
+		)
+		if err != nil {
+			return Conversation{}, false, err
+		}
+	}
+
+	return conversation, true, tx.Commit()
+}
+
+func (db *SQLiteDB) GetConversation(id int) (Conversation, error) {
+	return scanConversation(db.conn.QueryRow(
+		`SELECT `+sqliteConversationColumns+` FROM conversations WHERE id = ?`,
+		id,
+	))
+}
+
+func (db *SQLiteDB) GetConversations(userID int) ([]Conversation, error) {
+	rows, err := db.conn.Query(
+		`SELECT `+sqliteConversationColumns+` FROM conversations
+		WHERE id IN (SELECT conversation_id FROM conversation_members WHERE user_id = ?)
+		ORDER BY updated_at DESC, id DESC`,
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	conversations := []Conversation{}
+	for rows.Next() {
+		conversation, err := scanConversation(rows)
+		if err != nil {
+			return nil, err
+		}
+		conversations = append(conversations, conversation)
+	}
+	return conversations, rows.Err()
+}
+
+func (db *SQLiteDB) CreateMessage(conversationID, senderID int, body string) (Message, error) {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return Message{}, err
+	}
+	defer tx.Rollback()
+
+	conversation, err := scanConversation(tx.QueryRow(
+		`SELECT `+sqliteConversationColumns+` FROM conversations WHERE id = ?`,
+		conversationID,
+	))
+	if err != nil {
+		return Message{}, err
+	}
+	if conversation.Direct() {
+		err = sqliteCheckBlocked(tx, conversation.MemberIDs[0], conversation.MemberIDs[1])
+		if err != nil {
+			return Message{}, err
+		}
+	}
+
+	now := time.Now().UTC()
+	message, err := scanMessage(tx.QueryRow(
+		`INSERT INTO messages (conversation_id, sender_id, body, created_at) VALUES (?, ?, ?, ?)
+		RETURNING `+sqliteMessageColumns,
+		conversationID, senderID, body, now,
+	))
+	if err != nil {
+		return Message{}, err
+	}
+	_, err = tx.Exec(`UPDATE conversations SET updated_at = ? WHERE id = ?`, now, conversationID)
+	if err != nil {
+		return Message{}, err
+	}
+
+	return message, tx.Commit()
+}
+
+func (db *SQLiteDB) GetMessages(q MessageQuery) (MessagePage, error) {
+	_, err := db.GetConversation(q.ConversationID)
+	if err != nil {
+		return MessagePage{}, err
+	}
+
+	filters := []string{`conversation_id = ?`}
+	args := []any{q.ConversationID}
+	if q.BeforeID != 0 {
+		filters = append(filters, `id < ?`)
+		args = append(args, q.BeforeID)
+	}
+	query := `SELECT ` + sqliteMessageColumns + ` FROM messages` + sqliteWhere(filters) + ` ORDER BY id DESC`
+	if q.Limit > 0 {
+		query += ` LIMIT ?`
+		args = append(args, q.Limit+1)
+	}
+
+	rows, err := db.conn.Query(query, args...)
+	if err != nil {
+		return MessagePage{}, err
+	}
+	defer rows.Close()
+
+	page := MessagePage{Messages: []Message{}}
+	for rows.Next() {
+		message, err := scanMessage(rows)
+		if err != nil {
+			return MessagePage{}, err
+		}
+		page.Messages = append(page.Messages, message)
+	}
+	if err := rows.Err(); err != nil {
+		return MessagePage{}, err
+	}
+	if q.Limit > 0 && len(page.Messages) > q.Limit {
+		page.Messages = page.Messages[:q.Limit]
+		page.HasNext = true
+	}
+	return page, nil
+}
+
+func scanConversation(row rowScanner) (Conversation, error) {
+	conversation := Conversation{}
+	var memberIDs string
+	err := row.Scan(
+		&conversation.ID, &conversation.CreatorID, &memberIDs,
+		&conversation.CreatedAt, &conversation.UpdatedAt,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Conversation{}, ErrNotExist
+	}
+	if err != nil {
+		return Conversation{}, err
+	}
+	return conversation, json.Unmarshal([]byte(memberIDs), &conversation.MemberIDs)
+}
+
+func scanMessage(row rowScanner) (Message, error) {
+	message := Message{}
+	err := row.Scan(&message.ID, &message.ConversationID, &message.SenderID, &message.Body, &message.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Message{}, ErrNotExist
+	}
+	return message, err
+}
@@ -0,0 +1,149 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+const sqliteFollowColumns = `follower_id, followee_id, created_at`
+
+func (db *SQLiteDB) FollowUser(followerID, followeeID int) (Follow, error) {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return Follow{}, err
+	}
+	defer tx.Rollback()
+
+	err = sqliteUserExists(tx, followeeID)
+	if err != nil {
+		return Follow{}, err
+	}
+	err = sqliteCheckBlocked(tx, followerID, followeeID)
+	if err != nil {
+		return Follow{}, err
+	}
+	now := time.Now().UTC()
+	res, err := tx.Exec(
+		`INSERT INTO follows (follower_id, followee_id, created_at) VALUES (?, ?, ?)
+		ON CONFLICT (follower_id, followee_id) DO NOTHING`,
+		followerID, followeeID, now,
+	)
+	if err != nil {
+		return Follow{}, err
+	}
+	inserted, err := res.RowsAffected()
+	if err != nil {
+		return Follow{}, err
+	}
+	if inserted > 0 {
+		err = sqliteNotify(tx, NotificationFollow, followeeID, followerID, 0, now)
+		if err != nil {
+			return Follow{}, err
+		}
+	}
+	follow, err := scanFollow(tx.QueryRow(
+		`SELECT `+sqliteFollowColumns+` FROM follows WHERE follower_id = ? AND followee_id = ?`,
+		followerID, followeeID,
+	))
+	if err != nil {
+		return Follow{}, err
+	}
+
+	return follow, tx.Commit()
+}
+
+func (db *SQLiteDB) UnfollowUser(followerID, followeeID int) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = sqliteUserExists(tx, followeeID)
+	if err != nil {
+		return err
+	}
+	res, err := tx.Exec(`DELETE FROM follows WHERE follower_id = ? AND followee_id = ?`, followerID, followeeID)
+	if err != nil {
+		return err
+	}
+	deleted, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if deleted > 0 {
+		err = sqliteRetractNotification(tx, NotificationFollow, followeeID, followerID, 0)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (db *SQLiteDB) GetFollowers(userID, viewerID int) ([]Follow, error) {
+	return db.queryFollows(userID, viewerID, `followee_id = ?`)
+}
+
+func (db *SQLiteDB) GetFollowing(userID, viewerID int) ([]Follow, error) {
+	return db.queryFollows(userID, viewerID, `follower_id = ?`)
+}
+
+func (db *SQLiteDB) queryFollows(userID, viewerID int, filter string) ([]Follow, error) {
+	err := sqliteUserExists(db.conn, userID)
+	if err != nil {
+		return nil, err
+	}
+	hidden, err := db.hiddenFrom(viewerID, false)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.conn.Query(
+		`SELECT `+sqliteFollowColumns+` FROM follows WHERE `+filter+`
+		ORDER BY created_at DESC, follower_id, followee_id`,
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	follows := []Follow{}
+	for rows.Next() {
+		follow, err := scanFollow(rows)
+		if err != nil {
+			return nil, err
+		}
+		if !follow.hidden(hidden) {
+			follows = append(follows, follow)
+		}
+	}
+	return follows, rows.Err()
+}
+
+// following returns the users userID follows, as DBStructure.following
+// does.
+func (db *SQLiteDB) following(userID int) (map[int]struct{}, error) {
+	following := map[int]struct{}{}
+	if userID == 0 {
+		return following, nil
+	}
+	follows, err := db.GetFollowing(userID, 0)
+	if err != nil {
+		return nil, err
+	}
+	for _, follow := range follows {
+		following[follow.FolloweeID] = struct{}{}
+	}
+	return following, nil
+}
+
+func scanFollow(row rowScanner) (Follow, error) {
+	follow := Follow{}
+	err := row.Scan(&follow.FollowerID, &follow.FolloweeID, &follow.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Follow{}, ErrNotExist
+	}
+	return follow, err
+}
@@ -0,0 +1,141 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+const sqliteMediaColumns = `id, uploader_id, sha256, content_type, thumbnail_content_type, size, width, height, created_at`
+
+func (db *SQLiteDB) CreateMedia(params Media) (Media, bool, error) {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return Media{}, false, err
+	}
+	defer tx.Rollback()
+
+	media, err := scanMedia(tx.QueryRow(
+		`SELECT `+sqliteMediaColumns+` FROM media WHERE uploader_id = ? AND sha256 = ?`,
+		params.UploaderID, params.SHA256,
+	))
+	if err == nil {
+		return media, false, nil
+	}
+	if !errors.Is(err, ErrNotExist) {
+		return Media{}, false, err
+	}
+
+	media, err = scanMedia(tx.QueryRow(
+		`INSERT INTO media (uploader_id, sha256, content_type, thumbnail_content_type, size, width, height, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		RETURNING `+sqliteMediaColumns,
+		params.UploaderID, params.SHA256, params.ContentType, params.ThumbnailContentType,
+		params.Size, params.Width, params.Height, time.Now().UTC(),
+	))
+	if err != nil {
+		return Media{}, false, err
+	}
+
+	return media, true, tx.Commit()
+}
+
+func (db *SQLiteDB) GetMedia(id int) (Media, error) {
+	return scanMedia(db.conn.QueryRow(`SELECT `+sqliteMediaColumns+` FROM media WHERE id = ?`, id))
+}
+
+// CanViewMedia is DB.CanViewMedia.
+func (db *SQLiteDB) CanViewMedia(media Media, viewerID int) (bool, error) {
+	if viewerID != 0 && viewerID == media.UploaderID {
+		return true, nil
+	}
+	var avatar bool
+	err := db.conn.QueryRow(`SELECT EXISTS (SELECT 1 FROM users WHERE avatar_media_id = ?)`, media.ID).Scan(&avatar)
+	if err != nil || avatar {
+		return avatar, err
+	}
+
+	chirps, err := db.queryChirps(
+		`SELECT `+sqliteChirpColumns+` FROM chirps WHERE id IN (SELECT chirp_id FROM chirp_media WHERE media_id = ?)`,
+		media.ID,
+	)
+	if err != nil {
+		return false, err
+	}
+	for _, chirp := range chirps {
+		visible, err := sqliteCanView(db.conn, chirp, viewerID)
+		if err != nil || visible {
+			return visible, err
+		}
+	}
+	return false, nil
+}
+
+func (db *SQLiteDB) DeleteUnreferencedMedia(ids []int) ([]Media, error) {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	deleted := []Media{}
+	for _, id := range ids {
+		media, err := scanMedia(tx.QueryRow(
+			`DELETE FROM media WHERE id = ?
+				AND NOT EXISTS (SELECT 1 FROM chirp_media WHERE media_id = ?)
+				AND NOT EXISTS (SELECT 1 FROM chirp_drafts, json_each(chirp_drafts.media_ids) WHERE json_each.value = ?)
+				AND NOT EXISTS (SELECT 1 FROM users WHERE avatar_media_id = ?)
+			RETURNING `+sqliteMediaColumns,
+			id, id, id, id,
+		))
+		if errors.Is(err, ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		var shared bool
+		err = tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM media WHERE sha256 = ?)`, media.SHA256).Scan(&shared)
+		if err != nil {
+			return nil, err
+		}
+		if !shared {
+			deleted = append(deleted, media)
+		}
+	}
+
+	return deleted, tx.Commit()
+}
+
+// sqliteCheckMediaIDs is DBStructure.checkMediaIDs.
+func sqliteCheckMediaIDs(q sqliteQueryer, uploaderID int, ids []int) error {
+	for _, id := range ids {
+		var exists bool
+		err := q.QueryRow(
+			`SELECT EXISTS (SELECT 1 FROM media WHERE id = ? AND uploader_id = ?)`,
+			id, uploaderID,
+		).Scan(&exists)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return ErrMediaNotExist
+		}
+	}
+	return nil
+}
+
+func scanMedia(row rowScanner) (Media, error) {
+	media := Media{}
+	err := row.Scan(
+		&media.ID, &media.UploaderID, &media.SHA256, &media.ContentType, &media.ThumbnailContentType,
+		&media.Size, &media.Width, &media.Height, &media.CreatedAt,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Media{}, ErrNotExist
+	}
+	if err != nil {
+		return Media{}, err
+	}
+	return media, nil
+}
@@ -0,0 +1,349 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+type sqliteMigration struct {
+	name   string
+	script string
+}
+
+// sqliteMigrations are applied in order; PRAGMA user_version records how many
+// have already run. Never edit an entry once it has shipped, append a new one.
+var sqliteMigrations = []sqliteMigration{
+	{"create users, chirps and revocations", `
+CREATE TABLE users (
+	id              INTEGER PRIMARY KEY AUTOINCREMENT,
+	email           TEXT    NOT NULL UNIQUE,
+	hashed_password TEXT    NOT NULL,
+	is_chirpy_red   BOOLEAN NOT NULL DEFAULT FALSE
+);
+
+CREATE TABLE chirps (
+	id        INTEGER PRIMARY KEY AUTOINCREMENT,
+	author_id INTEGER NOT NULL,
+	body      TEXT    NOT NULL
+);
+CREATE INDEX chirps_author_id ON chirps (author_id);
+
+CREATE TABLE revocations (
+	token      TEXT     PRIMARY KEY,
+	revoked_at DATETIME NOT NULL
+);
+`},
+	{"add chirp timestamps and revisions", `
+ALTER TABLE chirps ADD COLUMN created_at DATETIME NOT NULL DEFAULT '1970-01-01 00:00:00';
+ALTER TABLE chirps ADD COLUMN updated_at DATETIME NOT NULL DEFAULT '1970-01-01 00:00:00';
+UPDATE chirps SET created_at = datetime('now'), updated_at = datetime('now');
+
+CREATE TABLE chirp_revisions (
+	chirp_id   INTEGER  NOT NULL,
+	version    INTEGER  NOT NULL,
+	body       TEXT     NOT NULL,
+	created_at DATETIME NOT NULL,
+	PRIMARY KEY (chirp_id, version)
+);
+INSERT INTO chirp_revisions (chirp_id, version, body, created_at)
+	SELECT id, 1, body, created_at FROM chirps;
+`},
+	{"store migrated chirp timestamps in the driver's format", `
+UPDATE chirps SET
+	created_at = created_at || '+00:00',
+	updated_at = updated_at || '+00:00'
+WHERE length(created_at) = 19;
+UPDATE chirp_revisions SET created_at = created_at || '+00:00' WHERE length(created_at) = 19;
+`},
+	{"index chirps by creation time", `
+CREATE INDEX chirps_created_at ON chirps (created_at, id);
+`},
+	{"add follows", `
+CREATE TABLE follows (
+	follower_id INTEGER  NOT NULL,
+	followee_id INTEGER  NOT NULL,
+	created_at  DATETIME NOT NULL,
+	PRIMARY KEY (follower_id, followee_id)
+);
+CREATE INDEX follows_followee_id ON follows (followee_id);
+`},
+	{"add replies and chirp tombstones", `
+ALTER TABLE chirps ADD COLUMN in_reply_to INTEGER NOT NULL DEFAULT 0;
+CREATE INDEX chirps_in_reply_to ON chirps (in_reply_to);
+
+CREATE TABLE chirp_tombstones (
+	id          INTEGER  PRIMARY KEY,
+	in_reply_to INTEGER  NOT NULL,
+	deleted_at  DATETIME NOT NULL
+);
+CREATE INDEX chirp_tombstones_in_reply_to ON chirp_tombstones (in_reply_to);
+`},
+	{"add likes and rechirps", `
+CREATE TABLE reactions (
+	kind       TEXT     NOT NULL,
+	chirp_id   INTEGER  NOT NULL,
+	user_id    INTEGER  NOT NULL,
+	created_at DATETIME NOT NULL,
+	PRIMARY KEY (kind, chirp_id, user_id)
+);
+CREATE INDEX reactions_user_id ON reactions (kind, user_id);
+`},
+	{"extract hashtags and mentions", `
+ALTER TABLE chirps ADD COLUMN hashtags TEXT NOT NULL DEFAULT '[]';
+ALTER TABLE chirps ADD COLUMN mentions TEXT NOT NULL DEFAULT '[]';
+
+CREATE TABLE chirp_hashtags (
+	tag        TEXT     NOT NULL,
+	chirp_id   INTEGER  NOT NULL,
+	created_at DATETIME NOT NULL,
+	PRIMARY KEY (tag, chirp_id)
+);
+CREATE INDEX chirp_hashtags_created_at ON chirp_hashtags (created_at);
+
+CREATE TABLE chirp_mentions (
+	user_id  INTEGER NOT NULL,
+	chirp_id INTEGER NOT NULL,
+	PRIMARY KEY (user_id, chirp_id)
+);
+`},
+	{"add media", `
+CREATE TABLE media (
+	id                     INTEGER  PRIMARY KEY AUTOINCREMENT,
+	uploader_id            INTEGER  NOT NULL,
+	sha256                 TEXT     NOT NULL UNIQUE,
+	content_type           TEXT     NOT NULL,
+	thumbnail_content_type TEXT     NOT NULL,
+	size                   INTEGER  NOT NULL,
+	width                  INTEGER  NOT NULL,
+	height                 INTEGER  NOT NULL,
+	created_at             DATETIME NOT NULL
+);
+
+ALTER TABLE chirps ADD COLUMN media_ids TEXT NOT NULL DEFAULT '[]';
+
+CREATE TABLE chirp_media (
+	media_id INTEGER NOT NULL,
+	chirp_id INTEGER NOT NULL,
+	PRIMARY KEY (media_id, chirp_id)
+);
+CREATE INDEX chirp_media_chirp_id ON chirp_media (chirp_id);
+`},
+	{"add chirp drafts", `
+CREATE TABLE chirp_drafts (
+	id          INTEGER  PRIMARY KEY AUTOINCREMENT,
+	author_id   INTEGER  NOT NULL,
+	body        TEXT     NOT NULL,
+	in_reply_to INTEGER  NOT NULL DEFAULT 0,
+	media_ids   TEXT     NOT NULL DEFAULT '[]',
+	publish_at  DATETIME,
+	error       TEXT     NOT NULL DEFAULT '',
+	created_at  DATETIME NOT NULL,
+	updated_at  DATETIME NOT NULL
+);
+CREATE INDEX chirp_drafts_author_id ON chirp_drafts (author_id);
+CREATE INDEX chirp_drafts_publish_at ON chirp_drafts (publish_at) WHERE publish_at IS NOT NULL;
+`},
+	{"add user profiles", `
+ALTER TABLE users ADD COLUMN handle TEXT;
+ALTER TABLE users ADD COLUMN display_name TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN bio TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN avatar_media_id INTEGER NOT NULL DEFAULT 0;
+CREATE UNIQUE INDEX users_handle ON users (handle COLLATE NOCASE);
+CREATE INDEX users_avatar_media_id ON users (avatar_media_id) WHERE avatar_media_id != 0;
+`},
+	{"add user session revocation", `
+ALTER TABLE users ADD COLUMN sessions_valid_after DATETIME;
+`},
+	{"add blocks and mutes", `
+CREATE TABLE restrictions (
+	kind       TEXT     NOT NULL,
+	user_id    INTEGER  NOT NULL,
+	target_id  INTEGER  NOT NULL,
+	created_at DATETIME NOT NULL,
+	PRIMARY KEY (kind, user_id, target_id)
+);
+CREATE INDEX restrictions_target_id ON restrictions (kind, target_id);
+`},
+	{"add notifications", `
+CREATE TABLE notifications (
+	id         INTEGER  PRIMARY KEY AUTOINCREMENT,
+	user_id    INTEGER  NOT NULL,
+	kind       TEXT     NOT NULL,
+	chirp_id   INTEGER  NOT NULL DEFAULT 0,
+	read       BOOLEAN  NOT NULL DEFAULT FALSE,
+	created_at DATETIME NOT NULL,
+	updated_at DATETIME NOT NULL
+);
+CREATE INDEX notifications_user_id ON notifications (user_id, updated_at, id);
+CREATE INDEX notifications_chirp_id ON notifications (chirp_id) WHERE chirp_id != 0;
+CREATE UNIQUE INDEX notifications_unread ON notifications (user_id, kind, chirp_id) WHERE NOT read;
+CREATE TABLE notification_actors (
+	notification_id INTEGER  NOT NULL,
+	actor_id        INTEGER  NOT NULL,
+	created_at      DATETIME NOT NULL,
+	PRIMARY KEY (notification_id, actor_id)
+);
+`},
+	{"add conversations and messages", `
+CREATE TABLE conversations (
+	id         INTEGER  PRIMARY KEY AUTOINCREMENT,
+	creator_id INTEGER  NOT NULL,
+	member_ids TEXT     NOT NULL,
+	direct_key TEXT     UNIQUE,
+	created_at DATETIME NOT NULL,
+	updated_at DATETIME NOT NULL
+);
+CREATE TABLE conversation_members (
+	conversation_id INTEGER NOT NULL,
+	user_id         INTEGER NOT NULL,
+	PRIMARY KEY (conversation_id, user_id)
+);
+CREATE INDEX conversation_members_user_id ON conversation_members (user_id);
+CREATE TABLE messages (
+	id              INTEGER  PRIMARY KEY AUTOINCREMENT,
+	conversation_id INTEGER  NOT NULL,
+	sender_id       INTEGER  NOT NULL,
+	body            TEXT     NOT NULL,
+	created_at      DATETIME NOT NULL
+);
+CREATE INDEX messages_conversation_id ON messages (conversation_id, id);
+`},
+	{"add chirp visibility", `
+ALTER TABLE chirps ADD COLUMN visibility TEXT NOT NULL DEFAULT 'public';
+ALTER TABLE chirp_drafts ADD COLUMN visibility TEXT NOT NULL DEFAULT 'public';
+`},
+	{"add reports and the moderation log", `
+ALTER TABLE chirps ADD COLUMN hidden BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE users ADD COLUMN suspended BOOLEAN NOT NULL DEFAULT FALSE;
+CREATE TABLE reports (
+	id           INTEGER  PRIMARY KEY AUTOINCREMENT,
+	reporter_id  INTEGER  NOT NULL,
+	chirp_id     INTEGER  NOT NULL DEFAULT 0,
+	user_id      INTEGER  NOT NULL,
+	reason       TEXT     NOT NULL,
+	status       TEXT     NOT NULL,
+	moderator_id INTEGER  NOT NULL DEFAULT 0,
+	note         TEXT     NOT NULL DEFAULT '',
+	created_at   DATETIME NOT NULL,
+	updated_at   DATETIME NOT NULL
+);
+CREATE INDEX reports_status ON reports (status, id);
+CREATE TABLE moderation_log (
+	id           INTEGER  PRIMARY KEY AUTOINCREMENT,
+	moderator_id INTEGER  NOT NULL,
+	kind         TEXT     NOT NULL,
+	report_id    INTEGER  NOT NULL DEFAULT 0,
+	chirp_id     INTEGER  NOT NULL DEFAULT 0,
+	user_id      INTEGER  NOT NULL DEFAULT 0,
+	reason       TEXT     NOT NULL DEFAULT '',
+	created_at   DATETIME NOT NULL
+);
+`},
+	{"add user roles", `
+ALTER TABLE users ADD COLUMN role TEXT NOT NULL DEFAULT 'user';
+ALTER TABLE moderation_log ADD COLUMN role TEXT NOT NULL DEFAULT '';
+`},
+	// SQLite can't drop a UNIQUE constraint, so the media table is rebuilt,
+	// carrying its ID sequence over so deleted IDs aren't handed out again.
+	{"deduplicate media per uploader", `
+CREATE TABLE media_new (
+	id                     INTEGER  PRIMARY KEY AUTOINCREMENT,
+	uploader_id            INTEGER  NOT NULL,
+	sha256                 TEXT     NOT NULL,
+	content_type           TEXT     NOT NULL,
+	thumbnail_content_type TEXT     NOT NULL,
+	size                   INTEGER  NOT NULL,
+	width                  INTEGER  NOT NULL,
+	height                 INTEGER  NOT NULL,
+	created_at             DATETIME NOT NULL,
+	UNIQUE (uploader_id, sha256)
+);
+INSERT INTO media_new SELECT id, uploader_id, sha256, content_type, thumbnail_content_type, size, width, height, created_at FROM media;
+DELETE FROM sqlite_sequence WHERE name = 'media_new';
+UPDATE sqlite_sequence SET name = 'media_new' WHERE name = 'media';
+DROP TABLE media;
+ALTER TABLE media_new RENAME TO media;
+CREATE INDEX media_sha256 ON media (sha256);
+`},
+	{"unresolve email mentions", ``},
+}
+
+// sqliteMigrationFuncs holds the data changes SQL can't express, keyed by the
+// version of the migration they belong to. Each runs after that migration's
+// script, in the same transaction.
+var sqliteMigrationFuncs = map[int]func(*sql.Tx) error{
+	8:  backfillChirpEntities,
+	20: unresolveEmailMentions,
+}
+
+func (db *SQLiteDB) schemaVersion() (int, error) {
+	var version int
+	err := db.conn.QueryRow("PRAGMA user_version").Scan(&version)
+	if err != nil {
+		return 0, err
+	}
+	if version > len(sqliteMigrations) {
+		return 0, fmt.Errorf(
+			"database schema version %d is newer than the latest known version %d",
+			version,
+			len(sqliteMigrations),
+		)
+	}
+	return version, nil
+}
+
+func (db *SQLiteDB) MigrationStatus() (MigrationStatus, error) {
+	version, err := db.schemaVersion()
+	if err != nil {
+		return MigrationStatus{}, err
+	}
+
+	status := MigrationStatus{
+		Version: version,
+		Latest:  len(sqliteMigrations),
+	}
+	for i := version; i < len(sqliteMigrations); i++ {
+		status.Pending = append(status.Pending, migrationName(i+1, sqliteMigrations[i].name))
+	}
+	return status, nil
+}
+
+// Migrate runs every pending migration in one transaction, which a dry run
+// rolls back instead of committing.
+func (db *SQLiteDB) Migrate(dryRun bool) ([]string, error) {
+	version, err := db.schemaVersion()
+	if err != nil {
+		return nil, err
+	}
+	if version == len(sqliteMigrations) {
+		return []string{}, nil
+	}
+
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	applied := []string{}
+	for i := version; i < len(sqliteMigrations); i++ {
+		name := migrationName(i+1, sqliteMigrations[i].name)
+		_, err = tx.Exec(sqliteMigrations[i].script)
+		if err == nil && sqliteMigrationFuncs[i+1] != nil {
+			err = sqliteMigrationFuncs[i+1](tx)
+		}
+		if err != nil {
+			return applied, fmt.Errorf("migration %s: %w", name, err)
+		}
+		_, err = tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", i+1))
+		if err != nil {
+			return applied, err
+		}
+		applied = append(applied, name)
+	}
+
+	if dryRun {
+		return applied, nil
+	}
+	return applied, tx.Commit()
+}
@@ -0,0 +1,188 @@
+package database
+
+import (
+	"database/sql"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// TestSQLiteMigrateFromVersion7 builds a database as version 7 left it and
+// migrates it to the latest version. Each migration may only rely on the
+// schema the ones before it created.
+func TestSQLiteMigrateFromVersion7(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "database.sqlite")
+
+	conn, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, migration := range sqliteMigrations[:7] {
+		_, err = conn.Exec(migration.script)
+		if err != nil {
+			t.Fatalf("migration %q: %v", migration.name, err)
+		}
+	}
+	_, err = conn.Exec(`PRAGMA user_version = 7`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = conn.Exec(
+		`INSERT INTO users (email, hashed_password) VALUES ('a@example.com', 'hash'), ('b@example.com', 'hash')`,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = conn.Exec(
+		`INSERT INTO chirps (author_id, body, created_at, updated_at) VALUES (1, 'hi @b@example.com @bob #go', ?, ?)`,
+		"2024-01-01 00:00:00+00:00", "2024-01-01 00:00:00+00:00",
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+
+	db, err := NewSQLiteDB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	status, err := db.MigrationStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Version != status.Latest || len(status.Pending) != 0 {
+		t.Fatalf("got schema version %d of %d, pending %v", status.Version, status.Latest, status.Pending)
+	}
+
+	chirp, err := db.GetChirp(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chirp.Hashtags) != 1 || chirp.Hashtags[0].Tag != "go" {
+		t.Errorf("got hashtags %+v, want #go", chirp.Hashtags)
+	}
+	// Migration 8 resolves the email mention, and migration 20 unresolves it.
+	if len(chirp.Mentions) != 2 || chirp.Mentions[0].UserID != 0 || chirp.Mentions[1].UserID != 0 {
+		t.Errorf("got mentions %+v, want both unresolved", chirp.Mentions)
+	}
+}
+
+// TestSQLiteMigrateMediaSequence checks that rebuilding the media table to
+// deduplicate per uploader doesn't hand out deleted media IDs again.
+func TestSQLiteMigrateMediaSequence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "database.sqlite")
+
+	conn, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, migration := range sqliteMigrations[:18] {
+		_, err = conn.Exec(migration.script)
+		if err != nil {
+			t.Fatalf("migration %q: %v", migration.name, err)
+		}
+	}
+	_, err = conn.Exec(`PRAGMA user_version = 18`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = conn.Exec(
+		`INSERT INTO media (id, uploader_id, sha256, content_type, thumbnail_content_type, size, width, height, created_at)
+		VALUES (5, 1, 'abc', 'image/png', 'image/png', 1, 1, 1, ?)`,
+		"2024-01-01 00:00:00+00:00",
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = conn.Exec(`DELETE FROM media`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+
+	db, err := NewSQLiteDB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	media, _, err := db.CreateMedia(Media{UploaderID: 1, SHA256: "abc", ContentType: "image/png", ThumbnailContentType: "image/png"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if media.ID != 6 {
+		t.Errorf("got media ID %d, want 6", media.ID)
+	}
+}
+
+// TestSQLiteMigrateEmailMentions checks that migrating unresolves the
+// mentions that named users by email, along with what they led to, but
+// leaves those by handle alone.
+func TestSQLiteMigrateEmailMentions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "database.sqlite")
+
+	conn, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, migration := range sqliteMigrations[:19] {
+		_, err = conn.Exec(migration.script)
+		if err != nil {
+			t.Fatalf("migration %q: %v", migration.name, err)
+		}
+	}
+	const now = "2024-01-01 00:00:00+00:00"
+	for _, stmt := range []string{
+		`PRAGMA user_version = 19`,
+		`INSERT INTO users (email, hashed_password, handle) VALUES ('a@example.com', 'hash', 'a'), ('b@example.com', 'hash', 'b'), ('c@example.com', 'hash', 'c')`,
+		`INSERT INTO chirps (author_id, body, created_at, updated_at, mentions) VALUES (1, '@b@example.com @c @c@example.com', '` + now + `', '` + now + `',
+			'[{"username":"b@example.com","user_id":2,"start":0,"end":14},{"username":"c","user_id":3,"start":15,"end":17},{"username":"c@example.com","user_id":3,"start":18,"end":32}]')`,
+		`INSERT INTO chirp_mentions (user_id, chirp_id) VALUES (2, 1), (3, 1)`,
+		`INSERT INTO notifications (user_id, kind, chirp_id, created_at, updated_at) VALUES (2, 'mention', 1, '` + now + `', '` + now + `'), (3, 'mention', 1, '` + now + `', '` + now + `')`,
+		`INSERT INTO notification_actors (notification_id, actor_id, created_at) VALUES (1, 1, '` + now + `'), (2, 1, '` + now + `')`,
+	} {
+		_, err = conn.Exec(stmt)
+		if err != nil {
+			t.Fatalf("%s: %v", stmt, err)
+		}
+	}
+	conn.Close()
+
+	db, err := NewSQLiteDB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	chirp, err := db.GetChirp(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := []int{}
+	for _, mention := range chirp.Mentions {
+		got = append(got, mention.UserID)
+	}
+	if !slices.Equal(got, []int{0, 3, 0}) {
+		t.Errorf("got mentioned users %v, want [0 3 0]", got)
+	}
+
+	for userID, want := range map[int]int{2: 0, 3: 1} {
+		page, err := db.GetNotifications(NotificationQuery{UserID: userID})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(page.Notifications) != want {
+			t.Errorf("user %d has %d notifications, want %d", userID, len(page.Notifications), want)
+		}
+		var mentions int
+		err = db.conn.QueryRow(`SELECT COUNT(*) FROM chirp_mentions WHERE user_id = ?`, userID).Scan(&mentions)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if mentions != want {
+			t.Errorf("user %d is indexed as mentioned %d times, want %d", userID, mentions, want)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+const sqliteModerationColumns = `id, moderator_id, kind, report_id, chirp_id, user_id, reason, role, created_at`
+
+// sqliteLogModeration is DBStructure.logModeration within tx.
+func sqliteLogModeration(tx *sql.Tx, action ModerationAction) error {
+	_, err := tx.Exec(
+		`INSERT INTO moderation_log (moderator_id, kind, report_id, chirp_id, user_id, reason, role, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		action.ModeratorID, action.Kind, action.ReportID, action.ChirpID, action.UserID, action.Reason, action.Role,
+		action.CreatedAt,
+	)
+	return err
+}
+
+func (db *SQLiteDB) HideChirp(chirpID, moderatorID int, hidden bool, reason string) (Chirp, error) {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return Chirp{}, err
+	}
+	defer tx.Rollback()
+
+	authorID, err := sqliteChirpAuthor(tx, chirpID)
+	if err != nil {
+		return Chirp{}, err
+	}
+	err = sqliteCheckOutranks(tx, moderatorID, authorID)
+	if err != nil {
+		return Chirp{}, err
+	}
+	chirp, err := scanChirp(tx.QueryRow(
+		`UPDATE chirps SET hidden = ? WHERE id = ? RETURNING `+sqliteChirpColumns,
+		hidden, chirpID,
+	))
+	if err != nil {
+		return Chirp{}, err
+	}
+
+	kind := ModerationHideChirp
+	if !hidden {
+		kind = ModerationUnhideChirp
+	}
+	err = sqliteLogModeration(tx, ModerationAction{
+		ModeratorID: moderatorID,
+		Kind:        kind,
+		ChirpID:     chirpID,
+		UserID:      chirp.AuthorID,
+		Reason:      reason,
+		CreatedAt:   time.Now().UTC(),
+	})
+	if err != nil {
+		return Chirp{}, err
+	}
+
+	return chirp, tx.Commit()
+}
+
+func (db *SQLiteDB) SuspendUser(userID, moderatorID int, suspended bool, reason string) (User, error) {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return User{}, err
+	}
+	defer tx.Rollback()
+
+	err = sqliteCheckOutranks(tx, moderatorID, userID)
+	if err != nil {
+		return User{}, err
+	}
+	user, err := scanUser(tx.QueryRow(
+		`UPDATE users SET suspended = ? WHERE id = ? RETURNING `+sqliteUserColumns,
+		suspended, userID,
+	))
+	if err != nil {
+		return User{}, err
+	}
+
+	kind := ModerationSuspendUser
+	if !suspended {
+		kind = ModerationUnsuspendUser
+	}
+	err = sqliteLogModeration(tx, ModerationAction{
+		ModeratorID: moderatorID,
+		Kind:        kind,
+		UserID:      userID,
+		Reason:      reason,
+		CreatedAt:   time.Now().UTC(),
+	})
+	if err != nil {
+		return User{}, err
+	}
+
+	return user, tx.Commit()
+}
+
+func (db *SQLiteDB) GetModerationLog(q ModerationLogQuery) (ModerationLogPage, error) {
+	filters := []string{}
+	args := []any{}
+	if q.BeforeID != 0 {
+		filters = append(filters, `id < ?`)
+		args = append(args, q.BeforeID)
+	}
+	query := `SELECT ` + sqliteModerationColumns + ` FROM moderation_log` + sqliteWhere(filters) + ` ORDER BY id DESC`
+	if q.Limit > 0 {
+		query += ` LIMIT ?`
+		args = append(args, q.Limit+1)
+	}
+
+	rows, err := db.conn.Query(query, args...)
+	if err != nil {
+		return ModerationLogPage{}, err
+	}
+	defer rows.Close()
+
+	page := ModerationLogPage{Actions: []ModerationAction{}}
+	for rows.Next() {
+		action, err := scanModerationAction(rows)
+		if err != nil {
+			return ModerationLogPage{}, err
+		}
+		page.Actions = append(page.Actions, action)
+	}
+	if err := rows.Err(); err != nil {
+		return ModerationLogPage{}, err
+	}
+	if q.Limit > 0 && len(page.Actions) > q.Limit {
+		page.Actions = page.Actions[:q.Limit]
+		page.HasNext = true
+	}
+	return page, nil
+}
+
+func scanModerationAction(row rowScanner) (ModerationAction, error) {
+	action := ModerationAction{}
+	err := row.Scan(
+		&action.ID, &action.ModeratorID, &action.Kind, &action.ReportID, &action.ChirpID, &action.UserID,
+		&action.Reason, &action.Role, &action.CreatedAt,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ModerationAction{}, ErrNotExist
+	}
+	return action, err
+}
@@ -0,0 +1,276 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+const sqliteNotificationColumns = `id, user_id, kind, chirp_id, read, created_at, updated_at`
+
+// sqliteNotify records an event within tx, as DBStructure.notify does.
+func sqliteNotify(tx *sql.Tx, kind NotificationKind, userID, actorID, chirpID int, at time.Time) error {
+	if userID == actorID {
+		return nil
+	}
+	var ignored bool
+	err := tx.QueryRow(
+		`SELECT EXISTS (SELECT 1 FROM restrictions WHERE
+			(kind = 'block' AND ((user_id = ? AND target_id = ?) OR (user_id = ? AND target_id = ?)))
+			OR (kind = 'mute' AND user_id = ? AND target_id = ?))`,
+		userID, actorID, actorID, userID, userID, actorID,
+	).Scan(&ignored)
+	if err != nil || ignored {
+		return err
+	}
+
+	var id int
+	err = tx.QueryRow(
+		`UPDATE notifications SET updated_at = ? WHERE user_id = ? AND kind = ? AND chirp_id = ? AND NOT read RETURNING id`,
+		at, userID, kind, chirpID,
+	).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		err = tx.QueryRow(
+			`INSERT INTO notifications (user_id, kind, chirp_id, created_at, updated_at) VALUES (?, ?, ?, ?, ?) RETURNING id`,
+			userID, kind, chirpID, at, at,
+		).Scan(&id)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(
+		`INSERT INTO notification_actors (notification_id, actor_id, created_at) VALUES (?, ?, ?)
+		ON CONFLICT (notification_id, actor_id) DO UPDATE SET created_at = excluded.created_at`,
+		id, actorID, at,
+	)
+	return err
+}
+
+// sqliteRetractNotification is DBStructure.retractNotification within tx.
+func sqliteRetractNotification(tx *sql.Tx, kind NotificationKind, userID, actorID, chirpID int) error {
+	var id int
+	err := tx.QueryRow(
+		`SELECT id FROM notifications WHERE user_id = ? AND kind = ? AND chirp_id = ? AND NOT read`,
+		userID, kind, chirpID,
+	).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`DELETE FROM notification_actors WHERE notification_id = ? AND actor_id = ?`, id, actorID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(
+		`DELETE FROM notifications WHERE id = ? AND NOT EXISTS (SELECT 1 FROM notification_actors WHERE notification_id = ?)`,
+		id, id,
+	)
+	return err
+}
+
+// sqliteNotifyChirp is DBStructure.notifyChirp within tx.
+func sqliteNotifyChirp(tx *sql.Tx, chirp Chirp) error {
+	if chirp.InReplyTo != 0 {
+		parentAuthorID, err := sqliteChirpAuthor(tx, chirp.InReplyTo)
+		if err != nil {
+			return err
+		}
+		visible, err := sqliteCanView(tx, chirp, parentAuthorID)
+		if err != nil {
+			return err
+		}
+		if visible {
+			err = sqliteNotify(tx, NotificationReply, parentAuthorID, chirp.AuthorID, chirp.InReplyTo, chirp.CreatedAt)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return sqliteNotifyMentions(tx, chirp, nil)
+}
+
+// sqliteNotifyMentions is DBStructure.notifyMentions within tx.
+func sqliteNotifyMentions(tx *sql.Tx, chirp Chirp, skip []int) error {
+	for _, userID := range mentionedUserIDs(chirp.Mentions) {
+		if containsFunc(skip, func(id int) bool { return id == userID }) {
+			continue
+		}
+		visible, err := sqliteCanView(tx, chirp, userID)
+		if err != nil {
+			return err
+		}
+		if !visible {
+			continue
+		}
+		err = sqliteNotify(tx, NotificationMention, userID, chirp.AuthorID, chirp.ID, chirp.UpdatedAt)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sqliteDeleteChirpNotifications removes the notifications about a chirp.
+func sqliteDeleteChirpNotifications(tx *sql.Tx, chirpID int) error {
+	_, err := tx.Exec(
+		`DELETE FROM notification_actors WHERE notification_id IN (SELECT id FROM notifications WHERE chirp_id = ?)`,
+		chirpID,
+	)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`DELETE FROM notifications WHERE chirp_id = ?`, chirpID)
+	return err
+}
+
+func (db *SQLiteDB) GetNotifications(q NotificationQuery) (NotificationPage, error) {
+	err := q.validate()
+	if err != nil {
+		return NotificationPage{}, err
+	}
+
+	page := NotificationPage{}
+	err = db.conn.QueryRow(
+		`SELECT COUNT(*) FROM notifications WHERE user_id = ? AND NOT read`,
+		q.UserID,
+	).Scan(&page.Unread)
+	if err != nil {
+		return NotificationPage{}, err
+	}
+
+	filters := []string{`user_id = ?`}
+	args := []any{q.UserID}
+	if q.UnreadOnly {
+		filters = append(filters, `NOT read`)
+	}
+	if q.After != nil {
+		updatedAt := q.After.UpdatedAt.UTC()
+		filters = append(filters, `(updated_at < ? OR (updated_at = ? AND id < ?))`)
+		args = append(args, updatedAt, updatedAt, q.After.ID)
+	}
+	query := `SELECT ` + sqliteNotificationColumns + ` FROM notifications` + sqliteWhere(filters) + ` ORDER BY updated_at DESC, id DESC`
+	if q.Limit > 0 {
+		query += ` LIMIT ?`
+		args = append(args, q.Limit+1)
+	}
+
+	rows, err := db.conn.Query(query, args...)
+	if err != nil {
+		return NotificationPage{}, err
+	}
+	defer rows.Close()
+
+	page.Notifications = []Notification{}
+	for rows.Next() {
+		notification, err := scanNotification(rows)
+		if err != nil {
+			return NotificationPage{}, err
+		}
+		page.Notifications = append(page.Notifications, notification)
+	}
+	if err := rows.Err(); err != nil {
+		return NotificationPage{}, err
+	}
+	if q.Limit > 0 && len(page.Notifications) > q.Limit {
+		page.Notifications = page.Notifications[:q.Limit]
+		page.HasNext = true
+	}
+
+	err = db.loadNotificationActors(page.Notifications)
+	if err != nil {
+		return NotificationPage{}, err
+	}
+	return page, nil
+}
+
+// loadNotificationActors fills in the ActorIDs of notifications.
+func (db *SQLiteDB) loadNotificationActors(notifications []Notification) error {
+	if len(notifications) == 0 {
+		return nil
+	}
+	index := make(map[int]int, len(notifications))
+	ids := make([]int, 0, len(notifications))
+	for i, notification := range notifications {
+		index[notification.ID] = i
+		ids = append(ids, notification.ID)
+	}
+	idsJSON, err := json.Marshal(ids)
+	if err != nil {
+		return err
+	}
+
+	rows, err := db.conn.Query(
+		`SELECT notification_id, actor_id FROM notification_actors
+		WHERE notification_id IN (SELECT value FROM json_each(?))
+		ORDER BY created_at DESC, actor_id`,
+		string(idsJSON),
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var notificationID, actorID int
+		err := rows.Scan(&notificationID, &actorID)
+		if err != nil {
+			return err
+		}
+		notification := &notifications[index[notificationID]]
+		notification.ActorIDs = append(notification.ActorIDs, actorID)
+	}
+	return rows.Err()
+}
+
+func (db *SQLiteDB) MarkNotificationsRead(userID int, ids []int) (int, error) {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if ids == nil {
+		_, err = tx.Exec(`UPDATE notifications SET read = TRUE WHERE user_id = ? AND NOT read`, userID)
+	} else {
+		var idsJSON []byte
+		idsJSON, err = json.Marshal(ids)
+		if err != nil {
+			return 0, err
+		}
+		_, err = tx.Exec(
+			`UPDATE notifications SET read = TRUE
+			WHERE user_id = ? AND NOT read AND id IN (SELECT value FROM json_each(?))`,
+			userID, string(idsJSON),
+		)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	var unread int
+	err = tx.QueryRow(`SELECT COUNT(*) FROM notifications WHERE user_id = ? AND NOT read`, userID).Scan(&unread)
+	if err != nil {
+		return 0, err
+	}
+	return unread, tx.Commit()
+}
+
+func scanNotification(row rowScanner) (Notification, error) {
+	notification := Notification{ActorIDs: []int{}}
+	err := row.Scan(
+		&notification.ID,
+		&notification.UserID,
+		&notification.Kind,
+		&notification.ChirpID,
+		&notification.Read,
+		&notification.CreatedAt,
+		&notification.UpdatedAt,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Notification{}, ErrNotExist
+	}
+	return notification, err
+}
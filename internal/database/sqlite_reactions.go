@@ -0,0 +1,145 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+const sqliteReactionColumns = `chirp_id, user_id, created_at`
+
+func (db *SQLiteDB) AddReaction(kind ReactionKind, chirpID, userID int) (Reaction, error) {
+	err := kind.validate()
+	if err != nil {
+		return Reaction{}, err
+	}
+
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return Reaction{}, err
+	}
+	defer tx.Rollback()
+
+	authorID, err := sqliteChirpAuthor(tx, chirpID)
+	if err != nil {
+		return Reaction{}, err
+	}
+	now := time.Now().UTC()
+	res, err := tx.Exec(
+		`INSERT INTO reactions (kind, chirp_id, user_id, created_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT (kind, chirp_id, user_id) DO NOTHING`,
+		kind, chirpID, userID, now,
+	)
+	if err != nil {
+		return Reaction{}, err
+	}
+	inserted, err := res.RowsAffected()
+	if err != nil {
+		return Reaction{}, err
+	}
+	if inserted > 0 && kind == ReactionLike {
+		err = sqliteNotify(tx, NotificationLike, authorID, userID, chirpID, now)
+		if err != nil {
+			return Reaction{}, err
+		}
+	}
+	reaction, err := scanReaction(tx.QueryRow(
+		`SELECT `+sqliteReactionColumns+` FROM reactions WHERE kind = ? AND chirp_id = ? AND user_id = ?`,
+		kind, chirpID, userID,
+	))
+	if err != nil {
+		return Reaction{}, err
+	}
+
+	return reaction, tx.Commit()
+}
+
+func (db *SQLiteDB) RemoveReaction(kind ReactionKind, chirpID, userID int) error {
+	err := kind.validate()
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	authorID, err := sqliteChirpAuthor(tx, chirpID)
+	if err != nil {
+		return err
+	}
+	res, err := tx.Exec(
+		`DELETE FROM reactions WHERE kind = ? AND chirp_id = ? AND user_id = ?`,
+		kind, chirpID, userID,
+	)
+	if err != nil {
+		return err
+	}
+	deleted, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if deleted > 0 && kind == ReactionLike {
+		err = sqliteRetractNotification(tx, NotificationLike, authorID, userID, chirpID)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (db *SQLiteDB) GetChirpStats(chirpIDs []int, viewerID int) (map[int]ChirpStats, error) {
+	stats := make(map[int]ChirpStats, len(chirpIDs))
+	if len(chirpIDs) == 0 {
+		return stats, nil
+	}
+	idsJSON, err := json.Marshal(chirpIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.conn.Query(
+		`SELECT chirp_id, kind, COUNT(*), MAX(user_id = ?) FROM reactions
+		WHERE chirp_id IN (SELECT value FROM json_each(?))
+		GROUP BY chirp_id, kind`,
+		viewerID, string(idsJSON),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for _, id := range chirpIDs {
+		stats[id] = ChirpStats{}
+	}
+	for rows.Next() {
+		var chirpID, count int
+		var kind ReactionKind
+		var mine bool
+		err := rows.Scan(&chirpID, &kind, &count, &mine)
+		if err != nil {
+			return nil, err
+		}
+		chirpStats := stats[chirpID]
+		switch kind {
+		case ReactionLike:
+			chirpStats.Likes, chirpStats.Liked = count, mine
+		case ReactionRechirp:
+			chirpStats.Rechirps, chirpStats.Rechirped = count, mine
+		}
+		stats[chirpID] = chirpStats
+	}
+	return stats, rows.Err()
+}
+
+func scanReaction(row rowScanner) (Reaction, error) {
+	reaction := Reaction{}
+	err := row.Scan(&reaction.ChirpID, &reaction.UserID, &reaction.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Reaction{}, ErrNotExist
+	}
+	return reaction, err
+}
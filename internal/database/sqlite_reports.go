@@ -0,0 +1,147 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+const sqliteReportColumns = `id, reporter_id, chirp_id, user_id, reason, status, moderator_id, note, created_at, updated_at`
+
+func (db *SQLiteDB) CreateReport(params Report) (Report, error) {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return Report{}, err
+	}
+	defer tx.Rollback()
+
+	userID := params.UserID
+	if params.ChirpID != 0 {
+		userID, err = sqliteChirpAuthor(tx, params.ChirpID)
+		if err != nil {
+			return Report{}, err
+		}
+	}
+	err = sqliteUserExists(tx, userID)
+	if err != nil {
+		return Report{}, err
+	}
+
+	now := time.Now().UTC()
+	report, err := scanReport(tx.QueryRow(
+		`INSERT INTO reports (reporter_id, chirp_id, user_id, reason, status, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		RETURNING `+sqliteReportColumns,
+		params.ReporterID, params.ChirpID, userID, params.Reason, ReportOpen, now, now,
+	))
+	if err != nil {
+		return Report{}, err
+	}
+
+	return report, tx.Commit()
+}
+
+func (db *SQLiteDB) GetReport(id int) (Report, error) {
+	return scanReport(db.conn.QueryRow(`SELECT `+sqliteReportColumns+` FROM reports WHERE id = ?`, id))
+}
+
+func (db *SQLiteDB) GetReports(q ReportQuery) (ReportPage, error) {
+	err := q.validate()
+	if err != nil {
+		return ReportPage{}, err
+	}
+
+	filters := []string{}
+	args := []any{}
+	if len(q.Statuses) > 0 {
+		statuses, err := json.Marshal(q.Statuses)
+		if err != nil {
+			return ReportPage{}, err
+		}
+		filters = append(filters, `status IN (SELECT value FROM json_each(?))`)
+		args = append(args, string(statuses))
+	}
+	if q.AfterID != 0 {
+		filters = append(filters, `id > ?`)
+		args = append(args, q.AfterID)
+	}
+	query := `SELECT ` + sqliteReportColumns + ` FROM reports` + sqliteWhere(filters) + ` ORDER BY id`
+	if q.Limit > 0 {
+		query += ` LIMIT ?`
+		args = append(args, q.Limit+1)
+	}
+
+	rows, err := db.conn.Query(query, args...)
+	if err != nil {
+		return ReportPage{}, err
+	}
+	defer rows.Close()
+
+	page := ReportPage{Reports: []Report{}}
+	for rows.Next() {
+		report, err := scanReport(rows)
+		if err != nil {
+			return ReportPage{}, err
+		}
+		page.Reports = append(page.Reports, report)
+	}
+	if err := rows.Err(); err != nil {
+		return ReportPage{}, err
+	}
+	if q.Limit > 0 && len(page.Reports) > q.Limit {
+		page.Reports = page.Reports[:q.Limit]
+		page.HasNext = true
+	}
+	return page, nil
+}
+
+func (db *SQLiteDB) ModerateReport(id, moderatorID int, status ReportStatus, note string) (Report, error) {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return Report{}, err
+	}
+	defer tx.Rollback()
+
+	existing, err := scanReport(tx.QueryRow(`SELECT `+sqliteReportColumns+` FROM reports WHERE id = ?`, id))
+	if err != nil {
+		return Report{}, err
+	}
+	report, err := existing.moderate(moderatorID, status, note, time.Now().UTC())
+	if err != nil {
+		return Report{}, err
+	}
+	_, err = tx.Exec(
+		`UPDATE reports SET status = ?, moderator_id = ?, note = ?, updated_at = ? WHERE id = ?`,
+		report.Status, report.ModeratorID, report.Note, report.UpdatedAt, id,
+	)
+	if err != nil {
+		return Report{}, err
+	}
+	err = sqliteLogModeration(tx, ModerationAction{
+		ModeratorID: moderatorID,
+		Kind:        status.moderationKind(),
+		ReportID:    id,
+		ChirpID:     report.ChirpID,
+		UserID:      report.UserID,
+		Reason:      note,
+		CreatedAt:   report.UpdatedAt,
+	})
+	if err != nil {
+		return Report{}, err
+	}
+
+	return report, tx.Commit()
+}
+
+func scanReport(row rowScanner) (Report, error) {
+	report := Report{}
+	err := row.Scan(
+		&report.ID, &report.ReporterID, &report.ChirpID, &report.UserID, &report.Reason, &report.Status,
+		&report.ModeratorID, &report.Note, &report.CreatedAt, &report.UpdatedAt,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Report{}, ErrNotExist
+	}
+	return report, err
+}
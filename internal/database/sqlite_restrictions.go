@@ -0,0 +1,171 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+const sqliteRestrictionColumns = `user_id, target_id, created_at`
+
+func (db *SQLiteDB) AddRestriction(kind RestrictionKind, userID, targetID int) (Restriction, error) {
+	err := kind.validate()
+	if err != nil {
+		return Restriction{}, err
+	}
+
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return Restriction{}, err
+	}
+	defer tx.Rollback()
+
+	err = sqliteUserExists(tx, targetID)
+	if err != nil {
+		return Restriction{}, err
+	}
+	if kind == RestrictionBlock {
+		_, err = tx.Exec(
+			`DELETE FROM follows WHERE (follower_id = ? AND followee_id = ?) OR (follower_id = ? AND followee_id = ?)`,
+			userID, targetID, targetID, userID,
+		)
+		if err != nil {
+			return Restriction{}, err
+		}
+	}
+	_, err = tx.Exec(
+		`INSERT INTO restrictions (kind, user_id, target_id, created_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT (kind, user_id, target_id) DO NOTHING`,
+		kind, userID, targetID, time.Now().UTC(),
+	)
+	if err != nil {
+		return Restriction{}, err
+	}
+	restriction, err := scanRestriction(tx.QueryRow(
+		`SELECT `+sqliteRestrictionColumns+` FROM restrictions WHERE kind = ? AND user_id = ? AND target_id = ?`,
+		kind, userID, targetID,
+	))
+	if err != nil {
+		return Restriction{}, err
+	}
+
+	return restriction, tx.Commit()
+}
+
+func (db *SQLiteDB) RemoveRestriction(kind RestrictionKind, userID, targetID int) error {
+	err := kind.validate()
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = sqliteUserExists(tx, targetID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(
+		`DELETE FROM restrictions WHERE kind = ? AND user_id = ? AND target_id = ?`,
+		kind, userID, targetID,
+	)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (db *SQLiteDB) GetRestrictions(kind RestrictionKind, userID int) ([]Restriction, error) {
+	err := kind.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.conn.Query(
+		`SELECT `+sqliteRestrictionColumns+` FROM restrictions WHERE kind = ? AND user_id = ?
+		ORDER BY created_at DESC, target_id`,
+		kind, userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	restrictions := []Restriction{}
+	for rows.Next() {
+		restriction, err := scanRestriction(rows)
+		if err != nil {
+			return nil, err
+		}
+		restrictions = append(restrictions, restriction)
+	}
+	return restrictions, rows.Err()
+}
+
+func (db *SQLiteDB) IsBlocked(userID, otherID int) (bool, error) {
+	err := sqliteCheckBlocked(db.conn, userID, otherID)
+	if errors.Is(err, ErrBlocked) {
+		return true, nil
+	}
+	return false, err
+}
+
+// sqliteCheckBlocked returns ErrBlocked if either of two users has blocked
+// the other.
+func sqliteCheckBlocked(q sqliteQueryer, userID, otherID int) error {
+	var blocked bool
+	err := q.QueryRow(
+		`SELECT EXISTS (SELECT 1 FROM restrictions WHERE kind = 'block'
+			AND ((user_id = ? AND target_id = ?) OR (user_id = ? AND target_id = ?)))`,
+		userID, otherID, otherID, userID,
+	).Scan(&blocked)
+	if err != nil {
+		return err
+	}
+	if blocked {
+		return ErrBlocked
+	}
+	return nil
+}
+
+// hiddenFrom returns the users whose chirps viewerID doesn't see, as
+// DBStructure.hiddenFrom does.
+func (db *SQLiteDB) hiddenFrom(viewerID int, muted bool) (map[int]struct{}, error) {
+	hidden := map[int]struct{}{}
+	if viewerID == 0 {
+		return hidden, nil
+	}
+
+	rows, err := db.conn.Query(
+		`SELECT target_id FROM restrictions WHERE user_id = ? AND (kind = 'block' OR (kind = 'mute' AND ?))
+		UNION
+		SELECT user_id FROM restrictions WHERE kind = 'block' AND target_id = ?`,
+		viewerID, muted, viewerID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int
+		err := rows.Scan(&id)
+		if err != nil {
+			return nil, err
+		}
+		hidden[id] = struct{}{}
+	}
+	return hidden, rows.Err()
+}
+
+func scanRestriction(row rowScanner) (Restriction, error) {
+	restriction := Restriction{}
+	err := row.Scan(&restriction.UserID, &restriction.TargetID, &restriction.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Restriction{}, ErrNotExist
+	}
+	return restriction, err
+}
@@ -0,0 +1,29 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+func (db *SQLiteDB) RevokeToken(token string) error {
+	_, err := db.conn.Exec(
+		`INSERT INTO revocations (token, revoked_at) VALUES (?, ?)
+		ON CONFLICT (token) DO UPDATE SET revoked_at = excluded.revoked_at`,
+		token, time.Now().UTC(),
+	)
+	return err
+}
+
+func (db *SQLiteDB) IsTokenRevoked(token string) (bool, error) {
+	var revokedAt time.Time
+	err := db.conn.QueryRow(`SELECT revoked_at FROM revocations WHERE token = ?`, token).Scan(&revokedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return !revokedAt.IsZero(), nil
+}
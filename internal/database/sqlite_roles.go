@@ -0,0 +1,103 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// sqliteSetRole is DBStructure.setRole within tx.
+func sqliteSetRole(tx *sql.Tx, userID, moderatorID int, role Role) (User, error) {
+	now := time.Now().UTC()
+	user, err := scanUser(tx.QueryRow(
+		`UPDATE users SET role = ?, sessions_valid_after = ? WHERE id = ? RETURNING `+sqliteUserColumns,
+		role, now, userID,
+	))
+	if err != nil {
+		return User{}, err
+	}
+
+	err = sqliteLogModeration(tx, ModerationAction{
+		ModeratorID: moderatorID,
+		Kind:        ModerationSetRole,
+		UserID:      userID,
+		Role:        role,
+		CreatedAt:   now,
+	})
+	if err != nil {
+		return User{}, err
+	}
+	return user, nil
+}
+
+// sqliteCheckOutranks is DBStructure.checkOutranks.
+func sqliteCheckOutranks(q sqliteQueryer, moderatorID, userID int) error {
+	var userRole Role
+	err := q.QueryRow(`SELECT role FROM users WHERE id = ?`, userID).Scan(&userRole)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotExist
+	}
+	if err != nil {
+		return err
+	}
+	var moderatorRole Role
+	err = q.QueryRow(`SELECT role FROM users WHERE id = ?`, moderatorID).Scan(&moderatorRole)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	if !moderatorRole.outranks(userRole) {
+		return ErrOutranked
+	}
+	return nil
+}
+
+func (db *SQLiteDB) SetUserRole(userID, adminID int, role Role) (User, error) {
+	err := role.validate()
+	if err != nil {
+		return User{}, err
+	}
+
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return User{}, err
+	}
+	defer tx.Rollback()
+
+	err = sqliteCheckOutranks(tx, adminID, userID)
+	if err != nil {
+		return User{}, err
+	}
+	user, err := sqliteSetRole(tx, userID, adminID, role)
+	if err != nil {
+		return User{}, err
+	}
+
+	return user, tx.Commit()
+}
+
+func (db *SQLiteDB) BootstrapAdmin(email string) (User, error) {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return User{}, err
+	}
+	defer tx.Rollback()
+
+	var exists bool
+	err = tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM users WHERE role = ?)`, RoleAdmin).Scan(&exists)
+	if err != nil {
+		return User{}, err
+	}
+	if exists {
+		return User{}, ErrAdminExists
+	}
+	user, err := scanUser(tx.QueryRow(`SELECT `+sqliteUserColumns+` FROM users WHERE email = ?`, email))
+	if err != nil {
+		return User{}, err
+	}
+	user, err = sqliteSetRole(tx, user.ID, 0, RoleAdmin)
+	if err != nil {
+		return User{}, err
+	}
+
+	return user, tx.Commit()
+}
@@ -0,0 +1,81 @@
+package database
+
+import "database/sql"
+
+// GetThread finds the conversation's root by following in_reply_to upwards
+// through chirps and tombstones, then collects everything below it.
+func (db *SQLiteDB) GetThread(id int) ([]ThreadEntry, error) {
+	rows, err := db.conn.Query(`
+WITH RECURSIVE
+	entries (id, in_reply_to) AS (
+		SELECT id, in_reply_to FROM chirps
+		UNION ALL
+		SELECT id, in_reply_to FROM chirp_tombstones
+	),
+	ancestors (id, in_reply_to) AS (
+		SELECT id, in_reply_to FROM entries WHERE id = ?
+		UNION
+		SELECT entries.id, entries.in_reply_to FROM entries
+		JOIN ancestors ON entries.id = ancestors.in_reply_to
+	),
+	root (id) AS (
+		SELECT MIN(id) FROM ancestors
+	),
+	thread (id, in_reply_to) AS (
+		SELECT entries.id, entries.in_reply_to FROM entries JOIN root ON entries.id = root.id
+		UNION
+		SELECT entries.id, entries.in_reply_to FROM entries
+		JOIN thread ON entries.in_reply_to = thread.id
+	)
+SELECT thread.id, thread.in_reply_to, chirps.author_id, chirps.body, chirps.hashtags, chirps.mentions,
+	chirps.media_ids, chirps.created_at, chirps.updated_at, chirps.visibility,
+	chirps.hidden
+FROM thread LEFT JOIN chirps ON chirps.id = thread.id
+ORDER BY thread.id`,
+		id,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []ThreadEntry{}
+	for rows.Next() {
+		entry := ThreadEntry{}
+		var authorID sql.NullInt64
+		var body, hashtags, mentions, mediaIDs, visibility sql.NullString
+		var createdAt, updatedAt sql.NullTime
+		var hidden sql.NullBool
+		err := rows.Scan(
+			&entry.ID, &entry.InReplyTo, &authorID, &body, &hashtags, &mentions, &mediaIDs, &createdAt, &updatedAt,
+			&visibility, &hidden,
+		)
+		if err != nil {
+			return nil, err
+		}
+		if authorID.Valid {
+			entry.Chirp = &Chirp{
+				ID:         entry.ID,
+				AuthorID:   int(authorID.Int64),
+				Body:       body.String,
+				InReplyTo:  entry.InReplyTo,
+				CreatedAt:  createdAt.Time,
+				UpdatedAt:  updatedAt.Time,
+				Visibility: Visibility(visibility.String),
+				Hidden:     hidden.Bool,
+			}
+			err = decodeChirpEntities(entry.Chirp, hashtags.String, mentions.String, mediaIDs.String)
+			if err != nil {
+				return nil, err
+			}
+		}
+		entries = append(entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, ErrNotExist
+	}
+	return entries, nil
+}
@@ -0,0 +1,180 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+)
+
+const sqliteUserColumns = `id, email, hashed_password, is_chirpy_red, handle, display_name, bio, avatar_media_id, sessions_valid_after, suspended, role`
+
+func (db *SQLiteDB) CreateUser(email, hashedPassword string) (User, error) {
+	res, err := db.conn.Exec(
+		`INSERT INTO users (email, hashed_password) VALUES (?, ?)`,
+		email, hashedPassword,
+	)
+	if isUniqueViolation(err) {
+		return User{}, ErrAlreadyExists
+	}
+	if err != nil {
+		return User{}, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return User{}, err
+	}
+
+	return User{
+		ID:             int(id),
+		Email:          email,
+		HashedPassword: hashedPassword,
+		Role:           RoleUser,
+	}, nil
+}
+
+func (db *SQLiteDB) GetUser(id int) (User, error) {
+	row := db.conn.QueryRow(`SELECT `+sqliteUserColumns+` FROM users WHERE id = ?`, id)
+	return scanUser(row)
+}
+
+func (db *SQLiteDB) GetUserByEmail(email string) (User, error) {
+	row := db.conn.QueryRow(`SELECT `+sqliteUserColumns+` FROM users WHERE email = ?`, email)
+	return scanUser(row)
+}
+
+func (db *SQLiteDB) GetUserByHandle(handle string) (User, error) {
+	row := db.conn.QueryRow(`SELECT `+sqliteUserColumns+` FROM users WHERE handle = ? COLLATE NOCASE`, handle)
+	return scanUser(row)
+}
+
+// UpdateUser checks the new email and handle itself, rather than leaving it
+// to the unique indexes, so it can tell which of the two is taken.
+func (db *SQLiteDB) UpdateUser(id int, update UserUpdate) (User, error) {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return User{}, err
+	}
+	defer tx.Rollback()
+
+	err = sqliteUserExists(tx, id)
+	if err != nil {
+		return User{}, err
+	}
+
+	set := []string{}
+	args := []any{}
+	if update.Email != nil {
+		err := sqliteCheckTaken(tx, `SELECT EXISTS (SELECT 1 FROM users WHERE email = ? AND id != ?)`, *update.Email, id)
+		if err != nil {
+			return User{}, err
+		}
+		set = append(set, "email = ?")
+		args = append(args, *update.Email)
+	}
+	if update.HashedPassword != nil {
+		set = append(set, "hashed_password = ?")
+		args = append(args, *update.HashedPassword)
+	}
+	if update.Handle != nil {
+		err := sqliteCheckTaken(tx, `SELECT EXISTS (SELECT 1 FROM users WHERE handle = ? COLLATE NOCASE AND id != ?)`, *update.Handle, id)
+		if errors.Is(err, ErrAlreadyExists) {
+			return User{}, ErrHandleTaken
+		}
+		if err != nil {
+			return User{}, err
+		}
+		set = append(set, "handle = ?")
+		args = append(args, sql.NullString{String: *update.Handle, Valid: *update.Handle != ""})
+	}
+	if update.DisplayName != nil {
+		set = append(set, "display_name = ?")
+		args = append(args, *update.DisplayName)
+	}
+	if update.Bio != nil {
+		set = append(set, "bio = ?")
+		args = append(args, *update.Bio)
+	}
+	if update.AvatarMediaID != nil {
+		if *update.AvatarMediaID != 0 {
+			err := sqliteCheckMediaIDs(tx, id, []int{*update.AvatarMediaID})
+			if err != nil {
+				return User{}, err
+			}
+		}
+		set = append(set, "avatar_media_id = ?")
+		args = append(args, *update.AvatarMediaID)
+	}
+	if update.SessionsValidAfter != nil {
+		set = append(set, "sessions_valid_after = ?")
+		args = append(args, update.SessionsValidAfter.UTC())
+	}
+
+	query := `SELECT ` + sqliteUserColumns + ` FROM users WHERE id = ?`
+	if len(set) > 0 {
+		query = `UPDATE users SET ` + strings.Join(set, ", ") + ` WHERE id = ? RETURNING ` + sqliteUserColumns
+	}
+	user, err := scanUser(tx.QueryRow(query, append(args, id)...))
+	if err != nil {
+		return User{}, err
+	}
+
+	return user, tx.Commit()
+}
+
+// sqliteCheckTaken runs an EXISTS query for a value another user already
+// has, returning ErrAlreadyExists if one does.
+func sqliteCheckTaken(q sqliteQueryer, query string, value string, id int) error {
+	var taken bool
+	err := q.QueryRow(query, value, id).Scan(&taken)
+	if err != nil {
+		return err
+	}
+	if taken {
+		return ErrAlreadyExists
+	}
+	return nil
+}
+
+func (db *SQLiteDB) UpgradeChirpyRed(
+	id int,
+) (User, error) {
+	row := db.conn.QueryRow(
+		`UPDATE users SET is_chirpy_red = TRUE WHERE id = ? RETURNING `+sqliteUserColumns,
+		id,
+	)
+	return scanUser(row)
+}
+
+func scanUser(row rowScanner) (User, error) {
+	user := User{}
+	var handle sql.NullString
+	var sessionsValidAfter sql.NullTime
+	err := row.Scan(
+		&user.ID, &user.Email, &user.HashedPassword, &user.IsChirpyRed,
+		&handle, &user.DisplayName, &user.Bio, &user.AvatarMediaID,
+		&sessionsValidAfter, &user.Suspended, &user.Role,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return User{}, ErrNotExist
+	}
+	user.Handle = handle.String
+	user.SessionsValidAfter = sessionsValidAfter.Time
+	return user, err
+}
+
+// sqliteQueryer is what *sql.DB and *sql.Tx have in common.
+type sqliteQueryer interface {
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+func sqliteUserExists(q sqliteQueryer, id int) error {
+	var exists bool
+	err := q.QueryRow(`SELECT EXISTS (SELECT 1 FROM users WHERE id = ?)`, id).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrNotExist
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package database
+
+import "time"
+
+// Store is the persistence API used by the HTTP handlers. DB (a single JSON
+// file) and SQLiteDB (an embedded SQLite database) both implement it.
+type Store interface {
+	CreateChirp(params Chirp) (Chirp, error)
+	GetChirps() ([]Chirp, error)
+	QueryChirps(q ChirpQuery) (ChirpPage, error)
+	SearchChirps(s ChirpSearch) ([]Chirp, error)
+	GetChirp(id int) (Chirp, error)
+	CanViewChirp(chirp Chirp, viewerID int) (bool, error)
+	UpdateChirp(id int, body string) (Chirp, error)
+	GetChirpHistory(id int) ([]ChirpRevision, error)
+	DeleteChirp(id int) error
+	DeleteChirpAsModerator(id, moderatorID int, reason string) error
+	GetThread(id int) ([]ThreadEntry, error)
+	TrendingHashtags(window, halfLife time.Duration, limit int) ([]TrendingHashtag, error)
+
+	CreateChirpDraft(params ChirpDraft) (ChirpDraft, error)
+	GetChirpDraft(id int) (ChirpDraft, error)
+	GetChirpDrafts(authorID int) ([]ChirpDraft, error)
+	GetDueChirpDrafts(now time.Time) ([]ChirpDraft, error)
+	UpdateChirpDraft(params ChirpDraft) (ChirpDraft, error)
+	UnscheduleChirpDraft(id int, reason string) error
+	DeleteChirpDraft(id int) error
+	PublishChirpDraft(id int, body string) (Chirp, error)
+
+	AddReaction(kind ReactionKind, chirpID, userID int) (Reaction, error)
+	RemoveReaction(kind ReactionKind, chirpID, userID int) error
+	GetChirpStats(chirpIDs []int, viewerID int) (map[int]ChirpStats, error)
+
+	CreateMedia(params Media) (media Media, created bool, err error)
+	GetMedia(id int) (Media, error)
+	CanViewMedia(media Media, viewerID int) (bool, error)
+	DeleteUnreferencedMedia(ids []int) ([]Media, error)
+
+	CreateUser(email, hashedPassword string) (User, error)
+	GetUser(id int) (User, error)
+	GetUserByEmail(email string) (User, error)
+	GetUserByHandle(handle string) (User, error)
+	UpdateUser(id int, update UserUpdate) (User, error)
+	UpgradeChirpyRed(id int) (User, error)
+	SetUserRole(userID, adminID int, role Role) (User, error)
+	BootstrapAdmin(email string) (User, error)
+
+	FollowUser(followerID, followeeID int) (Follow, error)
+	UnfollowUser(followerID, followeeID int) error
+	GetFollowers(userID, viewerID int) ([]Follow, error)
+	GetFollowing(userID, viewerID int) ([]Follow, error)
+
+	AddRestriction(kind RestrictionKind, userID, targetID int) (Restriction, error)
+	RemoveRestriction(kind RestrictionKind, userID, targetID int) error
+	GetRestrictions(kind RestrictionKind, userID int) ([]Restriction, error)
+	IsBlocked(userID, otherID int) (bool, error)
+
+	GetNotifications(q NotificationQuery) (NotificationPage, error)
+	MarkNotificationsRead(userID int, ids []int) (int, error)
+
+	CreateConversation(creatorID int, memberIDs []int) (conversation Conversation, created bool, err error)
+	GetConversation(id int) (Conversation, error)
+	GetConversations(userID int) ([]Conversation, error)
+	CreateMessage(conversationID, senderID int, body string) (Message, error)
+	GetMessages(q MessageQuery) (MessagePage, error)
+
+	CreateReport(params Report) (Report, error)
+	GetReport(id int) (Report, error)
+	GetReports(q ReportQuery) (ReportPage, error)
+	ModerateReport(id, moderatorID int, status ReportStatus, note string) (Report, error)
+	HideChirp(chirpID, moderatorID int, hidden bool, reason string) (Chirp, error)
+	SuspendUser(userID, moderatorID int, suspended bool, reason string) (User, error)
+	GetModerationLog(q ModerationLogQuery) (ModerationLogPage, error)
+
+	RevokeToken(token string) error
+	IsTokenRevoked(token string) (bool, error)
+
+	ResetDB() error
+	Close() error
+
+	Migrator
+}
+
+var (
+	_ Store = (*DB)(nil)
+	_ Store = (*SQLiteDB)(nil)
+)
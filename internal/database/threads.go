@@ -0,0 +1,80 @@
+package database
+
+import (
+	"sort"
+	"time"
+)
+
+// ChirpTombstone stands in for a deleted chirp that had replies, so they can
+// still be shown in their place in the conversation.
+type ChirpTombstone struct {
+	ID        int       `json:"id"`
+	InReplyTo int       `json:"in_reply_to,omitempty"`
+	DeletedAt time.Time `json:"deleted_at"`
+}
+
+// ThreadEntry is one chirp of a conversation. Chirp is nil for a chirp that
+// has been deleted.
+type ThreadEntry struct {
+	ID        int
+	InReplyTo int
+	Chirp     *Chirp
+}
+
+// GetThread returns every entry of the conversation that id belongs to,
+// ordered by ID. Replies always have higher IDs than their parents, so the
+// conversation's root comes first.
+func (db *DB) GetThread(id int) ([]ThreadEntry, error) {
+	entries := []ThreadEntry{}
+	err := db.View(func(dbStructure *DBStructure) error {
+		entry, ok := dbStructure.threadEntry(id)
+		if !ok {
+			return ErrNotExist
+		}
+
+		// Walk up to the root. Reply chains can't loop, since a chirp can
+		// only reply to one that already exists, but guard against it anyway.
+		seen := map[int]bool{entry.ID: true}
+		for entry.InReplyTo != 0 && !seen[entry.InReplyTo] {
+			parent, ok := dbStructure.threadEntry(entry.InReplyTo)
+			if !ok {
+				break
+			}
+			entry = parent
+			seen[entry.ID] = true
+		}
+
+		queue := []ThreadEntry{entry}
+		seen = map[int]bool{entry.ID: true}
+		for len(queue) > 0 {
+			entry, queue = queue[0], queue[1:]
+			entries = append(entries, entry)
+			for replyID := range dbStructure.replies[entry.ID] {
+				reply, ok := dbStructure.threadEntry(replyID)
+				if ok && !seen[replyID] {
+					seen[replyID] = true
+					queue = append(queue, reply)
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].ID < entries[j].ID
+	})
+	return entries, nil
+}
+
+func (dbStructure *DBStructure) threadEntry(id int) (ThreadEntry, bool) {
+	if chirp, ok := dbStructure.Chirps[id]; ok {
+		return ThreadEntry{ID: id, InReplyTo: chirp.InReplyTo, Chirp: &chirp}, true
+	}
+	if tombstone, ok := dbStructure.ChirpTombstones[id]; ok {
+		return ThreadEntry{ID: id, InReplyTo: tombstone.InReplyTo}, true
+	}
+	return ThreadEntry{}, false
+}
@@ -1,35 +1,73 @@
 package database
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
 
 type User struct {
 	ID             int    `json:"id"`
 	Email          string `json:"email"`
 	HashedPassword string `json:"hashed_password"`
 	IsChirpyRed    bool   `json:"is_chirpy_red"`
+	// Handle is the user's @name. It is unique ignoring case, but kept as
+	// the user typed it. Users who haven't chosen one have none.
+	Handle        string `json:"handle,omitempty"`
+	DisplayName   string `json:"display_name,omitempty"`
+	Bio           string `json:"bio,omitempty"`
+	AvatarMediaID int    `json:"avatar_media_id,omitempty"`
+	// SessionsValidAfter is when the user's sessions were last revoked.
+	// Tokens issued before it are no longer accepted.
+	SessionsValidAfter time.Time `json:"sessions_valid_after"`
+	// Suspended users have been locked out by a moderator.
+	Suspended bool `json:"suspended,omitempty"`
+	Role      Role `json:"role"`
 }
 
 var ErrAlreadyExists = errors.New("already exists")
 
-func (db *DB) CreateUser(email, hashedPassword string) (User, error) {
-	if _, err := db.GetUserByEmail(email); !errors.Is(err, ErrNotExist) {
-		return User{}, ErrAlreadyExists
-	}
+// ErrHandleTaken is returned for a handle another user already has. It is
+// also an ErrAlreadyExists.
+var ErrHandleTaken = fmt.Errorf("handle %w", ErrAlreadyExists)
+
+// UserUpdate lists the changes to make to a user; nil fields are left as
+// they are. An empty Handle removes the handle, and an AvatarMediaID of 0
+// removes the avatar.
+type UserUpdate struct {
+	Email          *string
+	HashedPassword *string
+	Handle         *string
+	DisplayName    *string
+	Bio            *string
+	AvatarMediaID  *int
+	// SessionsValidAfter revokes the tokens issued before it.
+	SessionsValidAfter *time.Time
+}
 
-	dbStructure, err := db.loadDB()
-	if err != nil {
-		return User{}, err
-	}
+// handleKey is the form handles are compared in.
+func handleKey(handle string) string {
+	return strings.ToLower(handle)
+}
 
-	id := len(dbStructure.Users) + 1
-	user := User{
-		ID:             id,
-		Email:          email,
-		HashedPassword: hashedPassword,
-	}
-	dbStructure.Users[id] = user
+func (db *DB) CreateUser(email, hashedPassword string) (User, error) {
+	user := User{}
+	err := db.Update(func(dbStructure *DBStructure) error {
+		if _, ok := dbStructure.userByEmail(email); ok {
+			return ErrAlreadyExists
+		}
 
-	err = db.writeDB(dbStructure)
+		id := dbStructure.nextID(sequenceUsers)
+		user = User{
+			ID:             id,
+			Email:          email,
+			HashedPassword: hashedPassword,
+			Role:           RoleUser,
+		}
+		dbStructure.putUser(user)
+		return nil
+	})
 	if err != nil {
 		return User{}, err
 	}
@@ -38,54 +76,107 @@ func (db *DB) CreateUser(email, hashedPassword string) (User, error) {
 }
 
 func (db *DB) GetUser(id int) (User, error) {
-	dbStructure, err := db.loadDB()
+	user := User{}
+	err := db.View(func(dbStructure *DBStructure) error {
+		var ok bool
+		user, ok = dbStructure.Users[id]
+		if !ok {
+			return ErrNotExist
+		}
+		return nil
+	})
 	if err != nil {
 		return User{}, err
 	}
 
-	user, ok := dbStructure.Users[id]
-	if !ok {
-		return User{}, ErrNotExist
-	}
-
 	return user, nil
 }
 
 func (db *DB) GetUserByEmail(email string) (User, error) {
-	dbStructure, err := db.loadDB()
+	user := User{}
+	err := db.View(func(dbStructure *DBStructure) error {
+		var ok bool
+		user, ok = dbStructure.userByEmail(email)
+		if !ok {
+			return ErrNotExist
+		}
+		return nil
+	})
 	if err != nil {
 		return User{}, err
 	}
 
-	for _, user := range dbStructure.Users {
-		if user.Email == email {
-			return user, nil
-		}
-	}
-
-	return User{}, ErrNotExist
+	return user, nil
 }
 
-func (db *DB) UpdateUser(
-	id int,
-	email,
-	hashedPassword string,
-) (User, error) {
-	dbStructure, err := db.loadDB()
+// GetUserByHandle finds a user by handle, ignoring case.
+func (db *DB) GetUserByHandle(handle string) (User, error) {
+	user := User{}
+	err := db.View(func(dbStructure *DBStructure) error {
+		var ok bool
+		user, ok = dbStructure.userByHandle(handle)
+		if !ok {
+			return ErrNotExist
+		}
+		return nil
+	})
 	if err != nil {
 		return User{}, err
 	}
 
-	user, ok := dbStructure.Users[id]
-	if !ok {
-		return User{}, ErrNotExist
-	}
+	return user, nil
+}
+
+// UpdateUser applies update to a user. It returns ErrAlreadyExists if the
+// new email belongs to someone else, ErrHandleTaken if the new handle does,
+// and ErrMediaNotExist if the new avatar doesn't exist or isn't the user's
+// own upload.
+func (db *DB) UpdateUser(id int, update UserUpdate) (User, error) {
+	user := User{}
+	err := db.Update(func(dbStructure *DBStructure) error {
+		var ok bool
+		user, ok = dbStructure.Users[id]
+		if !ok {
+			return ErrNotExist
+		}
 
-	user.Email = email
-	user.HashedPassword = hashedPassword
-	dbStructure.Users[id] = user
+		if update.Email != nil {
+			if other, ok := dbStructure.userByEmail(*update.Email); ok && other.ID != id {
+				return ErrAlreadyExists
+			}
+			user.Email = *update.Email
+		}
+		if update.HashedPassword != nil {
+			user.HashedPassword = *update.HashedPassword
+		}
+		if update.Handle != nil {
+			if other, ok := dbStructure.userByHandle(*update.Handle); ok && other.ID != id {
+				return ErrHandleTaken
+			}
+			user.Handle = *update.Handle
+		}
+		if update.DisplayName != nil {
+			user.DisplayName = *update.DisplayName
+		}
+		if update.Bio != nil {
+			user.Bio = *update.Bio
+		}
+		if update.AvatarMediaID != nil {
+			if *update.AvatarMediaID != 0 {
+				err := dbStructure.checkMediaIDs(id, []int{*update.AvatarMediaID})
+				if err != nil {
+					return err
+				}
+			}
+			user.AvatarMediaID = *update.AvatarMediaID
+		}
+		if update.SessionsValidAfter != nil {
+			user.SessionsValidAfter = update.SessionsValidAfter.UTC()
+		}
 
-	err = db.writeDB(dbStructure)
+		dbStructure.putUser(user)
+		return nil
+	})
 	if err != nil {
 		return User{}, err
 	}
@@ -96,20 +187,25 @@ func (db *DB) UpdateUser(
 func (db *DB) UpgradeChirpyRed(
 	id int,
 ) (User, error) {
-	dbStructure, err := db.loadDB()
-	if err != nil {
-		return User{}, err
-	}
-
-	user, ok := dbStructure.Users[id]
-	if !ok {
-		return User{}, ErrNotExist
-	}
+	return db.modifyUser(id, func(user *User) {
+		user.IsChirpyRed = true
+	})
+}
 
-	user.IsChirpyRed = true
-	dbStructure.Users[id] = user
+// modifyUser applies fn to the stored user inside a single transaction.
+func (db *DB) modifyUser(id int, fn func(*User)) (User, error) {
+	user := User{}
+	err := db.Update(func(dbStructure *DBStructure) error {
+		var ok bool
+		user, ok = dbStructure.Users[id]
+		if !ok {
+			return ErrNotExist
+		}
 
-	err = db.writeDB(dbStructure)
+		fn(&user)
+		dbStructure.putUser(user)
+		return nil
+	})
 	if err != nil {
 		return User{}, err
 	}
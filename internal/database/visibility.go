@@ -0,0 +1,100 @@
+package database
+
+import "errors"
+
+// Visibility is who may see a chirp. Its author always can.
+type Visibility string
+
+const (
+	// VisibilityPublic chirps are seen by everyone and listed everywhere.
+	VisibilityPublic Visibility = "public"
+	// VisibilityFollowers chirps are seen only by the author's followers.
+	VisibilityFollowers Visibility = "followers"
+	// VisibilityUnlisted chirps are seen by everyone, but left out of the
+	// global listings, hashtag listings and search. They still show up on
+	// the author's own listings and where they mention someone.
+	VisibilityUnlisted Visibility = "unlisted"
+	// VisibilityPrivate chirps are seen only by their author.
+	VisibilityPrivate Visibility = "private"
+)
+
+var ErrInvalidVisibility = errors.New("invalid visibility")
+
+func (v Visibility) validate() error {
+	switch v {
+	case VisibilityPublic, VisibilityFollowers, VisibilityUnlisted, VisibilityPrivate:
+		return nil
+	}
+	return ErrInvalidVisibility
+}
+
+// orPublic returns v, or public if it is unset.
+func (v Visibility) orPublic() Visibility {
+	if v == "" {
+		return VisibilityPublic
+	}
+	return v
+}
+
+// visibleTo reports whether viewerID, who is 0 when anonymous and follows
+// the users in following, may see chirp. Hidden chirps are seen by their
+// authors only. Blocks are checked separately.
+func (chirp Chirp) visibleTo(viewerID int, following map[int]struct{}) bool {
+	if viewerID != 0 && viewerID == chirp.AuthorID {
+		return true
+	}
+	if chirp.Hidden {
+		return false
+	}
+	switch chirp.Visibility {
+	case VisibilityFollowers:
+		_, ok := following[chirp.AuthorID]
+		return ok
+	case VisibilityPrivate:
+		return false
+	}
+	return true
+}
+
+// listedFor is visibleTo for listings, which leave out other people's
+// unlisted chirps unless scoped to particular authors or mentions.
+func (chirp Chirp) listedFor(viewerID int, following map[int]struct{}, scoped bool) bool {
+	if chirp.Visibility == VisibilityUnlisted && !scoped && chirp.AuthorID != viewerID {
+		return false
+	}
+	return chirp.visibleTo(viewerID, following)
+}
+
+// canView reports whether viewerID, who is 0 when anonymous, may see chirp:
+// its visibility lets them, and they and its author haven't blocked each
+// other.
+func (dbStructure *DBStructure) canView(chirp Chirp, viewerID int) bool {
+	if viewerID != 0 && viewerID != chirp.AuthorID && dbStructure.blocked(viewerID, chirp.AuthorID) {
+		return false
+	}
+	return chirp.visibleTo(viewerID, dbStructure.following(viewerID))
+}
+
+// following returns the users userID follows.
+func (dbStructure *DBStructure) following(userID int) map[int]struct{} {
+	following := make(map[int]struct{}, len(dbStructure.Follows[userID]))
+	for followeeID := range dbStructure.Follows[userID] {
+		following[followeeID] = struct{}{}
+	}
+	return following
+}
+
+// CanViewChirp reports whether viewerID, who is 0 when anonymous, may see
+// chirp. Listings apply the same rules through ChirpQuery.ViewerID.
+func (db *DB) CanViewChirp(chirp Chirp, viewerID int) (bool, error) {
+	visible := false
+	err := db.View(func(dbStructure *DBStructure) error {
+		visible = dbStructure.canView(chirp, viewerID)
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return visible, nil
+}
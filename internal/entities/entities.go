@@ -0,0 +1,88 @@
+// Package entities finds the hashtags and mentions in a chirp's body.
+package entities
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+type Kind string
+
+const (
+	Hashtag Kind = "hashtag"
+	Mention Kind = "mention"
+)
+
+// Entity is a hashtag or mention found in a text. Text is what follows the
+// leading # or @. Start and End count runes (Unicode code points) from the
+// start of the text, End exclusive, and cover the leading # or @ too.
+type Entity struct {
+	Kind  Kind
+	Text  string
+	Start int
+	End   int
+}
+
+var (
+	hashtagPattern = regexp.MustCompile(`#([\p{L}\p{M}\p{N}_]+)`)
+	// A mention names a handle or an email address. Both parse, but only
+	// handles are resolved to users.
+	mentionPattern = regexp.MustCompile(
+		`@([A-Za-z0-9_]+(?:[.+-][A-Za-z0-9_]+)*@[A-Za-z0-9-]+(?:\.[A-Za-z0-9-]+)+|[A-Za-z0-9_]+)`,
+	)
+)
+
+// Parse returns the hashtags and mentions in text, in the order they appear.
+// They must not follow a letter, digit or underscore, so the domain of an
+// email address isn't taken for a mention, and hashtags must contain
+// something other than digits, so "#1" isn't one.
+func Parse(text string) []Entity {
+	found := []Entity{}
+	for _, match := range hashtagPattern.FindAllStringSubmatchIndex(text, -1) {
+		tag := text[match[2]:match[3]]
+		if strings.IndexFunc(tag, func(r rune) bool { return !unicode.IsDigit(r) }) < 0 {
+			continue
+		}
+		if entity, ok := newEntity(Hashtag, text, match); ok {
+			found = append(found, entity)
+		}
+	}
+	for _, match := range mentionPattern.FindAllStringSubmatchIndex(text, -1) {
+		if entity, ok := newEntity(Mention, text, match); ok {
+			found = append(found, entity)
+		}
+	}
+
+	sort.Slice(found, func(i, j int) bool {
+		return found[i].Start < found[j].Start
+	})
+	return found
+}
+
+func newEntity(kind Kind, text string, match []int) (Entity, bool) {
+	if before, _ := utf8.DecodeLastRuneInString(text[:match[0]]); match[0] > 0 && isWordRune(before) {
+		return Entity{}, false
+	}
+	start := utf8.RuneCountInString(text[:match[0]])
+	return Entity{
+		Kind:  kind,
+		Text:  text[match[2]:match[3]],
+		Start: start,
+		End:   start + utf8.RuneCountInString(text[match[0]:match[1]]),
+	}, true
+}
+
+func isWordRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.Is(unicode.M, r)
+}
+
+// NormalizeHashtag returns the form a hashtag is indexed under, so that
+// #Go, #GO and #go are all the same tag.
+func NormalizeHashtag(tag string) string {
+	return strings.ToLower(strings.ToUpper(norm.NFC.String(tag)))
+}
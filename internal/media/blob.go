@@ -0,0 +1,103 @@
+// Package media validates and processes uploaded images and stores them.
+package media
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+)
+
+var ErrNotExist = errors.New("blob does not exist")
+
+// BlobStore keeps blobs of bytes under string keys.
+type BlobStore interface {
+	// Put stores data under key, replacing any blob already there.
+	Put(key string, data []byte) error
+	// Get opens the blob stored under key, or returns ErrNotExist.
+	Get(key string) (io.ReadSeekCloser, error)
+	// Delete removes the blob under key. Deleting a missing blob is not an
+	// error.
+	Delete(key string) error
+}
+
+// keyPattern keeps keys from naming files outside the store's directory.
+var keyPattern = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+var errInvalidKey = errors.New("invalid blob key")
+
+// FSBlobStore is a BlobStore that keeps each blob in its own file in a
+// directory on the local filesystem.
+type FSBlobStore struct {
+	dir string
+}
+
+func NewFSBlobStore(dir string) (*FSBlobStore, error) {
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return nil, err
+	}
+	return &FSBlobStore{dir: dir}, nil
+}
+
+func (s *FSBlobStore) path(key string) (string, error) {
+	if !keyPattern.MatchString(key) || key == "." || key == ".." {
+		return "", errInvalidKey
+	}
+	return filepath.Join(s.dir, key), nil
+}
+
+// Put writes the blob to a temp file first and renames it into place, so a
+// reader never sees a partly written blob.
+func (s *FSBlobStore) Put(key string, data []byte) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(s.dir, ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (s *FSBlobStore) Get(key string) (io.ReadSeekCloser, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotExist
+	}
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (s *FSBlobStore) Delete(key string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,207 @@
+package media
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+
+	"golang.org/x/image/draw"
+)
+
+const (
+	// MaxDimension caps the width and height of uploads, so that a small
+	// file can't decode to an enormous image.
+	MaxDimension = 8192
+	// ThumbnailSize is the most pixels a thumbnail has on either side.
+	ThumbnailSize = 320
+)
+
+var (
+	ErrUnsupportedType = errors.New("unsupported media type")
+	ErrInvalidImage    = errors.New("invalid image")
+)
+
+// Image is a processed upload, ready to be stored.
+type Image struct {
+	ContentType string
+	// Data is the upload with its metadata, such as EXIF, removed.
+	Data                 []byte
+	SHA256               string
+	Width                int
+	Height               int
+	Thumbnail            []byte
+	ThumbnailContentType string
+}
+
+// Process checks that data is a PNG, JPEG or GIF image, judging by its
+// content rather than any name or type it was uploaded with, strips its
+// metadata and makes a thumbnail of it.
+func Process(data []byte) (Image, error) {
+	contentType := http.DetectContentType(data)
+	var stripped []byte
+	var err error
+	switch contentType {
+	case "image/jpeg":
+		stripped, err = stripJPEG(data)
+	case "image/png":
+		stripped, err = stripPNG(data)
+	case "image/gif":
+		stripped, err = stripGIF(data)
+	default:
+		return Image{}, ErrUnsupportedType
+	}
+	if err != nil {
+		return Image{}, ErrInvalidImage
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(stripped))
+	if err != nil {
+		return Image{}, ErrInvalidImage
+	}
+	if config.Width < 1 || config.Height < 1 || config.Width > MaxDimension || config.Height > MaxDimension {
+		return Image{}, ErrInvalidImage
+	}
+	decoded, _, err := image.Decode(bytes.NewReader(stripped))
+	if err != nil {
+		return Image{}, ErrInvalidImage
+	}
+
+	thumbnail, thumbnailType, err := makeThumbnail(decoded, contentType)
+	if err != nil {
+		return Image{}, err
+	}
+
+	sum := sha256.Sum256(stripped)
+	return Image{
+		ContentType:          contentType,
+		Data:                 stripped,
+		SHA256:               hex.EncodeToString(sum[:]),
+		Width:                config.Width,
+		Height:               config.Height,
+		Thumbnail:            thumbnail,
+		ThumbnailContentType: thumbnailType,
+	}, nil
+}
+
+// makeThumbnail scales img to fit within ThumbnailSize on both sides and
+// encodes it afresh, which leaves behind any metadata the original had.
+func makeThumbnail(img image.Image, contentType string) ([]byte, string, error) {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width > ThumbnailSize || height > ThumbnailSize {
+		if width >= height {
+			width, height = ThumbnailSize, max(1, height*ThumbnailSize/width)
+		} else {
+			width, height = max(1, width*ThumbnailSize/height), ThumbnailSize
+		}
+	}
+	scaled := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(scaled, scaled.Bounds(), img, bounds, draw.Over, nil)
+
+	buf := bytes.Buffer{}
+	if contentType == "image/jpeg" {
+		err := jpeg.Encode(&buf, scaled, &jpeg.Options{Quality: 85})
+		return buf.Bytes(), "image/jpeg", err
+	}
+	err := png.Encode(&buf, scaled)
+	return buf.Bytes(), "image/png", err
+}
+
+// stripJPEG drops the segments that carry metadata (APP1 for EXIF and XMP,
+// APP13 for IPTC, and comments) without re-encoding the image.
+func stripJPEG(data []byte) ([]byte, error) {
+	if len(data) < 2 || data[0] != 0xFF || data[1] != 0xD8 {
+		return nil, ErrInvalidImage
+	}
+	out := []byte{0xFF, 0xD8}
+	i := 2
+	for {
+		if i+4 > len(data) || data[i] != 0xFF {
+			return nil, ErrInvalidImage
+		}
+		marker := data[i+1]
+		if marker == 0xFF {
+			// Fill byte before a marker.
+			i++
+			continue
+		}
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		end := i + 2 + length
+		if length < 2 || end > len(data) {
+			return nil, ErrInvalidImage
+		}
+		if marker == 0xDA {
+			// Start of scan: the compressed image data follows.
+			return append(out, data[i:]...), nil
+		}
+		if marker != 0xE1 && marker != 0xED && marker != 0xFE {
+			out = append(out, data[i:end]...)
+		}
+		i = end
+	}
+}
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// stripPNG drops the chunks that carry EXIF data and text.
+func stripPNG(data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, pngSignature) {
+		return nil, ErrInvalidImage
+	}
+	out := append([]byte{}, pngSignature...)
+	i := len(pngSignature)
+	for i < len(data) {
+		if i+8 > len(data) {
+			return nil, ErrInvalidImage
+		}
+		length := int(binary.BigEndian.Uint32(data[i:]))
+		end := i + 12 + length
+		if length < 0 || end > len(data) {
+			return nil, ErrInvalidImage
+		}
+		switch string(data[i+4 : i+8]) {
+		case "eXIf", "tEXt", "zTXt", "iTXt":
+		default:
+			out = append(out, data[i:end]...)
+		}
+		i = end
+	}
+	return out, nil
+}
+
+// stripGIF re-encodes a GIF, which keeps its frames and timing but drops
+// comments and application data such as XMP.
+func stripGIF(data []byte) ([]byte, error) {
+	decoded, err := gif.DecodeAll(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	for _, frame := range decoded.Image {
+		bounds := frame.Bounds()
+		if bounds.Dx() > MaxDimension || bounds.Dy() > MaxDimension {
+			return nil, ErrInvalidImage
+		}
+	}
+	buf := bytes.Buffer{}
+	err = gif.EncodeAll(&buf, decoded)
+	return buf.Bytes(), err
+}
+
+// OriginalKey is the blob key an image with the given SHA-256 is stored
+// under. Keying by content means identical uploads share one blob.
+func OriginalKey(sha256 string) string {
+	return sha256
+}
+
+// ThumbnailKey is the blob key of the thumbnail of the image with the given
+// SHA-256.
+func ThumbnailKey(sha256 string) string {
+	return sha256 + ".thumb"
+}
@@ -0,0 +1,94 @@
+// Package moderation checks chirp text against a chain of filters, each of
+// which can mask the offending text or reject the chirp outright.
+package moderation
+
+import (
+	"sort"
+	"strings"
+)
+
+type Action string
+
+const (
+	// ActionMask replaces the flagged text with asterisks.
+	ActionMask Action = "mask"
+	// ActionReject refuses the whole chirp.
+	ActionReject Action = "reject"
+)
+
+const mask = "****"
+
+// Flag is one thing a filter objected to. Start and End are byte offsets of
+// the flagged text.
+type Flag struct {
+	Filter string `json:"filter"`
+	Reason string `json:"reason"`
+	Action Action `json:"action"`
+	Start  int    `json:"-"`
+	End    int    `json:"-"`
+}
+
+type Filter interface {
+	Name() string
+	Check(text string) []Flag
+}
+
+// Result is the outcome of running a chain over some text. Text has every
+// masked span replaced; it is only meaningful when Rejected is false.
+type Result struct {
+	Text     string
+	Flags    []Flag
+	Rejected bool
+}
+
+// Chain runs filters in order. A Chain is immutable once built.
+type Chain struct {
+	filters []Filter
+}
+
+func NewChain(filters ...Filter) *Chain {
+	return &Chain{filters: filters}
+}
+
+func (c *Chain) Moderate(text string) Result {
+	result := Result{Text: text}
+	for _, filter := range c.filters {
+		for _, flag := range filter.Check(text) {
+			result.Flags = append(result.Flags, flag)
+			if flag.Action == ActionReject {
+				result.Rejected = true
+			}
+		}
+	}
+	result.Text = applyMasks(text, result.Flags)
+	return result
+}
+
+// applyMasks replaces the spans of every mask flag, merging overlaps.
+func applyMasks(text string, flags []Flag) string {
+	spans := [][2]int{}
+	for _, flag := range flags {
+		if flag.Action == ActionMask {
+			spans = append(spans, [2]int{flag.Start, flag.End})
+		}
+	}
+	if len(spans) == 0 {
+		return text
+	}
+	sort.Slice(spans, func(i, j int) bool { return spans[i][0] < spans[j][0] })
+
+	var sb strings.Builder
+	pos := 0
+	for _, span := range spans {
+		if span[1] <= pos {
+			continue
+		}
+		if span[0] >= pos {
+			sb.WriteString(text[pos:span[0]])
+			sb.WriteString(mask)
+		}
+		pos = span[1]
+	}
+	sb.WriteString(text[pos:])
+	return sb.String()
+}
@@ -0,0 +1,50 @@
+package moderation
+
+import (
+	"regexp"
+)
+
+// RegexFilter flags every match of a regular expression.
+type RegexFilter struct {
+	name   string
+	action Action
+	reason string
+	re     *regexp.Regexp
+}
+
+func NewRegexFilter(name string, action Action, pattern, reason string) (*RegexFilter, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	if reason == "" {
+		reason = "matches " + pattern
+	}
+	return &RegexFilter{
+		name:   name,
+		action: action,
+		reason: reason,
+		re:     re,
+	}, nil
+}
+
+func (f *RegexFilter) Name() string {
+	return f.name
+}
+
+func (f *RegexFilter) Check(text string) []Flag {
+	flags := []Flag{}
+	for _, match := range f.re.FindAllStringIndex(text, -1) {
+		if match[0] == match[1] {
+			continue
+		}
+		flags = append(flags, Flag{
+			Filter: f.name,
+			Reason: f.reason,
+			Action: f.action,
+			Start:  match[0],
+			End:    match[1],
+		})
+	}
+	return flags
+}
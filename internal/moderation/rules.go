@@ -0,0 +1,230 @@
+package moderation
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Rules is the moderation config file. Filters run in the order listed:
+// word lists first, then regexes.
+//
+//	{
+//	  "word_lists": [
+//	    {"name": "profanity", "path": "profanity.txt", "action": "mask"},
+//	    {"name": "slurs", "words": ["..."], "action": "reject"}
+//	  ],
+//	  "regexes": [
+//	    {"name": "links", "pattern": "(?i)https?://bit\\.ly/", "action": "reject", "reason": "link shorteners aren't allowed"}
+//	  ]
+//	}
+//
+// Word list paths are relative to the rules file.
+type Rules struct {
+	WordLists []WordListRule `json:"word_lists"`
+	Regexes   []RegexRule    `json:"regexes"`
+}
+
+type WordListRule struct {
+	Name   string   `json:"name"`
+	Path   string   `json:"path"`
+	Words  []string `json:"words"`
+	Action Action   `json:"action"`
+}
+
+type RegexRule struct {
+	Name    string `json:"name"`
+	Pattern string `json:"pattern"`
+	Reason  string `json:"reason"`
+	Action  Action `json:"action"`
+}
+
+// DefaultChain is used when no rules file is configured.
+func DefaultChain() *Chain {
+	return NewChain(NewWordListFilter("default", ActionMask, []string{
+		"kerfuffle",
+		"sharbert",
+		"fornax",
+	}))
+}
+
+// LoadRules builds a chain from a rules file. It also returns every file the
+// chain was built from, so they can be watched for changes.
+func LoadRules(path string) (*Chain, []string, error) {
+	dat, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	rules := Rules{}
+	err = json.Unmarshal(dat, &rules)
+	if err != nil {
+		return nil, nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+
+	files := []string{path}
+	filters := []Filter{}
+	for i, rule := range rules.WordLists {
+		action, err := parseAction(rule.Action)
+		if err != nil {
+			return nil, nil, fmt.Errorf("word list %d: %w", i, err)
+		}
+		name := rule.Name
+		if name == "" {
+			name = fmt.Sprintf("word-list-%d", i+1)
+		}
+		words := rule.Words
+		if rule.Path != "" {
+			listPath := rule.Path
+			if !filepath.IsAbs(listPath) {
+				listPath = filepath.Join(filepath.Dir(path), listPath)
+			}
+			listWords, err := LoadWordList(listPath)
+			if err != nil {
+				return nil, nil, fmt.Errorf("word list %s: %w", name, err)
+			}
+			words = append(append([]string{}, words...), listWords...)
+			files = append(files, listPath)
+		}
+		filters = append(filters, NewWordListFilter(name, action, words))
+	}
+
+	for i, rule := range rules.Regexes {
+		action, err := parseAction(rule.Action)
+		if err != nil {
+			return nil, nil, fmt.Errorf("regex %d: %w", i, err)
+		}
+		name := rule.Name
+		if name == "" {
+			name = fmt.Sprintf("regex-%d", i+1)
+		}
+		filter, err := NewRegexFilter(name, action, rule.Pattern, rule.Reason)
+		if err != nil {
+			return nil, nil, fmt.Errorf("regex %s: %w", name, err)
+		}
+		filters = append(filters, filter)
+	}
+
+	return NewChain(filters...), files, nil
+}
+
+func parseAction(action Action) (Action, error) {
+	switch action {
+	case "", ActionMask:
+		return ActionMask, nil
+	case ActionReject:
+		return ActionReject, nil
+	default:
+		return "", fmt.Errorf("unknown action %q", action)
+	}
+}
+
+// Moderator holds the current chain and swaps in a new one whenever the rules
+// it was loaded from change. It is safe for concurrent use.
+type Moderator struct {
+	path  string
+	chain atomic.Pointer[Chain]
+
+	mu    sync.Mutex
+	files map[string]fileVersion
+}
+
+type fileVersion struct {
+	modTime time.Time
+	size    int64
+}
+
+// NewModerator loads rules from path, or uses DefaultChain if path is empty.
+func NewModerator(path string) (*Moderator, error) {
+	m := &Moderator{path: path}
+	if path == "" {
+		m.chain.Store(DefaultChain())
+		return m, nil
+	}
+	err := m.Reload()
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (m *Moderator) Moderate(text string) Result {
+	return m.chain.Load().Moderate(text)
+}
+
+// Reload rebuilds the chain from the rules file. On error the current chain
+// stays in place.
+func (m *Moderator) Reload() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.reload()
+}
+
+func (m *Moderator) reload() error {
+	chain, files, err := LoadRules(m.path)
+	if err != nil {
+		return err
+	}
+	m.chain.Store(chain)
+	m.files = statFiles(files)
+	return nil
+}
+
+// Watch polls the rules file and the word lists it references, reloading
+// when any of them changes. It never returns; run it in its own goroutine.
+func (m *Moderator) Watch(interval time.Duration) {
+	if m.path == "" {
+		return
+	}
+	for range time.Tick(interval) {
+		m.reloadIfChanged()
+	}
+}
+
+func (m *Moderator) reloadIfChanged() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	paths := make([]string, 0, len(m.files))
+	for path := range m.files {
+		paths = append(paths, path)
+	}
+	current := statFiles(paths)
+	changed := false
+	for path, version := range m.files {
+		if current[path] != version {
+			changed = true
+		}
+	}
+	if !changed {
+		return
+	}
+
+	err := m.reload()
+	if err != nil {
+		// Remember the broken version so the error is logged once, not on
+		// every tick until the file is fixed.
+		m.files = current
+		log.Printf("Keeping previous moderation rules: %s", err)
+		return
+	}
+	log.Printf("Reloaded moderation rules from %s", m.path)
+}
+
+func statFiles(paths []string) map[string]fileVersion {
+	versions := make(map[string]fileVersion, len(paths))
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			versions[path] = fileVersion{}
+			continue
+		}
+		versions[path] = fileVersion{modTime: info.ModTime(), size: info.Size()}
+	}
+	return versions
+}
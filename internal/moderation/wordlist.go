@@ -0,0 +1,120 @@
+package moderation
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// WordListFilter flags whole words found in a list. Words are compared after
+// normalization, so punctuation around a word, letter case, accents and
+// compatibility forms such as full-width letters don't hide a match.
+type WordListFilter struct {
+	name   string
+	action Action
+	words  map[string]struct{}
+}
+
+func NewWordListFilter(name string, action Action, words []string) *WordListFilter {
+	filter := &WordListFilter{
+		name:   name,
+		action: action,
+		words:  map[string]struct{}{},
+	}
+	for _, word := range words {
+		normalized := normalizeWord(word)
+		if normalized != "" {
+			filter.words[normalized] = struct{}{}
+		}
+	}
+	return filter
+}
+
+// LoadWordList reads a word list file: one word per line, with blank lines
+// and lines starting with '#' ignored.
+func LoadWordList(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	words := []string{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		words = append(words, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+	return words, nil
+}
+
+func (f *WordListFilter) Name() string {
+	return f.name
+}
+
+func (f *WordListFilter) Check(text string) []Flag {
+	flags := []Flag{}
+	for _, span := range wordSpans(text) {
+		word := text[span[0]:span[1]]
+		normalized := normalizeWord(word)
+		if _, ok := f.words[normalized]; !ok {
+			continue
+		}
+		flags = append(flags, Flag{
+			Filter: f.name,
+			Reason: fmt.Sprintf("%q is on the %s word list", normalized, f.name),
+			Action: f.action,
+			Start:  span[0],
+			End:    span[1],
+		})
+	}
+	return flags
+}
+
+// wordSpans returns the byte offsets of every run of letters, digits and
+// combining marks in text.
+func wordSpans(text string) [][2]int {
+	spans := [][2]int{}
+	start := -1
+	for i, r := range text {
+		inWord := unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.Is(unicode.M, r)
+		switch {
+		case inWord && start < 0:
+			start = i
+		case !inWord && start >= 0:
+			spans = append(spans, [2]int{start, i})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		spans = append(spans, [2]int{start, len(text)})
+	}
+	return spans
+}
+
+// normalizeWord decomposes word, drops accents and folds case, so "Kérfuffle"
+// and "ｋｅｒｆｕｆｆｌｅ" both become "kerfuffle".
+func normalizeWord(word string) string {
+	decomposed := norm.NFKD.String(word)
+	var sb strings.Builder
+	for len(decomposed) > 0 {
+		r, size := utf8.DecodeRuneInString(decomposed)
+		decomposed = decomposed[size:]
+		if unicode.Is(unicode.Mn, r) {
+			continue
+		}
+		sb.WriteRune(unicode.ToLower(r))
+	}
+	return sb.String()
+}
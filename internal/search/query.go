@@ -0,0 +1,56 @@
+package search
+
+import (
+	"strings"
+)
+
+// Query is a parsed search: every clause must match. A clause is a single
+// term, a prefix ending in "*", or a quoted phrase.
+type Query struct {
+	clauses []clause
+}
+
+type clause struct {
+	terms  []string
+	prefix bool
+}
+
+// ParseQuery parses queries such as `go "web server" chirp*`.
+func ParseQuery(s string) (Query, error) {
+	q := Query{}
+	for s != "" {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			break
+		}
+
+		if s[0] == '"' {
+			phrase, rest, _ := strings.Cut(s[1:], `"`)
+			s = rest
+			terms := Tokenize(phrase)
+			if len(terms) > 0 {
+				q.clauses = append(q.clauses, clause{terms: terms})
+			}
+			continue
+		}
+
+		word, rest, _ := strings.Cut(s, " ")
+		s = rest
+		prefix := strings.HasSuffix(word, "*")
+		terms := Tokenize(word)
+		if prefix && len(terms) == 1 {
+			q.clauses = append(q.clauses, clause{terms: terms, prefix: true})
+			continue
+		}
+		// Punctuation inside a word ("don't", "e-mail") splits it into
+		// several terms, which must then appear together.
+		if len(terms) > 0 {
+			q.clauses = append(q.clauses, clause{terms: terms})
+		}
+	}
+
+	if len(q.clauses) == 0 {
+		return Query{}, ErrEmptyQuery
+	}
+	return q, nil
+}
@@ -0,0 +1,215 @@
+// Package search implements the in-memory inverted index behind chirp search.
+package search
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// BM25 tuning constants.
+const (
+	k1 = 1.2
+	b  = 0.75
+)
+
+var ErrEmptyQuery = errors.New("empty search query")
+
+// Index maps terms to the documents and positions they occur at. It is safe
+// for concurrent use.
+type Index struct {
+	mu       sync.RWMutex
+	postings map[string]map[int][]int
+	docs     map[int][]string
+	totalLen int
+}
+
+// Match is a document that satisfied a query, with its relevance score.
+type Match struct {
+	ID    int
+	Score float64
+}
+
+func NewIndex() *Index {
+	return &Index{
+		postings: map[string]map[int][]int{},
+		docs:     map[int][]string{},
+	}
+}
+
+// Tokenize splits text into case-folded terms: runs of letters and digits.
+// Everything else, including punctuation, separates terms.
+func Tokenize(text string) []string {
+	fields := strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && !unicode.Is(unicode.Mn, r)
+	})
+	terms := make([]string, 0, len(fields))
+	for _, field := range fields {
+		terms = append(terms, fold(field))
+	}
+	return terms
+}
+
+// fold case-folds a term. Upper-casing first maps letters with several
+// lower-case forms, such as the Greek final sigma, onto a single one.
+func fold(term string) string {
+	return strings.ToLower(strings.ToUpper(term))
+}
+
+// Add indexes text under id, replacing anything previously indexed there.
+func (idx *Index) Add(id int, text string) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.remove(id)
+	terms := Tokenize(text)
+	for pos, term := range terms {
+		docs, ok := idx.postings[term]
+		if !ok {
+			docs = map[int][]int{}
+			idx.postings[term] = docs
+		}
+		docs[id] = append(docs[id], pos)
+	}
+	idx.docs[id] = terms
+	idx.totalLen += len(terms)
+}
+
+func (idx *Index) Remove(id int) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.remove(id)
+}
+
+// Reset removes every document, so that searches running meanwhile see the
+// index either as it was or empty.
+func (idx *Index) Reset() {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.postings = map[string]map[int][]int{}
+	idx.docs = map[int][]string{}
+	idx.totalLen = 0
+}
+
+func (idx *Index) remove(id int) {
+	terms, ok := idx.docs[id]
+	if !ok {
+		return
+	}
+	for _, term := range terms {
+		delete(idx.postings[term], id)
+		if len(idx.postings[term]) == 0 {
+			delete(idx.postings, term)
+		}
+	}
+	delete(idx.docs, id)
+	idx.totalLen -= len(terms)
+}
+
+// Search returns every document matching all clauses of q, most relevant
+// first.
+func (idx *Index) Search(q Query) []Match {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	scores := map[int]float64(nil)
+	for _, c := range q.clauses {
+		clauseScores := idx.scoreClause(c)
+		if scores == nil {
+			scores = clauseScores
+			continue
+		}
+		for id, score := range scores {
+			clauseScore, ok := clauseScores[id]
+			if !ok {
+				delete(scores, id)
+				continue
+			}
+			scores[id] = score + clauseScore
+		}
+	}
+
+	matches := make([]Match, 0, len(scores))
+	for id, score := range scores {
+		matches = append(matches, Match{ID: id, Score: score})
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Score != matches[j].Score {
+			return matches[i].Score > matches[j].Score
+		}
+		return matches[i].ID > matches[j].ID
+	})
+	return matches
+}
+
+func (idx *Index) scoreClause(c clause) map[int]float64 {
+	scores := map[int]float64{}
+	switch {
+	case c.prefix:
+		for term, docs := range idx.postings {
+			if !strings.HasPrefix(term, c.terms[0]) {
+				continue
+			}
+			for id, positions := range docs {
+				scores[id] += idx.bm25(len(docs), len(positions), id)
+			}
+		}
+	case len(c.terms) == 1:
+		docs := idx.postings[c.terms[0]]
+		for id, positions := range docs {
+			scores[id] = idx.bm25(len(docs), len(positions), id)
+		}
+	default:
+		matches := idx.phraseMatches(c.terms)
+		for id, count := range matches {
+			for _, term := range c.terms {
+				scores[id] += idx.bm25(len(idx.postings[term]), count, id)
+			}
+		}
+	}
+	return scores
+}
+
+// phraseMatches counts how often terms occur consecutively in each document.
+func (idx *Index) phraseMatches(terms []string) map[int]int {
+	counts := map[int]int{}
+	first := idx.postings[terms[0]]
+	for id, starts := range first {
+		for _, start := range starts {
+			found := true
+			for offset, term := range terms[1:] {
+				if !containsInt(idx.postings[term][id], start+offset+1) {
+					found = false
+					break
+				}
+			}
+			if found {
+				counts[id]++
+			}
+		}
+	}
+	return counts
+}
+
+func (idx *Index) bm25(docFreq, termFreq, id int) float64 {
+	n := float64(len(idx.docs))
+	idf := math.Log(1 + (n-float64(docFreq)+0.5)/(float64(docFreq)+0.5))
+	avgLen := float64(idx.totalLen) / n
+	docLen := float64(len(idx.docs[id]))
+	tf := float64(termFreq)
+	return idf * tf * (k1 + 1) / (tf + k1*(1-b+b*docLen/avgLen))
+}
+
+func containsInt(values []int, value int) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
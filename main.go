@@ -2,19 +2,29 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"sync"
+	"time"
 
 	"github.com/brookwarren/chirpy/internal/database"
+	"github.com/brookwarren/chirpy/internal/media"
+	"github.com/brookwarren/chirpy/internal/moderation"
 	"github.com/joho/godotenv"
 )
 
 type apiConfig struct {
 	fileserverHits int
-	DB             *database.DB
+	DB             database.Store
 	jwtSecret      string
 	polkaKey       string
+	moderator      *moderation.Moderator
+	blobs          media.BlobStore
+	// mediaMu orders storing an upload's blobs against deleting the blobs of
+	// media that are no longer referenced, which may share them.
+	mediaMu sync.Mutex
 }
 
 func main() {
@@ -23,6 +33,21 @@ func main() {
 
 	godotenv.Load(".env")
 
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		err := runMigrate(os.Args[2:])
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "bootstrap-admin" {
+		err := runBootstrapAdmin(os.Args[2:])
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	jwtSecret := os.Getenv("JWT_SECRET")
 	if jwtSecret == "" {
 		log.Fatal("JWT_SECRET environment variable is not set")
@@ -32,7 +57,25 @@ func main() {
 		log.Fatal("POLKA_KEY environment variable is not set")
 	}
 
-	db, err := database.NewDB("database.json")
+	db, err := openStore(database.Options{
+		Journal: os.Getenv("DB_JOURNAL") == "true",
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+
+	moderator, err := moderation.NewModerator(os.Getenv("MODERATION_RULES"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	go moderator.Watch(5 * time.Second)
+
+	mediaDir := os.Getenv("MEDIA_DIR")
+	if mediaDir == "" {
+		mediaDir = "media"
+	}
+	blobs, err := media.NewFSBlobStore(mediaDir)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -51,14 +94,18 @@ func main() {
 		DB:             db,
 		jwtSecret:      jwtSecret,
 		polkaKey:       polkaKey,
+		moderator:      moderator,
+		blobs:          blobs,
 	}
 
+	go apiCfg.runScheduler(5 * time.Second)
+
 	mux := http.NewServeMux()
 	fsHandler := apiCfg.middlewareMetricsInc(http.StripPrefix("/app", http.FileServer(http.Dir(filepathRoot))))
 	mux.Handle("/app/*", fsHandler)
 
 	mux.HandleFunc("GET /api/healthz", handlerReadiness)
-	mux.HandleFunc("GET /api/reset", apiCfg.handlerReset)
+	mux.Handle("GET /api/reset", apiCfg.middlewareRequireRole(database.RoleAdmin, http.HandlerFunc(apiCfg.handlerReset)))
 
 	mux.HandleFunc("POST /api/polka/webhooks", apiCfg.handlerWebhook)
 
@@ -66,15 +113,76 @@ func main() {
 	mux.HandleFunc("POST /api/refresh", apiCfg.handlerRefresh)
 	mux.HandleFunc("POST /api/login", apiCfg.handlerLogin)
 
+	mux.HandleFunc("POST /api/reports", apiCfg.handlerReportsCreate)
+
 	mux.HandleFunc("POST /api/users", apiCfg.handlerUsersCreate)
 	mux.HandleFunc("PUT /api/users", apiCfg.handlerUsersUpdate)
+	mux.HandleFunc("PATCH /api/users/me", apiCfg.handlerUsersUpdate)
+	mux.HandleFunc("GET /api/users/{userID}", apiCfg.handlerUsersGet)
+	mux.HandleFunc("GET /api/users/by-handle/{handle}", apiCfg.handlerUsersGetByHandle)
+	mux.HandleFunc("POST /api/users/{userID}/follow", apiCfg.handlerFollowsCreate)
+	mux.HandleFunc("DELETE /api/users/{userID}/follow", apiCfg.handlerFollowsDelete)
+	mux.HandleFunc("POST /api/users/{userID}/block", apiCfg.handlerBlocksCreate)
+	mux.HandleFunc("DELETE /api/users/{userID}/block", apiCfg.handlerBlocksDelete)
+	mux.HandleFunc("POST /api/users/{userID}/mute", apiCfg.handlerMutesCreate)
+	mux.HandleFunc("DELETE /api/users/{userID}/mute", apiCfg.handlerMutesDelete)
+	mux.HandleFunc("GET /api/blocks", apiCfg.handlerBlocksList)
+	mux.HandleFunc("GET /api/mutes", apiCfg.handlerMutesList)
+	// followers and following share a pattern, which by-handle/{handle} is
+	// more specific than; two patterns would each overlap it.
+	mux.HandleFunc("GET /api/users/{userID}/{relation}", apiCfg.handlerUsersRelation)
+
+	mux.HandleFunc("GET /api/timeline", apiCfg.handlerTimeline)
+	mux.HandleFunc("GET /api/mentions", apiCfg.handlerMentions)
+	mux.HandleFunc("GET /api/notifications", apiCfg.handlerNotificationsList)
+	mux.HandleFunc("POST /api/notifications/read", apiCfg.handlerNotificationsRead)
+
+	mux.HandleFunc("POST /api/conversations", apiCfg.handlerConversationsCreate)
+	mux.HandleFunc("GET /api/conversations", apiCfg.handlerConversationsList)
+	mux.HandleFunc("GET /api/conversations/{conversationID}", apiCfg.handlerConversationsGet)
+	mux.HandleFunc("POST /api/conversations/{conversationID}/messages", apiCfg.handlerMessagesCreate)
+	mux.HandleFunc("GET /api/conversations/{conversationID}/messages", apiCfg.handlerMessagesList)
+
+	mux.HandleFunc("GET /api/hashtags/{tag}/chirps", apiCfg.handlerHashtagChirps)
+	mux.HandleFunc("GET /api/trending", apiCfg.handlerTrending)
+
+	mux.HandleFunc("POST /api/media", apiCfg.handlerMediaUpload)
+	mux.HandleFunc("GET /api/media/{mediaID}", apiCfg.handlerMediaGet)
+	mux.HandleFunc("GET /api/media/{mediaID}/original", apiCfg.handlerMediaOriginal)
+	mux.HandleFunc("GET /api/media/{mediaID}/thumbnail", apiCfg.handlerMediaThumbnail)
 
 	mux.HandleFunc("DELETE /api/chirps/{chirpID}", apiCfg.handlerChirpsDelete)
+	mux.HandleFunc("PUT /api/chirps/{chirpID}", apiCfg.handlerChirpsUpdate)
 	mux.HandleFunc("POST /api/chirps", apiCfg.handlerChirpsCreate)
 	mux.HandleFunc("GET /api/chirps", apiCfg.handlerChirpsRetrieve)
+	mux.HandleFunc("GET /api/chirps/search", apiCfg.handlerChirpsSearch)
+	mux.HandleFunc("GET /api/chirps/drafts", apiCfg.handlerChirpDraftsList)
+	mux.HandleFunc("PUT /api/drafts/{draftID}", apiCfg.handlerChirpDraftsUpdate)
+	mux.HandleFunc("DELETE /api/drafts/{draftID}", apiCfg.handlerChirpDraftsDelete)
+	mux.HandleFunc("POST /api/drafts/{draftID}/publish", apiCfg.handlerChirpDraftsPublish)
 	mux.HandleFunc("GET /api/chirps/{chirpID}", apiCfg.handlerChirpsGet)
-
-	mux.HandleFunc("GET /admin/metrics", apiCfg.handlerMetrics)
+	mux.HandleFunc("GET /api/chirps/{chirpID}/history", apiCfg.handlerChirpsHistory)
+	mux.HandleFunc("GET /api/chirps/{chirpID}/thread", apiCfg.handlerChirpsThread)
+	mux.HandleFunc("POST /api/chirps/{chirpID}/like", apiCfg.handlerChirpsLike)
+	mux.HandleFunc("DELETE /api/chirps/{chirpID}/like", apiCfg.handlerChirpsUnlike)
+	mux.HandleFunc("POST /api/chirps/{chirpID}/rechirp", apiCfg.handlerChirpsRechirp)
+	mux.HandleFunc("DELETE /api/chirps/{chirpID}/rechirp", apiCfg.handlerChirpsUnrechirp)
+
+	// Every /admin route is for moderators at least; some are for admins only.
+	admin := http.NewServeMux()
+	admin.Handle("GET /admin/metrics", apiCfg.middlewareRequireRole(database.RoleAdmin, http.HandlerFunc(apiCfg.handlerMetrics)))
+	admin.Handle("PUT /admin/users/{userID}/role", apiCfg.middlewareRequireRole(database.RoleAdmin, http.HandlerFunc(apiCfg.handlerAdminUsersRole)))
+	admin.HandleFunc("GET /admin/reports", apiCfg.handlerAdminReportsList)
+	admin.HandleFunc("GET /admin/reports/{reportID}", apiCfg.handlerAdminReportsGet)
+	admin.HandleFunc("POST /admin/reports/{reportID}/claim", apiCfg.handlerAdminReportsClaim)
+	admin.HandleFunc("POST /admin/reports/{reportID}/resolve", apiCfg.handlerAdminReportsResolve)
+	admin.HandleFunc("POST /admin/reports/{reportID}/dismiss", apiCfg.handlerAdminReportsDismiss)
+	admin.HandleFunc("POST /admin/chirps/{chirpID}/hide", apiCfg.handlerAdminChirpsHide)
+	admin.HandleFunc("DELETE /admin/chirps/{chirpID}/hide", apiCfg.handlerAdminChirpsUnhide)
+	admin.HandleFunc("POST /admin/users/{userID}/suspend", apiCfg.handlerAdminUsersSuspend)
+	admin.HandleFunc("DELETE /admin/users/{userID}/suspend", apiCfg.handlerAdminUsersUnsuspend)
+	admin.HandleFunc("GET /admin/moderation-log", apiCfg.handlerAdminModerationLog)
+	mux.Handle("/admin/", apiCfg.middlewareRequireRole(database.RoleModerator, admin))
 
 	corsMux := middlewareCors(mux)
 
@@ -86,3 +194,24 @@ func main() {
 	log.Printf("Serving files from %s on port: %s\n", filepathRoot, port)
 	log.Fatal(srv.ListenAndServe())
 }
+
+// openStore opens the storage backend named by DB_BACKEND: "json" (the
+// default) or "sqlite". DB_PATH overrides the default file name.
+func openStore(opts database.Options) (database.Store, error) {
+	backend := os.Getenv("DB_BACKEND")
+	path := os.Getenv("DB_PATH")
+	switch backend {
+	case "", "json":
+		if path == "" {
+			path = "database.json"
+		}
+		return database.NewDBWithOptions(path, opts)
+	case "sqlite":
+		if path == "" {
+			path = "database.sqlite"
+		}
+		return database.NewSQLiteDBWithOptions(path, opts)
+	default:
+		return nil, fmt.Errorf("unknown DB_BACKEND %q", backend)
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/brookwarren/chirpy/internal/database"
+)
+
+const migrateUsage = "usage: chirpy migrate up|status|dry-run"
+
+// runMigrate implements the `chirpy migrate` subcommand.
+func runMigrate(args []string) error {
+	if len(args) != 1 {
+		return errors.New(migrateUsage)
+	}
+
+	db, err := openStore(database.Options{
+		Journal:        os.Getenv("DB_JOURNAL") == "true",
+		SkipMigrations: true,
+	})
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	switch args[0] {
+	case "status":
+		status, err := db.MigrationStatus()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Schema version: %d (latest %d)\n", status.Version, status.Latest)
+		if len(status.Pending) == 0 {
+			fmt.Println("No pending migrations")
+		}
+		for _, name := range status.Pending {
+			fmt.Printf("Pending: %s\n", name)
+		}
+		return nil
+	case "up", "dry-run":
+		dryRun := args[0] == "dry-run"
+		applied, err := db.Migrate(dryRun)
+		for _, name := range applied {
+			if dryRun {
+				fmt.Printf("Would apply: %s\n", name)
+			} else {
+				fmt.Printf("Applied: %s\n", name)
+			}
+		}
+		if err != nil {
+			return err
+		}
+		if len(applied) == 0 {
+			fmt.Println("No pending migrations")
+		}
+		return nil
+	default:
+		return errors.New(migrateUsage)
+	}
+}
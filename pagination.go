@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/brookwarren/chirpy/internal/database"
+)
+
+const maxPageLimit = 100
+
+// pageCursor is what an opaque cursor decodes to. It records the ordering it
+// was issued for so a cursor can't be replayed against a different sort.
+type pageCursor struct {
+	Order     string    `json:"o"`
+	Backward  bool      `json:"b,omitempty"`
+	CreatedAt time.Time `json:"t"`
+	ID        int       `json:"i"`
+}
+
+var errInvalidCursor = errors.New("invalid cursor")
+
+// encodeCursor makes a cursor for the item sorted at the time at with the
+// given ID.
+func encodeCursor(order string, backward bool, at time.Time, id int) string {
+	dat, _ := json.Marshal(pageCursor{
+		Order:     order,
+		Backward:  backward,
+		CreatedAt: at,
+		ID:        id,
+	})
+	return base64.RawURLEncoding.EncodeToString(dat)
+}
+
+func decodeCursor(order, cursor string) (pageCursor, error) {
+	dat, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return pageCursor{}, errInvalidCursor
+	}
+	decoded := pageCursor{}
+	err = json.Unmarshal(dat, &decoded)
+	if err != nil || decoded.Order != order {
+		return pageCursor{}, errInvalidCursor
+	}
+	return decoded, nil
+}
+
+// applyCursor positions q according to the "cursor" query parameter.
+func applyCursor(q *database.ChirpQuery, order, cursor string) error {
+	if cursor == "" {
+		return nil
+	}
+	decoded, err := decodeCursor(order, cursor)
+	if err != nil {
+		return err
+	}
+	position := &database.ChirpCursor{CreatedAt: decoded.CreatedAt, ID: decoded.ID}
+	if decoded.Backward {
+		q.Before = position
+	} else {
+		q.After = position
+	}
+	return nil
+}
+
+// setPageLinks adds an RFC 8288 Link header pointing at the pages either side
+// of page, keeping every other query parameter of the request.
+func setPageLinks(w http.ResponseWriter, r *http.Request, order string, page database.ChirpPage) {
+	if len(page.Chirps) == 0 {
+		return
+	}
+
+	links := []string{}
+	if page.HasNext {
+		last := page.Cursor(len(page.Chirps) - 1)
+		links = append(links, pageLink(r, "next", encodeCursor(order, false, last.CreatedAt, last.ID)))
+	}
+	if page.HasPrev {
+		first := page.Cursor(0)
+		links = append(links, pageLink(r, "prev", encodeCursor(order, true, first.CreatedAt, first.ID)))
+	}
+	if len(links) > 0 {
+		w.Header().Set("Link", strings.Join(links, ", "))
+	}
+}
+
+// pageLink is one entry of a Link header: the request's URL with its cursor
+// replaced.
+func pageLink(r *http.Request, rel, cursor string) string {
+	u := url.URL{Path: r.URL.Path}
+	query := r.URL.Query()
+	query.Set("cursor", cursor)
+	u.RawQuery = query.Encode()
+	return fmt.Sprintf(`<%s>; rel="%s"`, u.String(), rel)
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/brookwarren/chirpy/internal/database"
+)
+
+// runScheduler publishes scheduled chirps as they fall due, checking every
+// interval. Scheduled chirps are kept in the database until they are
+// published, and publishing one deletes it in the same transaction as it
+// creates the chirp, so a restart neither loses nor repeats any: those that
+// fell due while the server was down are published on the first check.
+func (cfg *apiConfig) runScheduler(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		cfg.publishDueDrafts(time.Now())
+		<-ticker.C
+	}
+}
+
+func (cfg *apiConfig) publishDueDrafts(now time.Time) {
+	drafts, err := cfg.DB.GetDueChirpDrafts(now)
+	if err != nil {
+		log.Printf("Couldn't get scheduled chirps: %s", err)
+		return
+	}
+
+	for _, draft := range drafts {
+		_, err := cfg.publishDraft(draft)
+		if err == nil {
+			continue
+		}
+		reason := publishFailure(err)
+		if reason == "" {
+			// Most likely the draft was published or deleted since it was
+			// listed, or the database had a hiccup; either way, leave it
+			// for the next check.
+			if !errors.Is(err, database.ErrNotExist) {
+				log.Printf("Couldn't publish scheduled chirp %d: %s", draft.ID, err)
+			}
+			continue
+		}
+		err = cfg.DB.UnscheduleChirpDraft(draft.ID, reason)
+		if err != nil && !errors.Is(err, database.ErrNotExist) {
+			log.Printf("Couldn't unschedule chirp %d: %s", draft.ID, err)
+		}
+	}
+}
+
+var errAuthorSuspended = errors.New("author is suspended")
+
+// publishDraft publishes a draft, running it through validateChirp again:
+// the moderation rules, or the author's length limit, may have changed since
+// it was written. Nothing is published for an author who has been suspended
+// since scheduling it.
+func (cfg *apiConfig) publishDraft(draft database.ChirpDraft) (database.Chirp, error) {
+	author, err := cfg.DB.GetUser(draft.AuthorID)
+	if err != nil {
+		return database.Chirp{}, err
+	}
+	if author.Suspended {
+		return database.Chirp{}, errAuthorSuspended
+	}
+	cleaned, err := cfg.validateChirp(draft.Body, author)
+	if err != nil {
+		return database.Chirp{}, err
+	}
+	return cfg.DB.PublishChirpDraft(draft.ID, cleaned)
+}
+
+// publishFailure describes, for the author, why a draft can never be
+// published as it stands. It returns "" for errors that may go away by
+// themselves.
+func publishFailure(err error) string {
+	var tooLong chirpTooLongError
+	if errors.As(err, &tooLong) {
+		return fmt.Sprintf("%s: its length is %d and the limit is %d", tooLong.Error(), tooLong.Length, tooLong.Limit)
+	}
+	var rejected chirpRejectedError
+	if errors.As(err, &rejected) {
+		return fmt.Sprintf("%s: %s", rejected.Error(), strings.Join(rejected.Reasons, "; "))
+	}
+	if errors.Is(err, database.ErrParentNotExist) {
+		return "Couldn't find the chirp being replied to"
+	}
+	if errors.Is(err, database.ErrMediaNotExist) {
+		return "Couldn't find media"
+	}
+	if errors.Is(err, database.ErrBlocked) {
+		return "You can't reply to this chirp"
+	}
+	if errors.Is(err, errAuthorSuspended) {
+		return "Account is suspended"
+	}
+	return ""
+}